@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/atamanroman/ymc/musiccast"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func alarmCommand(args []string) error {
+	flags, timeout := newFlagSet("alarm", "[flags] [speaker]\n\nWithout flags the alarms are shown, of all clock-capable speakers if none is given.")
+	alarmOn := flags.String("alarm", "", "switch the alarm `on|off`")
+	mode := flags.String("mode", "", "alarm `mode` (oneday or weekly)")
+	volume := flags.Int("volume", 0, "alarm volume")
+	fade := flags.Int("fade", 0, "fade in interval in seconds")
+	fadeType := flags.Int("fade-type", 0, "fade type")
+	repeat := flags.Bool("repeat", false, "repeat the one day alarm")
+	day := flags.String("day", musiccast.AlarmModeOneDay, "the alarm to edit: oneday or a weekday like monday")
+	alarmTime := flags.String("time", "", "alarm time as `hh:mm`")
+	enable := flags.Bool("enable", true, "enable the alarm for -day")
+	beep := flags.Bool("beep", false, "beep in addition to the source")
+	input := flags.String("input", "", "resume this `input` on alarm")
+	presetType := flags.String("preset-type", "", "preset `type` to play on alarm")
+	preset := flags.Int("preset", 0, "preset `number` to play on alarm")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	delete(set, "timeout")
+
+	if flags.NArg() == 0 {
+		if len(set) > 0 {
+			flags.Usage()
+			return errUsage
+		}
+		return printAlarms(os.Stdout, discover(*timeout).Sorted())
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	speaker, err := findSpeaker(flags.Arg(0), *timeout)
+	if err != nil {
+		return err
+	}
+	if !speaker.SupportsClock() {
+		return fmt.Errorf("%s has no alarm clock", speaker.FriendlyName)
+	}
+	if len(set) == 0 {
+		return printAlarms(os.Stdout, []*musiccast.Speaker{speaker})
+	}
+
+	settings := musiccast.AlarmSettings{Mode: *mode}
+	if set["alarm"] {
+		on := *alarmOn == "on"
+		if !on && *alarmOn != "off" {
+			return fmt.Errorf("-alarm must be on or off, got %q", *alarmOn)
+		}
+		settings.AlarmOn = &on
+	}
+	if set["volume"] {
+		settings.Volume = volume
+	}
+	if set["fade"] {
+		settings.FadeInterval = fade
+	}
+	if set["fade-type"] {
+		settings.FadeType = fadeType
+	}
+	if set["repeat"] {
+		settings.Repeat = repeat
+	}
+
+	if set["day"] || set["time"] || set["enable"] || set["beep"] || set["input"] || set["preset-type"] || set["preset"] {
+		detail := musiccast.AlarmDetail{Day: *day}
+		// keep what's not given on the command line
+		if speaker.Clock != nil && speaker.Clock.Day(*day) != nil {
+			detail.AlarmDay = *speaker.Clock.Day(*day)
+		}
+		if set["enable"] {
+			detail.Enable = *enable
+		}
+		if set["time"] {
+			detail.Time, err = musiccast.ParseAlarmTime(*alarmTime)
+			if err != nil {
+				return err
+			}
+		}
+		if set["beep"] {
+			detail.Beep = *beep
+		}
+		if set["input"] && (set["preset-type"] || set["preset"]) {
+			return errors.New("-input and -preset are mutually exclusive")
+		}
+		if set["input"] {
+			detail.PlaybackType = musiccast.AlarmResume
+			detail.Resume.Input = *input
+		}
+		if set["preset-type"] || set["preset"] {
+			detail.PlaybackType = musiccast.AlarmPreset
+			if set["preset-type"] {
+				detail.Preset.Type = *presetType
+			}
+			if set["preset"] {
+				detail.Preset.Num = *preset
+			}
+		}
+		settings.Detail = &detail
+	}
+
+	err = musiccast.SetAlarmSettings(speaker, settings)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Updated alarm of %s\n", speaker.FriendlyName)
+	return nil
+}
+
+func printAlarms(out io.Writer, speakers []*musiccast.Speaker) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	found := false
+	for _, spkr := range speakers {
+		if !spkr.SupportsClock() {
+			continue
+		}
+		found = true
+		clock := spkr.Clock
+		if clock == nil {
+			fmt.Fprintf(w, "%s\tno alarm settings\n", spkr.FriendlyName)
+			continue
+		}
+		fmt.Fprintf(w, "%s\talarm %s\tmode %s\tvolume %d\tfade %ds\n", spkr.FriendlyName, onOff(clock.AlarmOn), clock.Mode, clock.Volume, clock.FadeInterval)
+		for _, day := range musiccast.AlarmDays {
+			alarm := clock.Day(day)
+			if alarm == nil {
+				continue
+			}
+			active := ""
+			if (day == musiccast.AlarmModeOneDay) == (clock.Mode == musiccast.AlarmModeOneDay) {
+				active = "*"
+			}
+			fmt.Fprintf(w, "  %s%s\t%s\t%s\t%s\n", day, active, onOff(alarm.Enable), alarm.FormattedTime(), alarm.Source())
+		}
+	}
+	if !found {
+		fmt.Fprintln(w, "No speakers with alarm clock found")
+	}
+	return w.Flush()
+}
+
+func clockCommand(args []string) error {
+	flags, timeout := newFlagSet("clock", "[flags] <speaker>")
+	autoSync := flags.Bool("auto-sync", true, "sync the clock automatically")
+	now := flags.Bool("now", false, "set the clock to the local time")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	speaker, err := findSpeaker(flags.Arg(0), *timeout)
+	if err != nil {
+		return err
+	}
+	if !speaker.SupportsClock() {
+		return fmt.Errorf("%s has no clock", speaker.FriendlyName)
+	}
+
+	changed := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name != "auto-sync" || err != nil {
+			return
+		}
+		changed = true
+		err = musiccast.SetAutoSync(speaker, *autoSync)
+	})
+	if err != nil {
+		return err
+	}
+	if *now {
+		changed = true
+		err = musiccast.SetDateAndTime(speaker, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	if !changed && speaker.Clock != nil {
+		fmt.Printf("%s: auto sync %s, format %s\n", speaker.FriendlyName, onOff(speaker.Clock.AutoSync), speaker.Clock.Format)
+	}
+	return nil
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
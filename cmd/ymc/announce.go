@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/atamanroman/ymc/internal/command"
+	"github.com/atamanroman/ymc/internal/media"
+	"github.com/atamanroman/ymc/musiccast"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func announceCommand(args []string) error {
+	flags, timeout := newFlagSet("announce", "-file <audio> [flags] [speaker...]\n\n"+
+		"Plays the file on the speakers, all if none are given, and restores what they did before.")
+	file := flags.String("file", "", "audio `file` to play, like an MP3")
+	volume := flags.Int("volume", -1, "`volume` during the announcement, -1 keeps the current volume")
+	maxDuration := flags.Duration("max-duration", 2*time.Minute, "restore the speakers after this long even if they still play")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		flags.Usage()
+		return errUsage
+	}
+	speakers := discover(*timeout)
+	targets := speakers.Sorted()
+	if flags.NArg() > 0 {
+		targets = make([]*musiccast.Speaker, 0)
+		for _, name := range flags.Args() {
+			spkr := speakers.Find(name)
+			if spkr == nil {
+				return fmt.Errorf("speaker %q not found", name)
+			}
+			targets = append(targets, spkr)
+		}
+	}
+	if len(targets) == 0 {
+		return errors.New("no speakers found")
+	}
+	for _, spkr := range targets {
+		if !spkr.SupportsUpnp(musiccast.AVTransport) {
+			return fmt.Errorf("%s can't play files, it has no DLNA renderer", spkr.FriendlyName)
+		}
+	}
+
+	info, err := os.Stat(*file)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", *file)
+	}
+	// fails for files which aren't audio
+	tracks, err := media.Scan(*file)
+	if err != nil {
+		return err
+	}
+	// the speakers share a network, the interface facing one faces all
+	files, err := serveMedia(targets[0])
+	if err != nil {
+		return err
+	}
+	defer files.Close()
+	track := tracks[0]
+	track.Title = "Announcement"
+	fileUrl := files.Add(track)
+
+	snapshot, err := musiccast.Snapshot(targets)
+	if err != nil {
+		// restore what could be saved
+		printSpeakerErrors(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	playing := make([]*musiccast.Speaker, 0)
+	for _, spkr := range targets {
+		err := announce(spkr, fileUrl, didlItem(track), *volume)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ymc: %s: %s\n", spkr.FriendlyName, err)
+			continue
+		}
+		playing = append(playing, spkr)
+	}
+	if len(playing) > 0 {
+		waitUntilStopped(ctx, playing, *maxDuration, nil)
+	}
+
+	if err = musiccast.Restore(snapshot, command.LimitVolume); err != nil {
+		printSpeakerErrors(err)
+		return errors.New("failed to restore some speakers")
+	}
+	if len(playing) < len(targets) {
+		return errors.New("announcement failed on some speakers")
+	}
+	return nil
+}
+
+// announce prepares the speaker and starts playing the file on its DLNA renderer
+func announce(speaker *musiccast.Speaker, fileUrl string, item musiccast.DidlItem, volume int) error {
+	var err error
+	if speaker.Power != musiccast.On {
+		if err = musiccast.SetPower(speaker, musiccast.On); err != nil {
+			return err
+		}
+	}
+	// link clients play what their server plays, servers take their clients along
+	dist, err := musiccast.GetDistributionInfo(speaker)
+	if err == nil && dist.Role == musiccast.RoleClient {
+		err = musiccast.Unlink(speaker, dist.Role)
+	}
+	if err != nil {
+		return err
+	}
+	if volume >= 0 {
+		if err = musiccast.SetVolumeTo(speaker, command.LimitVolume(speaker, volume)); err != nil {
+			return err
+		}
+	}
+	if speaker.Mute != nil && *speaker.Mute {
+		if err = musiccast.SetMute(speaker, false); err != nil {
+			return err
+		}
+	}
+	return musiccast.PlayUrl(speaker, fileUrl, musiccast.DidlLite(fileUrl, item))
+}
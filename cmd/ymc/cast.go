@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/atamanroman/ymc/internal/command"
+	"github.com/atamanroman/ymc/internal/media"
+	"github.com/atamanroman/ymc/musiccast"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func castCommand(args []string) error {
+	flags, timeout := newFlagSet("cast", "[flags] <speaker> <file-or-dir>\n\n"+
+		"Plays a local audio file or all audio files of a directory and its subdirectories on the\n"+
+		"speaker's DLNA renderer. The files are served from this machine until the speaker finished\n"+
+		"playing them or another source took over.")
+	volume := flags.Int("volume", -1, "`volume` to set before playing, -1 keeps the current volume")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errUsage
+	}
+
+	tracks, err := media.Scan(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	speaker, err := findSpeaker(flags.Arg(0), *timeout)
+	if err != nil {
+		return err
+	}
+	if !speaker.SupportsUpnp(musiccast.AVTransport) {
+		return fmt.Errorf("%s can't play files, it has no DLNA renderer", speaker.FriendlyName)
+	}
+	files, err := serveMedia(speaker)
+	if err != nil {
+		return err
+	}
+	defer files.Close()
+
+	if speaker.Power != musiccast.On {
+		if err = musiccast.SetPower(speaker, musiccast.On); err != nil {
+			return err
+		}
+	}
+	if *volume >= 0 {
+		if err = musiccast.SetVolumeTo(speaker, command.LimitVolume(speaker, *volume)); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for i, track := range tracks {
+		uri := files.Add(track)
+		if err = musiccast.PlayUrl(speaker, uri, musiccast.DidlLite(uri, didlItem(track))); err != nil {
+			return err
+		}
+		fmt.Printf("[%d/%d] %s\n", i+1, len(tracks), trackName(track))
+		waitUntilStopped(ctx, []*musiccast.Speaker{speaker}, 0, printPosition)
+		fmt.Println()
+		if ctx.Err() != nil {
+			// the file server stops with us, don't leave the speaker trying to load the rest
+			return musiccast.AVTransportStop(speaker)
+		}
+		if position, err := musiccast.GetPositionInfo(speaker); err == nil && position.TrackURI != "" && position.TrackURI != uri {
+			fmt.Printf("%s plays something else, stop casting\n", speaker.FriendlyName)
+			return nil
+		}
+	}
+	return nil
+}
+
+func trackName(track media.Track) string {
+	if track.Artist == "" {
+		return track.Title
+	}
+	return track.Artist + " - " + track.Title
+}
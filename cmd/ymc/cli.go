@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	cmd "github.com/atamanroman/ymc/internal/command"
+	"github.com/atamanroman/ymc/internal/config"
+	"github.com/atamanroman/ymc/internal/state"
+	"github.com/atamanroman/ymc/musiccast"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type cliCommand struct {
+	usage string
+	run   func(args []string) error
+}
+
+var cliCommands = map[string]cliCommand{
+	"alarm":    {"show and edit alarms of clock-capable speakers", alarmCommand},
+	"announce": {"play an audio file and restore what the speakers did before", announceCommand},
+	"cast":     {"play local audio files or directories on a speaker", castCommand},
+	"clock":    {"configure clock sync and set the time", clockCommand},
+	"rename":   {"rename a speaker or one of its inputs", renameCommand},
+	"firmware": {"check firmware versions or update a speaker", firmwareCommand},
+	"diag":     {"diagnose network and event problems of a speaker", diagCommand},
+	"fade":     {"fade the volume of a speaker", fadeCommand},
+	"power":    {"switch a speaker on or to standby, optionally fading", powerCommand},
+	"serve":    {"run a REST API to control the speakers", serveCommand},
+	"mqtt":     {"bridge the speakers to an MQTT broker", mqttCommand},
+	"play-url": {"play an HTTP stream or a local file on a speaker", playUrlCommand},
+	"scene":    {"save and apply scenes of several speakers", sceneCommand},
+	"schedule": {"preview and run the timed actions of the config file", scheduleCommand},
+}
+
+var errUsage = errors.New("invalid usage")
+
+// runCli runs the subcommand named by the first arg and returns the exit code
+func runCli(args []string) int {
+	command, ok := cliCommands[args[0]]
+	if !ok {
+		printUsage()
+		if args[0] == "help" {
+			return 0
+		}
+		return 2
+	}
+	if cfg, err := config.Load(); err != nil {
+		fmt.Fprintln(os.Stderr, "ymc:", err)
+	} else if err = cmd.SetLimits(cfg.VolumeLimits); err != nil {
+		fmt.Fprintln(os.Stderr, "ymc: invalid volume limit:", err)
+	}
+	err := command.run(args[1:])
+	if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ymc:", err)
+		return 1
+	}
+	return 0
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: ymc [-theme name] | ymc <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\nWithout command ymc starts the interactive UI.\n\nCommands:")
+	names := make([]string, 0, len(cliCommands))
+	for name := range cliCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, cliCommands[name].usage)
+	}
+}
+
+// newFlagSet creates the flags for a subcommand including the common -timeout
+func newFlagSet(name string, usage string) (*flag.FlagSet, *time.Duration) {
+	flags := newDaemonFlagSet(name, usage)
+	timeout := flags.Duration("timeout", 3*time.Second, "how long to search for speakers")
+	return flags, timeout
+}
+
+// newDaemonFlagSet creates the flags for a long-running subcommand, which keeps searching for speakers
+func newDaemonFlagSet(name string, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: ymc %s %s\n", name, usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// discover collects the speakers found within the timeout
+func discover(timeout time.Duration) *state.Store {
+	speakers := state.NewStore()
+	ch := musiccast.StartScan()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case update := <-ch:
+			speakers.Apply(update)
+		case <-deadline:
+			return speakers
+		}
+	}
+}
+
+// findSpeaker discovers speakers and returns the one whose ID or name matches
+func findSpeaker(name string, timeout time.Duration) (*musiccast.Speaker, error) {
+	speakers := discover(timeout)
+	if spkr := speakers.Find(name); spkr != nil {
+		return spkr, nil
+	}
+	names := make([]string, 0)
+	for _, spkr := range speakers.Sorted() {
+		names = append(names, spkr.FriendlyName)
+	}
+	return nil, fmt.Errorf("speaker %q not found, found: %s", name, strings.Join(names, ", "))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	cmd "github.com/atamanroman/ymc/internal/command"
+	"github.com/atamanroman/ymc/internal/tui"
+	"github.com/atamanroman/ymc/musiccast"
+)
+
+// execute translates a TUI command to the matching MusicCast API call
+func execute(speaker *musiccast.Speaker, command tui.SpeakerCommand) error {
+	switch command.Action {
+	case tui.PowerOn:
+		return musiccast.SetPower(speaker, musiccast.On)
+	case tui.PowerOff:
+		return musiccast.SetPower(speaker, musiccast.Standby)
+	case tui.VolumeUp:
+		// the command layer enforces the volume limits
+		step := command.Value.(int)
+		return cmd.Execute(speaker, "volume", cmd.Request{Step: &step})
+	case tui.VolumeDown:
+		step := -command.Value.(int)
+		return cmd.Execute(speaker, "volume", cmd.Request{Step: &step})
+	case tui.MuteToggle:
+		// speakers which aren't loaded yet have no mute state
+		return musiccast.SetMute(speaker, speaker.Mute == nil || !*speaker.Mute)
+	case tui.CdPlayPause:
+		if speaker.Cd != nil && speaker.Cd.Playback == musiccast.Play {
+			return musiccast.SetCdPlayback(speaker, musiccast.Pause)
+		}
+		return musiccast.SetCdPlayback(speaker, musiccast.Play)
+	case tui.CdStop:
+		return musiccast.SetCdPlayback(speaker, musiccast.Stop)
+	case tui.CdPrevious:
+		return musiccast.SetCdPlayback(speaker, musiccast.Previous)
+	case tui.CdNext:
+		return musiccast.SetCdPlayback(speaker, musiccast.Next)
+	case tui.CdToggleTray:
+		return musiccast.ToggleCdTray(speaker)
+	case tui.CdRepeat:
+		repeat := musiccast.RepeatOff
+		if speaker.Cd != nil {
+			repeat = speaker.Cd.Repeat
+		}
+		return musiccast.SetCdRepeat(speaker, repeat.Next())
+	case tui.CdShuffle:
+		if speaker.Cd != nil && speaker.Cd.Shuffle != musiccast.ShuffleOff {
+			return musiccast.SetCdShuffle(speaker, musiccast.ShuffleOff)
+		}
+		return musiccast.SetCdShuffle(speaker, musiccast.ShuffleOn)
+	case tui.SelectSoundProgram:
+		return musiccast.SetSoundProgram(speaker, command.Value.(string))
+	case tui.SelectSurroundDecoder:
+		return musiccast.SetSurroundDecoderType(speaker, command.Value.(string))
+	case tui.SoundToggle:
+		function := command.Value.(musiccast.SoundFunction)
+		enabled := speaker.Sound != nil && speaker.Sound.Enabled(function)
+		return musiccast.SetSoundToggle(speaker, function, !enabled)
+	case tui.ToneAdjust:
+		tone := command.Value.(tui.ToneValue)
+		return musiccast.SetToneLevel(speaker, tone.Level, tone.Value)
+	case tui.SelectEqualizerMode:
+		return musiccast.SetEqualizerMode(speaker, command.Value.(string))
+	case tui.SleepCycle:
+		sleep := 0
+		if speaker.Sleep != nil {
+			sleep = *speaker.Sleep
+		}
+		return musiccast.SetSleep(speaker, musiccast.NextSleep(sleep))
+	case tui.SleepTimer:
+		sleep := command.Value.(tui.SleepValue)
+		if sleep.Duration <= 0 {
+			musiccast.CancelSleepTimer(speaker.ID)
+			return nil
+		}
+		musiccast.StartSleepTimer(speaker, sleep.Duration, sleep.Fade)
+		return nil
+	case tui.SettingToggle:
+		function := command.Value.(musiccast.SystemFunction)
+		enabled := speaker.FuncStatus != nil && speaker.FuncStatus.Enabled(function)
+		return musiccast.SetSystemToggle(speaker, function, !enabled)
+	case tui.SettingAdjust:
+		setting := command.Value.(tui.SettingValue)
+		return musiccast.SetSystemLevel(speaker, setting.Function, setting.Value)
+	case tui.Rename:
+		rename := command.Value.(tui.RenameValue)
+		if rename.Id == "" {
+			return musiccast.RenameSpeaker(speaker, rename.Name)
+		}
+		return musiccast.SetNameText(speaker, rename.Id, rename.Name)
+	case tui.BluetoothStandbyToggle:
+		return musiccast.SetBluetoothStandby(speaker, speaker.Bluetooth == nil || !speaker.Bluetooth.BluetoothStandby)
+	case tui.BluetoothTransmitterToggle:
+		return musiccast.SetBluetoothTxSetting(speaker, speaker.Bluetooth == nil || !speaker.Bluetooth.BluetoothTxSetting)
+	case tui.BluetoothSearch:
+		return musiccast.SearchBluetoothDevices(speaker)
+	case tui.BluetoothConnect:
+		return musiccast.ConnectBluetoothDevice(speaker, command.Value.(string))
+	case tui.BluetoothDisconnect:
+		return musiccast.DisconnectBluetoothDevice(speaker)
+	case tui.AlarmSet:
+		return musiccast.SetAlarmSettings(speaker, command.Value.(musiccast.AlarmSettings))
+	}
+	return nil
+}
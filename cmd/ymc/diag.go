@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"github.com/atamanroman/ymc/musiccast"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func diagCommand(args []string) error {
+	flags, timeout := newFlagSet("diag", "[flags] <speaker>")
+	samples := flags.Int("samples", 5, "number of requests to measure the HTTP latency")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	speaker, err := findSpeaker(flags.Arg(0), *timeout)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintf(w, "Speaker\t%s (%s, %s)\n", speaker.FriendlyName, speaker.DeviceType, speaker.ID)
+	fmt.Fprintf(w, "Base URL\t%s\n", speaker.BaseUrl)
+	fmt.Fprintf(w, "Reachable\t%s\n", diagReachability(speaker))
+	fmt.Fprintf(w, "HTTP latency\t%s\n", diagLatency(speaker, *samples))
+
+	network, err := musiccast.GetNetworkStatus(speaker)
+	if err != nil {
+		fmt.Fprintf(w, "Network\terror: %s\n", err)
+	} else {
+		diagNetwork(w, network.NetworkStatus)
+	}
+
+	location, err := musiccast.GetLocationInfo(speaker)
+	if err != nil {
+		fmt.Fprintf(w, "Location\terror: %s\n", err)
+	} else {
+		fmt.Fprintf(w, "Location\t%s\n", location.Name)
+	}
+
+	// the subscription of this process, ymc serve or the UI have their own
+	fmt.Fprintf(w, "Events (this run)\t%s\n", diagEvents(musiccast.GetEventStats(speaker.ID)))
+	fmt.Fprintf(w, "DLNA renderer\t%s\n", diagUpnp(speaker))
+	return nil
+}
+
+// diagUpnp lists the renderer's description and the services ymc uses with how many actions they have
+func diagUpnp(speaker *musiccast.Speaker) string {
+	if speaker.DescriptionUrl == "" {
+		return "none"
+	}
+	services := []string{speaker.DescriptionUrl}
+	for _, service := range []string{musiccast.AVTransport, musiccast.RenderingControl} {
+		if !speaker.SupportsUpnp(service) {
+			services = append(services, service+" missing")
+			continue
+		}
+		actions, err := musiccast.GetUpnpActions(speaker, service)
+		if err != nil {
+			services = append(services, service+" error: "+err.Error())
+			continue
+		}
+		services = append(services, fmt.Sprintf("%s %d actions", service, len(actions)))
+	}
+	return strings.Join(services, ", ")
+}
+
+func diagReachability(speaker *musiccast.Speaker) string {
+	base, err := url.Parse(speaker.BaseUrl)
+	if err != nil {
+		return "invalid base URL: " + err.Error()
+	}
+	host := base.Host
+	if base.Port() == "" {
+		host = net.JoinHostPort(base.Hostname(), "80")
+	}
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", host, 2*time.Second)
+	if err != nil {
+		return "no: " + err.Error()
+	}
+	conn.Close()
+	return fmt.Sprintf("yes, TCP connect %s", time.Since(start).Round(time.Millisecond))
+}
+
+func diagLatency(speaker *musiccast.Speaker, samples int) string {
+	var min, max, total time.Duration
+	failed := 0
+	for i := 0; i < samples; i++ {
+		start := time.Now()
+		_, err := musiccast.GetDeviceInfo(speaker, 0)
+		elapsed := time.Since(start)
+		if err != nil {
+			failed++
+			continue
+		}
+		if min == 0 || elapsed < min {
+			min = elapsed
+		}
+		if elapsed > max {
+			max = elapsed
+		}
+		total += elapsed
+	}
+	if failed == samples {
+		return fmt.Sprintf("all %d requests failed", samples)
+	}
+	avg := total / time.Duration(samples-failed)
+	return fmt.Sprintf("min %s  avg %s  max %s  (%d requests, %d failed)",
+		min.Round(time.Millisecond), avg.Round(time.Millisecond), max.Round(time.Millisecond), samples, failed)
+}
+
+func diagNetwork(w *tabwriter.Writer, network musiccast.NetworkStatus) {
+	fmt.Fprintf(w, "Connection\t%s\n", network.Connection)
+	if network.IsWireless() {
+		fmt.Fprintf(w, "Wi-Fi\tSSID %s, channel %d, %s\n", network.WirelessLan.Ssid, network.WirelessLan.Ch, network.WirelessLan.Type)
+		fmt.Fprintf(w, "Signal\t%d%% %s\n", network.WirelessLan.Strength, network.SignalBars())
+	}
+	dhcp := "static"
+	if network.Dhcp {
+		dhcp = "DHCP"
+	}
+	fmt.Fprintf(w, "IP\t%s/%s (%s), gateway %s\n", network.IpAddress, network.SubnetMask, dhcp, network.DefaultGateway)
+	fmt.Fprintf(w, "MAC\t%s\n", network.MacAddressInUse())
+	if network.Vlan != nil {
+		fmt.Fprintf(w, "VLAN\t%s, id %d\n", onOff(network.Vlan.Enable), network.Vlan.Id)
+	}
+	mc := network.MusicCastNetwork
+	state := "not ready"
+	if mc.Ready {
+		state = "ready"
+	}
+	if mc.InitialJoinRunning {
+		state = "joining"
+	}
+	fmt.Fprintf(w, "MusicCast\t%s, %s, %d children, channel %d\n", state, mc.DeviceType, mc.ChildNum, mc.Ch)
+}
+
+func diagEvents(stats musiccast.EventStats) string {
+	if stats.Subscribed.IsZero() {
+		return "not subscribed"
+	}
+	status := fmt.Sprintf("subscribed %s ago", stats.SubscriptionAge().Round(time.Second))
+	if stats.Expired() {
+		status += " (expired)"
+	}
+	if stats.Count == 0 {
+		return status + ", no events yet (normal if nothing changed)"
+	}
+	return fmt.Sprintf("%s, %d events, last %s ago", status, stats.Count, time.Since(stats.LastEvent).Round(time.Second))
+}
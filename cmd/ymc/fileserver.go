@@ -0,0 +1,24 @@
+package main
+
+import (
+	"github.com/atamanroman/ymc/internal/media"
+	"github.com/atamanroman/ymc/musiccast"
+	"net/url"
+)
+
+// serveMedia starts a media server on the address of the interface which faces the speaker
+func serveMedia(speaker *musiccast.Speaker) (*media.Server, error) {
+	base, err := url.Parse(speaker.BaseUrl)
+	if err != nil {
+		return nil, err
+	}
+	address, err := media.LocalAddress(base.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	return media.NewServer(address)
+}
+
+func didlItem(track media.Track) musiccast.DidlItem {
+	return musiccast.DidlItem{Title: track.Title, Artist: track.Artist, Album: track.Album, MimeType: track.MimeType}
+}
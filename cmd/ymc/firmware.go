@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"github.com/atamanroman/ymc/musiccast"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+func firmwareCommand(args []string) error {
+	flags, timeout := newFlagSet("firmware", "check | update <speaker>")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	switch {
+	case flags.NArg() == 1 && flags.Arg(0) == "check":
+		return firmwareCheck(discover(*timeout).Sorted())
+	case flags.NArg() == 2 && flags.Arg(0) == "update":
+		speaker, err := findSpeaker(flags.Arg(1), *timeout)
+		if err != nil {
+			return err
+		}
+		err = musiccast.UpdateFirmware(speaker)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Started firmware update of %s, it takes a few minutes and the speaker restarts\n", speaker.FriendlyName)
+		return nil
+	}
+	flags.Usage()
+	return errUsage
+}
+
+// firmwareCheck prints the firmware versions of all speakers and whether an update is available
+func firmwareCheck(speakers []*musiccast.Speaker) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SPEAKER\tMODEL\tSYSTEM\tNETMODULE\tUPDATE")
+	for _, spkr := range speakers {
+		info, err := musiccast.GetDeviceInfo(spkr, 0)
+		if err != nil {
+			status := "error: " + err.Error()
+			if musiccast.IsUpdating(err) {
+				status = "updating"
+			}
+			fmt.Fprintf(w, "%s\t%s\t?\t?\t%s\n", spkr.FriendlyName, spkr.DeviceType, status)
+			continue
+		}
+
+		var update string
+		available, err := musiccast.IsNewFirmwareAvailable(spkr)
+		switch {
+		case err != nil:
+			update = "error: " + err.Error()
+		case available:
+			update = "available"
+		default:
+			update = "up to date"
+		}
+		if info.UpdateErrorCode != "" && info.UpdateErrorCode != "00000000" {
+			update += " (last error " + info.UpdateErrorCode + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", spkr.FriendlyName, info.ModelName,
+			strconv.FormatFloat(info.SystemVersion, 'f', -1, 64), info.NetmoduleVersion, update)
+	}
+	if len(speakers) == 0 {
+		fmt.Fprintln(w, "No speakers found")
+	}
+	return w.Flush()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/atamanroman/ymc/internal/bridge"
+	"github.com/atamanroman/ymc/internal/command"
+	"github.com/atamanroman/ymc/internal/state"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func mqttCommand(args []string) error {
+	flags := newDaemonFlagSet("mqtt", "[flags]\n\nDiscovers the speakers and bridges their state and commands to an MQTT broker until interrupted.")
+	broker := flags.String("broker", "tcp://localhost:1883", "broker `url`")
+	clientId := flags.String("client-id", "ymc", "MQTT client id")
+	username := flags.String("username", "", "broker user name")
+	password := flags.String("password", os.Getenv("YMC_MQTT_PASSWORD"), "broker password, defaults to $YMC_MQTT_PASSWORD")
+	prefix := flags.String("prefix", "ymc", "topic `prefix`")
+	discovery := flags.String("discovery-prefix", "homeassistant", "Home Assistant discovery `prefix`, empty to disable discovery")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 || *prefix == "" {
+		flags.Usage()
+		return errUsage
+	}
+
+	speakers := state.NewStore()
+	follow(speakers)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go command.Watchdog(ctx, speakers)
+
+	fmt.Fprintf(os.Stderr, "Bridging speakers to %s under %s/\n", *broker, *prefix)
+	return bridge.New(speakers, bridge.Options{
+		Broker:          *broker,
+		ClientId:        *clientId,
+		Username:        *username,
+		Password:        *password,
+		Prefix:          *prefix,
+		DiscoveryPrefix: *discovery,
+	}).Run(ctx)
+}
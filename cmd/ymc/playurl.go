@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/atamanroman/ymc/internal/command"
+	"github.com/atamanroman/ymc/internal/media"
+	"github.com/atamanroman/ymc/musiccast"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"time"
+)
+
+// how often to check whether the speakers still play
+const playbackPollInterval = 500 * time.Millisecond
+
+// give up on speakers which didn't start playing within this time
+const playbackStartTimeout = 15 * time.Second
+
+func playUrlCommand(args []string) error {
+	flags, timeout := newFlagSet("play-url", "[flags] <speaker> <url-or-file>\n\n"+
+		"Plays an HTTP stream or a local file on the speaker's DLNA renderer. Local files are served\n"+
+		"from this machine until the speaker finished playing them.")
+	volume := flags.Int("volume", -1, "`volume` to set before playing, -1 keeps the current volume")
+	title := flags.String("title", "", "title to show on the speaker, defaults to the file's tags or name")
+	wait := flags.Bool("wait", false, "show the position and wait until the speaker stops, always on for local files")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errUsage
+	}
+
+	speaker, err := findSpeaker(flags.Arg(0), *timeout)
+	if err != nil {
+		return err
+	}
+	if !speaker.SupportsUpnp(musiccast.AVTransport) {
+		return fmt.Errorf("%s can't play URLs, it has no DLNA renderer", speaker.FriendlyName)
+	}
+
+	target := flags.Arg(1)
+	uri := target
+	item := musiccast.DidlItem{Title: path.Base(target)}
+	if parsed, err := url.Parse(target); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		info, err := os.Stat(target)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return fmt.Errorf("%s is a directory, see ymc cast", target)
+		}
+		// fails for files which aren't audio
+		tracks, err := media.Scan(target)
+		if err != nil {
+			return err
+		}
+		files, err := serveMedia(speaker)
+		if err != nil {
+			return err
+		}
+		defer files.Close()
+		uri = files.Add(tracks[0])
+		item = didlItem(tracks[0])
+		*wait = true
+	}
+	if *title != "" {
+		item.Title = *title
+	}
+
+	if speaker.Power != musiccast.On {
+		if err = musiccast.SetPower(speaker, musiccast.On); err != nil {
+			return err
+		}
+	}
+	if *volume >= 0 {
+		if err = musiccast.SetVolumeTo(speaker, command.LimitVolume(speaker, *volume)); err != nil {
+			return err
+		}
+	}
+	if err = musiccast.PlayUrl(speaker, uri, musiccast.DidlLite(uri, item)); err != nil {
+		return err
+	}
+	fmt.Printf("Playing %s on %s\n", item.Title, speaker.FriendlyName)
+	if !*wait {
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	waitUntilStopped(ctx, []*musiccast.Speaker{speaker}, 0, printPosition)
+	fmt.Println()
+	if ctx.Err() != nil {
+		// the file server stops with us, don't leave the speaker trying to load the rest
+		return musiccast.AVTransportStop(speaker)
+	}
+	return nil
+}
+
+func printPosition(speaker *musiccast.Speaker) {
+	position, err := musiccast.GetPositionInfo(speaker)
+	if err != nil {
+		return
+	}
+	if position.Duration() > 0 {
+		fmt.Printf("\r%s / %s ", musiccast.FormatUpnpDuration(position.Position()), musiccast.FormatUpnpDuration(position.Duration()))
+	} else {
+		fmt.Printf("\r%s ", musiccast.FormatUpnpDuration(position.Position()))
+	}
+}
+
+// waitUntilStopped returns when all speakers stopped playing, after maxDuration unless it's 0, or on
+// interrupt. progress is called for every playing speaker while waiting, if not nil.
+func waitUntilStopped(ctx context.Context, speakers []*musiccast.Speaker, maxDuration time.Duration, progress func(speaker *musiccast.Speaker)) {
+	start := time.Now()
+	var deadline <-chan time.Time
+	if maxDuration > 0 {
+		deadline = time.After(maxDuration)
+	}
+	ticker := time.NewTicker(playbackPollInterval)
+	defer ticker.Stop()
+	// renderers report STOPPED until they have loaded the URL
+	started := make(map[string]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline:
+			return
+		case <-ticker.C:
+		}
+		done := true
+		for _, spkr := range speakers {
+			info, err := musiccast.GetTransportInfo(spkr)
+			if err != nil {
+				continue
+			}
+			switch info.CurrentTransportState {
+			case musiccast.TransportPlaying, musiccast.TransportTransitioning, musiccast.TransportPaused:
+				started[spkr.ID] = true
+				done = false
+				if progress != nil {
+					progress(spkr)
+				}
+			default:
+				done = done && (started[spkr.ID] || time.Since(start) > playbackStartTimeout)
+			}
+		}
+		if done {
+			return
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"github.com/atamanroman/ymc/internal/command"
+	"github.com/atamanroman/ymc/musiccast"
+	"strconv"
+	"time"
+)
+
+func powerCommand(args []string) error {
+	flags, timeout := newFlagSet("power", "[flags] <speaker> on|standby|toggle\n\n"+
+		"Switches the speaker on or to standby, with -fade the volume fades in from 0 or out before standby.")
+	fade := flags.Duration("fade", 0, "fade in or out over this `duration`")
+	volume := flags.Int("volume", -1, "`volume` to fade in to, -1 for the volume before standby")
+	curve := flags.String("curve", string(musiccast.FadeLinear), "fade `curve`, linear or log")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errUsage
+	}
+	fadeCurve, err := musiccast.ParseFadeCurve(*curve)
+	if err != nil {
+		return err
+	}
+	speaker, err := findSpeaker(flags.Arg(0), *timeout)
+	if err != nil {
+		return err
+	}
+
+	power := musiccast.Power(flags.Arg(1))
+	switch power {
+	case "toggle":
+		power = musiccast.On
+		if speaker.Power == musiccast.On {
+			power = musiccast.Standby
+		}
+	case musiccast.On, musiccast.Standby:
+	default:
+		flags.Usage()
+		return errUsage
+	}
+	return setPowerFaded(speaker, power, *volume, *fade, fadeCurve)
+}
+
+// setPowerFaded switches the power, fading the volume if fade > 0. Fading in respects the volume
+// limits, -1 is the volume before standby.
+func setPowerFaded(speaker *musiccast.Speaker, power musiccast.Power, volume int, fade time.Duration, curve musiccast.FadeCurve) error {
+	if volume < 0 && speaker.Volume != nil {
+		volume = int(*speaker.Volume)
+	}
+	if volume >= 0 {
+		volume = command.LimitVolume(speaker, volume)
+	}
+	switch {
+	case fade <= 0 && power == musiccast.On && speaker.Volume != nil && volume < int(*speaker.Volume):
+		if err := musiccast.SetPower(speaker, power); err != nil {
+			return err
+		}
+		return musiccast.SetVolumeTo(speaker, volume)
+	case fade <= 0:
+		return musiccast.SetPower(speaker, power)
+	case power == musiccast.On:
+		return musiccast.PowerOnFaded(speaker, volume, fade, curve)
+	default:
+		return musiccast.StandbyFaded(speaker, fade, curve)
+	}
+}
+
+func fadeCommand(args []string) error {
+	flags, timeout := newFlagSet("fade", "[flags] <speaker> <volume>\n\n"+
+		"Fades the volume of the speaker from the current one to the given one.")
+	duration := flags.Duration("duration", 10*time.Second, "how long the fade takes")
+	curve := flags.String("curve", string(musiccast.FadeLinear), "fade `curve`, linear or log")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errUsage
+	}
+	volume, err := strconv.Atoi(flags.Arg(1))
+	if err != nil || volume < 0 {
+		return fmt.Errorf("invalid volume %q", flags.Arg(1))
+	}
+	fadeCurve, err := musiccast.ParseFadeCurve(*curve)
+	if err != nil {
+		return err
+	}
+	speaker, err := findSpeaker(flags.Arg(0), *timeout)
+	if err != nil {
+		return err
+	}
+	return musiccast.FadeVolume(speaker, command.LimitVolume(speaker, volume), *duration, fadeCurve)
+}
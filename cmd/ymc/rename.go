@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"github.com/atamanroman/ymc/musiccast"
+	"strings"
+)
+
+func renameCommand(args []string) error {
+	flags, timeout := newFlagSet("rename", "[flags] <speaker> <name>")
+	input := flags.String("input", "", "rename this `input` (e.g. net_radio) instead of the speaker")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return errUsage
+	}
+	name := strings.Join(flags.Args()[1:], " ")
+
+	speaker, err := findSpeaker(flags.Arg(0), *timeout)
+	if err != nil {
+		return err
+	}
+	if *input == "" {
+		err = musiccast.RenameSpeaker(speaker, name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Renamed %s to %s\n", speaker.FriendlyName, name)
+		return nil
+	}
+	err = musiccast.SetNameText(speaker, *input, name)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Renamed input %s of %s to %s\n", *input, speaker.FriendlyName, name)
+	return nil
+}
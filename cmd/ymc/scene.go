@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/atamanroman/ymc/internal/command"
+	"github.com/atamanroman/ymc/internal/config"
+	"github.com/atamanroman/ymc/musiccast"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+func sceneCommand(args []string) error {
+	flags, timeout := newFlagSet("scene", "list | save <name> [speaker...] | apply <name> | delete <name>\n\n"+
+		"Scenes save power, input, preset, volume, mute and link groups of the speakers in the config file.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case flags.NArg() == 1 && flags.Arg(0) == "list":
+		return sceneList(cfg)
+	case flags.NArg() >= 2 && flags.Arg(0) == "save":
+		speakers := discover(*timeout)
+		selected := speakers.Sorted()
+		if flags.NArg() > 2 {
+			selected = make([]*musiccast.Speaker, 0)
+			for _, name := range flags.Args()[2:] {
+				spkr := speakers.Find(name)
+				if spkr == nil {
+					return fmt.Errorf("speaker %q not found", name)
+				}
+				selected = append(selected, spkr)
+			}
+		}
+		if len(selected) == 0 {
+			return errors.New("no speakers found")
+		}
+		scene, err := musiccast.CaptureScene(selected)
+		if err != nil {
+			// save what could be read, the scene can be fixed in the config file
+			printSpeakerErrors(err)
+		}
+		if cfg.Scenes == nil {
+			cfg.Scenes = make(map[string]musiccast.Scene)
+		}
+		cfg.Scenes[flags.Arg(1)] = scene
+		if err = cfg.Save(); err != nil {
+			return err
+		}
+		path, _ := config.Path()
+		fmt.Printf("Saved scene %s with %d speakers to %s\n", flags.Arg(1), len(scene.Speakers), path)
+		return nil
+	case flags.NArg() == 2 && flags.Arg(0) == "apply":
+		scene, ok := cfg.Scenes[flags.Arg(1)]
+		if !ok {
+			return fmt.Errorf("scene %q not found, saved scenes: %s", flags.Arg(1), strings.Join(cfg.SceneNames(), ", "))
+		}
+		err := musiccast.ApplyScene(scene, discover(*timeout).Sorted(), command.LimitVolume)
+		if err != nil {
+			printSpeakerErrors(err)
+			return fmt.Errorf("scene %s failed on some speakers", flags.Arg(1))
+		}
+		fmt.Printf("Applied scene %s\n", flags.Arg(1))
+		return nil
+	case flags.NArg() == 2 && flags.Arg(0) == "delete":
+		if _, ok := cfg.Scenes[flags.Arg(1)]; !ok {
+			return fmt.Errorf("scene %q not found", flags.Arg(1))
+		}
+		delete(cfg.Scenes, flags.Arg(1))
+		return cfg.Save()
+	}
+	flags.Usage()
+	return errUsage
+}
+
+func sceneList(cfg *config.Config) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SCENE\tSPEAKERS")
+	for _, name := range cfg.SceneNames() {
+		speakers := make([]string, 0)
+		for _, state := range cfg.Scenes[name].Speakers {
+			speakers = append(speakers, sceneStateString(state))
+		}
+		fmt.Fprintf(w, "%s\t%s\n", name, strings.Join(speakers, ", "))
+	}
+	if len(cfg.Scenes) == 0 {
+		fmt.Fprintln(w, "No scenes saved, see ymc scene -h")
+	}
+	return w.Flush()
+}
+
+// sceneStateString is a short description like "Kitchen on net_radio preset 3 30"
+func sceneStateString(state musiccast.SpeakerState) string {
+	parts := []string{state.Name, string(state.Power)}
+	if state.Power != musiccast.On {
+		return strings.Join(parts, " ")
+	}
+	switch {
+	case state.LinkServer != "":
+		parts = append(parts, "linked")
+	case state.Preset > 0:
+		parts = append(parts, fmt.Sprintf("%s preset %d", state.Input, state.Preset))
+	case state.Input != "":
+		parts = append(parts, state.Input)
+	}
+	if state.Mute != nil && *state.Mute {
+		parts = append(parts, "muted")
+	} else if state.Volume != nil {
+		parts = append(parts, fmt.Sprint(*state.Volume))
+	}
+	return strings.Join(parts, " ")
+}
+
+// printSpeakerErrors prints one line per speaker for musiccast.SpeakerErrors
+func printSpeakerErrors(err error) {
+	var speakerErrors musiccast.SpeakerErrors
+	if !errors.As(err, &speakerErrors) {
+		fmt.Fprintln(os.Stderr, "ymc:", err)
+		return
+	}
+	names := make([]string, 0, len(speakerErrors))
+	for name := range speakerErrors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "ymc: %s: %s\n", name, strings.ReplaceAll(speakerErrors[name].Error(), "\n", ", "))
+	}
+}
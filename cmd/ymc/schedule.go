@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/atamanroman/ymc/internal/command"
+	"github.com/atamanroman/ymc/internal/config"
+	"github.com/atamanroman/ymc/internal/schedule"
+	"github.com/atamanroman/ymc/internal/state"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+const scheduleStateFile = "schedule-state.json"
+
+func scheduleCommand(args []string) error {
+	flags := newDaemonFlagSet("schedule", "list [-n count] | run\n\n"+
+		"list shows the schedules of the config file and when they run next without running them.\n"+
+		"run discovers the speakers and runs the schedules until interrupted, like ymc serve -schedules.")
+	count := flags.Int("n", 3, "how many upcoming runs list shows per schedule")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case flags.NArg() == 1 && flags.Arg(0) == "list":
+		return scheduleList(cfg.Schedules, *count)
+	case flags.NArg() == 1 && flags.Arg(0) == "run":
+		if len(cfg.Schedules) == 0 {
+			path, _ := config.Path()
+			return fmt.Errorf("no schedules in %s", path)
+		}
+		speakers := state.NewStore()
+		follow(speakers)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		scheduler, err := newScheduler(cfg.Schedules, speakers)
+		if err != nil {
+			return err
+		}
+		go command.Watchdog(ctx, speakers)
+		fmt.Fprintf(os.Stderr, "Running %d schedules\n", len(cfg.Schedules))
+		scheduler.Run(ctx)
+		return nil
+	}
+	flags.Usage()
+	return errUsage
+}
+
+func scheduleList(schedules []schedule.Schedule, count int) error {
+	if len(schedules) == 0 {
+		path, _ := config.Path()
+		fmt.Printf("No schedules in %s\n", path)
+		return nil
+	}
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "NAME\tWHEN\tSPEAKERS\tACTIONS\tNEXT")
+	var invalid error
+	now := time.Now()
+	for _, s := range schedules {
+		if err := s.Validate(); err != nil {
+			invalid = errors.Join(invalid, err)
+			continue
+		}
+		upcoming, _ := schedule.Upcoming(s, now, count)
+		next := make([]string, 0, len(upcoming))
+		for _, t := range upcoming {
+			next = append(next, t.Format("Mon 2006-01-02 15:04"))
+		}
+		if len(next) == 0 {
+			next = append(next, "never")
+		}
+		when := s.When
+		if s.Jitter > 0 {
+			when += " +" + time.Duration(s.Jitter).String()
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\n", s.Name, when, s.SpeakerNames(), s.Describe(), strings.Join(next, ", "))
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	return invalid
+}
+
+// newScheduler prepares the schedules, which log their results to stderr
+func newScheduler(schedules []schedule.Schedule, speakers *state.Store) (*schedule.Scheduler, error) {
+	statePath, err := config.StatePath(scheduleStateFile)
+	if err != nil {
+		return nil, err
+	}
+	scheduler, err := schedule.New(schedules, speakers, statePath)
+	if err != nil {
+		return nil, err
+	}
+	scheduler.Report = printScheduleResult
+	return scheduler, nil
+}
+
+func printScheduleResult(result schedule.Result) {
+	prefix := fmt.Sprintf("%s schedule %s (%s)", time.Now().Format("2006-01-02 15:04:05"), result.Schedule.Name, result.Planned.Format("15:04"))
+	switch {
+	case result.Skipped:
+		fmt.Fprintf(os.Stderr, "%s: missed, skipped\n", prefix)
+		log.Info("Skipped missed schedule", result.Schedule.Name, result.Planned)
+	case result.Err != nil:
+		fmt.Fprintf(os.Stderr, "%s: failed: %s\n", prefix, result.Err)
+		log.Warn("Schedule failed", result.Schedule.Name, result.Err)
+	default:
+		fmt.Fprintf(os.Stderr, "%s: %s on %s\n", prefix, result.Schedule.Describe(), result.Schedule.SpeakerNames())
+		log.Info("Schedule ran", result.Schedule.Name)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/atamanroman/ymc/internal/command"
+	"github.com/atamanroman/ymc/internal/config"
+	"github.com/atamanroman/ymc/internal/server"
+	"github.com/atamanroman/ymc/internal/state"
+	"github.com/atamanroman/ymc/musiccast"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func serveCommand(args []string) error {
+	flags := newDaemonFlagSet("serve", "[flags]\n\nDiscovers the speakers, follows their events and serves the REST API until interrupted.")
+	listen := flags.String("listen", "127.0.0.1:8080", "`address` to listen on")
+	metrics := flags.Bool("metrics", false, "also serve Prometheus metrics on /metrics")
+	schedules := flags.Bool("schedules", false, "also run the schedules of the config file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return errUsage
+	}
+
+	speakers := state.NewStore()
+	follow(speakers)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *schedules {
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		scheduler, err := newScheduler(cfg.Schedules, speakers)
+		if err != nil {
+			return err
+		}
+		go scheduler.Run(ctx)
+	}
+
+	go command.Watchdog(ctx, speakers)
+
+	api := server.New(speakers)
+	if *metrics {
+		api.Handle("/metrics", server.Metrics(speakers))
+	}
+	httpServer := &http.Server{Addr: *listen, Handler: api}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdown)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving the REST API on http://%s/speakers\n", *listen)
+	err := httpServer.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// follow keeps the store in sync with the discovered speakers and their events
+func follow(speakers *state.Store) {
+	ch := musiccast.StartScan()
+	go func() {
+		for update := range ch {
+			speakers.Apply(update)
+		}
+	}()
+}
@@ -1,46 +1,114 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	cmd "github.com/atamanroman/ymc/internal/command"
+	"github.com/atamanroman/ymc/internal/config"
 	"github.com/atamanroman/ymc/internal/logging"
+	"github.com/atamanroman/ymc/internal/state"
 	"github.com/atamanroman/ymc/internal/tui"
 	"github.com/atamanroman/ymc/musiccast"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"strings"
 	"time"
 )
 
 var log = logging.Instance
-var Speakers = make(map[string]*musiccast.Speaker)
+var Speakers = state.NewStore()
+
+// the target of the UI's scene commands in the status bar
+const allSpeakers = "All speakers"
+
+var errStandby = errors.New("in standby, turn it on first")
+var errUpdating = errors.New("updating firmware")
 
 func main() {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		code := runCli(os.Args[1:])
+		logging.Close()
+		os.Exit(code)
+	}
+
+	flags := flag.NewFlagSet("ymc", flag.ContinueOnError)
+	theme := flags.String("theme", "", "UI `theme`, one of "+strings.Join(tui.ThemeNames(), ", "))
+	flags.Usage = func() {
+		printUsage()
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		os.Exit(2)
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if _, ok := tui.Themes[*theme]; *theme != "" && !ok {
+		fmt.Fprintf(os.Stderr, "ymc: unknown theme %q, expected one of %s\n", *theme, strings.Join(tui.ThemeNames(), ", "))
+		os.Exit(2)
+	}
+
 	defer logging.Close()
 	defer musiccast.Close()
+	runTui(*theme)
+}
+
+// runTui starts the interactive UI, the theme overrides the one of the config file
+func runTui(theme string) {
+	// the log view shows what stderr can't while the UI owns the terminal
+	logging.SetOutput(tui.LogWriter())
+	logging.SetLevel(zapcore.InfoLevel)
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Warn("Failed to load config:", err)
+		cfg = &config.Config{}
+	}
+	if theme == "" {
+		theme = cfg.Theme
+	}
+	if theme == "" && os.Getenv("NO_COLOR") != "" {
+		theme = "monochrome"
+	}
+	if err = tui.SetTheme(theme); err != nil {
+		log.Warn("Invalid theme:", err)
+	}
+	tui.SetScenes(cfg.SceneNames())
+	if err = tui.SetKeymap(cfg.Keymap, cfg.Keys); err != nil {
+		log.Warn("Invalid keymap:", err)
+	}
+	if err = cmd.SetLimits(cfg.VolumeLimits); err != nil {
+		log.Warn("Invalid volume limit:", err)
+	}
+	powerFade := time.Duration(cfg.PowerFade)
+	fadeCurve, err := musiccast.ParseFadeCurve(string(cfg.FadeCurve))
+	if err != nil {
+		log.Warn("Invalid config:", err)
+		fadeCurve = musiccast.FadeLinear
+	}
+
+	go cmd.Watchdog(context.Background(), Speakers)
+
 	ch := musiccast.StartScan()
 
 	go func() {
 		for {
 			select {
 			case update := <-ch:
-				if Speakers[update.ID] == nil {
-					if update.PartialUpdate {
-						log.Debug("Ignore event for unknown MusicCast speaker")
-						continue
-					}
-					log.Info("Found new MusicCast speaker", update)
-					Speakers[update.ID] = update
-				} else {
-					log.Debug("Got MusicCast speaker update", update)
-					if update.PartialUpdate {
-						update.UpdateValues(Speakers[update.ID])
-					} else {
-						// full update
-						Speakers[update.ID] = update
-					}
-				}
+				Speakers.Apply(update)
 			default:
 				log.Debug("Nothing found - sleep")
 				time.Sleep(500 * time.Millisecond)
 			}
 
-			tui.UpdateUi(Speakers)
+			tui.UpdateUi(Speakers.Snapshot())
 		}
 	}()
 
@@ -48,50 +116,79 @@ func main() {
 		for {
 			select {
 			case command := <-tui.CommandChan:
-				speaker := Speakers[command.Id]
+				if command.Action == tui.SceneApply {
+					// scenes take a while with several speakers, keep the other commands going
+					go func(command tui.SpeakerCommand) {
+						tui.CommandPending(command, allSpeakers)
+						tui.CommandDone(command, allSpeakers, applyScene(command.Value.(string)))
+					}(command)
+					continue
+				}
+				speaker := Speakers.Get(command.Id)
+				if speaker == nil {
+					continue
+				}
+
+				// speakers reject all commands while updating their firmware
+				if speaker.IsUpdating() {
+					tui.CommandDone(command, speaker.FriendlyName, errUpdating)
+					continue
+				}
 
 				// don't control standby speakers except power them on
 				if speaker.Power == musiccast.Standby && command.Action != tui.PowerOn {
+					tui.CommandDone(command, speaker.FriendlyName, errStandby)
 					continue
 				}
 
-				switch command.Action {
-				case tui.PowerOn:
-					err := musiccast.SetPower(speaker, musiccast.On)
-					if err != nil {
-						// TODO
-						continue
-					}
-				case tui.PowerOff:
-					err := musiccast.SetPower(speaker, musiccast.Standby)
-					if err != nil {
-						// TODO
-						continue
-					}
-				case tui.VolumeUp:
-					err := musiccast.SetVolume(speaker, musiccast.Up, command.Value.(int))
-					if err != nil {
-						// TODO
-						continue
-					}
-				case tui.VolumeDown:
-					err := musiccast.SetVolume(speaker, musiccast.Down, command.Value.(int))
-					if err != nil {
-						// TODO
-						continue
-					}
-				case tui.MuteToggle:
-					err := musiccast.SetMute(speaker, !*speaker.Mute)
-					if err != nil {
-						// TODO
-						continue
+				tui.CommandPending(command, speaker.FriendlyName)
+				if powerFade > 0 && (command.Action == tui.PowerOn || command.Action == tui.PowerOff) {
+					power := musiccast.On
+					if command.Action == tui.PowerOff {
+						power = musiccast.Standby
 					}
+					// fades take a while, keep the other commands going
+					go func(speaker *musiccast.Speaker, command tui.SpeakerCommand) {
+						err := setPowerFaded(speaker, power, -1, powerFade, fadeCurve)
+						if err != nil {
+							log.Warn("Power fade failed:", speaker.FriendlyName, err)
+						}
+						tui.CommandDone(command, speaker.FriendlyName, err)
+					}(speaker, command)
+					continue
+				}
+
+				err := execute(speaker, command)
+				if err != nil {
+					log.Warn("Command failed:", speaker.FriendlyName, command.Action, err)
 				}
+				tui.CommandDone(command, speaker.FriendlyName, err)
 			}
 		}
 	}()
 
-	if err := tui.App.Run(); err != nil {
+	err = tui.Run()
+	// the terminal is back, the log view isn't visible anymore
+	logging.SetOutput(os.Stderr)
+	if err != nil {
 		panic(err)
 	}
 }
+
+// applyScene applies the scene from the config file, which may have changed since the start
+func applyScene(name string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Warn("Failed to load config:", err)
+		return err
+	}
+	scene, ok := cfg.Scenes[name]
+	if !ok {
+		log.Warn("Scene not found:", name)
+		return fmt.Errorf("scene %q not found", name)
+	}
+	if err = musiccast.ApplyScene(scene, Speakers.Sorted(), cmd.LimitVolume); err != nil {
+		log.Warn("Scene failed:", name, err)
+	}
+	return err
+}
@@ -0,0 +1,295 @@
+// Package bridge connects the speakers to an MQTT broker. Topics, with the default prefix ymc:
+//
+//	ymc/status                    online or offline (last will), retained
+//	ymc/{id}/availability         online or offline, retained
+//	ymc/{id}/state                state.Summary as JSON, retained
+//	ymc/{id}/{command}            current value of power, volume, mute, input and playback, retained
+//	ymc/{id}/{command}/set        commands, see command.ParseText for the payloads
+//
+// Home Assistant discovery configs are published to {discovery prefix}/{component}/ymc_{id}/{entity}/config,
+// a switch for power and mute, a number for volume and a select for input.
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/atamanroman/ymc/internal/command"
+	"github.com/atamanroman/ymc/internal/logging"
+	"github.com/atamanroman/ymc/internal/state"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var log = logging.Instance
+
+const (
+	online  = "online"
+	offline = "offline"
+	// at least once, commands and state are idempotent
+	qos = 1
+)
+
+type Options struct {
+	// Broker is the URL of the broker like tcp://localhost:1883
+	Broker   string
+	ClientId string
+	Username string
+	Password string
+	// Prefix is the first level of all topics
+	Prefix string
+	// DiscoveryPrefix is Home Assistant's discovery prefix, empty disables discovery
+	DiscoveryPrefix string
+}
+
+type Bridge struct {
+	options Options
+	store   *state.Store
+	client  paho.Client
+
+	// topic ids by speaker id and back, speaker ids may contain characters which are not allowed in topics
+	lock       sync.Mutex
+	topicIds   map[string]string
+	speakerIds map[string]string
+}
+
+func New(store *state.Store, options Options) *Bridge {
+	return &Bridge{options: options, store: store, topicIds: make(map[string]string), speakerIds: make(map[string]string)}
+}
+
+// Run connects to the broker and publishes the changes of the store until the context is done
+func (b *Bridge) Run(ctx context.Context) error {
+	statusTopic := b.options.Prefix + "/status"
+	clientOptions := paho.NewClientOptions().
+		AddBroker(b.options.Broker).
+		SetClientID(b.options.ClientId).
+		SetUsername(b.options.Username).
+		SetPassword(b.options.Password).
+		SetWill(statusTopic, offline, qos, true).
+		SetAutoReconnect(true).
+		// commands call the speakers, don't let a slow one block the others
+		SetOrderMatters(false).
+		SetOnConnectHandler(func(client paho.Client) {
+			// also after reconnects, the broker forgets subscriptions of clean sessions
+			log.Info("Connected to MQTT broker", b.options.Broker)
+			client.Publish(statusTopic, qos, true, online)
+			client.Subscribe(b.options.Prefix+"/+/+/set", qos, b.handleCommand)
+		})
+	b.client = paho.NewClient(clientOptions)
+	if err := wait(b.client.Connect()); err != nil {
+		return fmt.Errorf("connect to MQTT broker %s: %w", b.options.Broker, err)
+	}
+
+	var changes <-chan state.Change
+	cancel := func() {}
+	defer func() { cancel() }()
+	for {
+		if changes == nil {
+			// at the start or after being dropped for being too slow: publish the current state
+			var backlog []state.Change
+			backlog, changes, cancel = b.store.Subscribe(0)
+			for _, change := range backlog {
+				b.publishChange(change)
+			}
+		}
+		select {
+		case change, ok := <-changes:
+			if !ok {
+				changes = nil
+				continue
+			}
+			b.publishChange(change)
+		case <-ctx.Done():
+			_ = wait(b.client.Publish(statusTopic, qos, true, offline))
+			b.client.Disconnect(1000)
+			return nil
+		}
+	}
+}
+
+func (b *Bridge) publishChange(change state.Change) {
+	topic := b.options.Prefix + "/" + b.topicId(change.Speaker)
+	if change.Type == state.Removed {
+		b.publish(topic+"/availability", offline)
+		return
+	}
+	speaker := b.store.Get(change.Speaker)
+	if speaker == nil {
+		return
+	}
+	summary := state.Summarize(speaker)
+	if change.Type == state.Added && b.options.DiscoveryPrefix != "" {
+		b.publishDiscovery(summary)
+	}
+
+	payload, err := json.Marshal(summary)
+	if err != nil {
+		log.Warn("Failed to marshal speaker state:", err)
+		return
+	}
+	b.publish(topic+"/state", string(payload))
+	b.publish(topic+"/availability", online)
+	for name, value := range values(summary) {
+		b.publish(topic+"/"+name, value)
+	}
+}
+
+// values are the plain text values of the command topics
+func values(summary state.Summary) map[string]string {
+	values := map[string]string{
+		"power":    string(summary.Power),
+		"input":    summary.Input,
+		"playback": string(summary.Playback),
+	}
+	if summary.Volume != nil {
+		values["volume"] = strconv.Itoa(*summary.Volume)
+	}
+	if summary.Mute != nil {
+		values["mute"] = strconv.FormatBool(*summary.Mute)
+	}
+	return values
+}
+
+func (b *Bridge) publishDiscovery(summary state.Summary) {
+	topicId := b.topicId(summary.Id)
+	for _, entity := range discoveryConfigs(b.options.Prefix, topicId, summary) {
+		payload, err := json.Marshal(entity.config)
+		if err != nil {
+			log.Warn("Failed to marshal discovery config:", err)
+			continue
+		}
+		b.publish(fmt.Sprintf("%s/%s/ymc_%s/%s/config", b.options.DiscoveryPrefix, entity.component, topicId, entity.name), string(payload))
+	}
+}
+
+// discoveryEntity is the config of one Home Assistant MQTT entity
+type discoveryEntity struct {
+	component string
+	name      string
+	config    map[string]any
+}
+
+// discoveryConfigs describe the speaker as Home Assistant entities of one device. Home Assistant has no
+// MQTT media player, so each command is an entity of its own.
+func discoveryConfigs(prefix string, topicId string, summary state.Summary) []discoveryEntity {
+	topic := prefix + "/" + topicId
+	entity := func(component string, name string, title string, config map[string]any) discoveryEntity {
+		config["name"] = title
+		config["unique_id"] = "ymc_" + topicId + "_" + name
+		config["device"] = map[string]any{
+			"identifiers":  []string{"ymc_" + topicId},
+			"name":         summary.Name,
+			"model":        summary.Model,
+			"manufacturer": "Yamaha",
+		}
+		config["availability"] = []map[string]string{
+			{"topic": prefix + "/status"},
+			{"topic": topic + "/availability"},
+		}
+		config["availability_mode"] = "all"
+		config["state_topic"] = topic + "/" + name
+		config["command_topic"] = topic + "/" + name + "/set"
+		return discoveryEntity{component, name, config}
+	}
+	entities := []discoveryEntity{
+		entity("switch", "power", "Power", map[string]any{
+			"payload_on":            "on",
+			"payload_off":           "standby",
+			"state_on":              "on",
+			"state_off":             "standby",
+			"json_attributes_topic": topic + "/state",
+		}),
+		entity("number", "volume", "Volume", map[string]any{
+			"min":  0,
+			"max":  summary.MaxVolume,
+			"step": 1,
+			"mode": "slider",
+		}),
+		entity("switch", "mute", "Mute", map[string]any{
+			"payload_on":  "true",
+			"payload_off": "false",
+			"state_on":    "true",
+			"state_off":   "false",
+		}),
+	}
+	if len(summary.Inputs) > 0 {
+		entities = append(entities, entity("select", "input", "Input", map[string]any{
+			"options": summary.Inputs,
+		}))
+	}
+	return entities
+}
+
+func (b *Bridge) publish(topic string, payload string) {
+	token := b.client.Publish(topic, qos, true, payload)
+	go func() {
+		if err := wait(token); err != nil {
+			log.Warn("Failed to publish", topic, err)
+		}
+	}()
+}
+
+// handleCommand runs commands published to {prefix}/{id}/{command}/set
+func (b *Bridge) handleCommand(_ paho.Client, message paho.Message) {
+	levels := strings.Split(strings.TrimPrefix(message.Topic(), b.options.Prefix+"/"), "/")
+	if len(levels) != 3 {
+		return
+	}
+	if message.Retained() {
+		// retained commands would run again on every reconnect
+		log.Warn("Ignore retained MQTT command", message.Topic())
+		return
+	}
+	name := levels[1]
+	speaker := b.store.Get(b.speakerId(levels[0]))
+	if speaker == nil {
+		log.Warn("Ignore MQTT command for unknown speaker", message.Topic())
+		return
+	}
+	if speaker.IsUpdating() {
+		log.Warn("Ignore MQTT command while updating firmware", speaker.FriendlyName)
+		return
+	}
+	request, err := command.ParseText(name, string(message.Payload()))
+	if err == nil {
+		err = command.Execute(speaker, name, request)
+	}
+	if err != nil {
+		log.Warn("MQTT command failed:", message.Topic(), err)
+	}
+}
+
+var notInTopic = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+func (b *Bridge) topicId(speakerId string) string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if topicId, ok := b.topicIds[speakerId]; ok {
+		return topicId
+	}
+	topicId := notInTopic.ReplaceAllString(speakerId, "_")
+	b.topicIds[speakerId] = topicId
+	b.speakerIds[topicId] = speakerId
+	return topicId
+}
+
+func (b *Bridge) speakerId(topicId string) string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if speakerId, ok := b.speakerIds[topicId]; ok {
+		return speakerId
+	}
+	return topicId
+}
+
+// wait waits for the token a few seconds, paho only reports errors on the token
+func wait(token paho.Token) error {
+	if !token.WaitTimeout(10 * time.Second) {
+		return fmt.Errorf("timeout")
+	}
+	return token.Error()
+}
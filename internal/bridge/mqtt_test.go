@@ -0,0 +1,94 @@
+package bridge
+
+import (
+	"github.com/atamanroman/ymc/internal/state"
+	"github.com/atamanroman/ymc/internal/testhelper"
+	"github.com/atamanroman/ymc/musiccast"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type message struct {
+	topic    string
+	payload  string
+	retained bool
+}
+
+func (m message) Duplicate() bool   { return false }
+func (m message) Qos() byte         { return qos }
+func (m message) Retained() bool    { return m.retained }
+func (m message) Topic() string     { return m.topic }
+func (m message) MessageID() uint16 { return 1 }
+func (m message) Payload() []byte   { return []byte(m.payload) }
+func (m message) Ack()              {}
+
+func TestHandleCommand(t *testing.T) {
+	requests := make([]string, 0)
+	speaker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RequestURI())
+		_, _ = w.Write([]byte(`{"response_code":0}`))
+	}))
+	defer speaker.Close()
+
+	store := state.NewStore()
+	store.Apply(&musiccast.Speaker{ID: "uuid:1", BaseUrl: speaker.URL + "/", MaxVolume: 60})
+	bridge := New(store, Options{Prefix: "ymc"})
+	topicId := bridge.topicId("uuid:1")
+	assert.Equal(t, "uuid_1", topicId)
+
+	bridge.handleCommand(nil, message{topic: "ymc/uuid_1/volume/set", payload: "+5"})
+	bridge.handleCommand(nil, message{topic: "ymc/uuid_1/power/set", payload: "on"})
+	// ignored
+	bridge.handleCommand(nil, message{topic: "ymc/uuid_1/power/set", payload: "on", retained: true})
+	bridge.handleCommand(nil, message{topic: "ymc/uuid_2/power/set", payload: "on"})
+	bridge.handleCommand(nil, message{topic: "ymc/uuid_1/volume/set", payload: "loud"})
+	assert.Equal(t, []string{
+		"/YamahaExtendedControl/v1/main/setVolume?volume=up&step=5",
+		"/YamahaExtendedControl/v1/main/setPower?power=on",
+	}, requests)
+}
+
+func TestValues(t *testing.T) {
+	summary := state.Summary{Power: musiccast.On, Volume: testhelper.Ptr(30), Input: "cd", Playback: musiccast.Play}
+	assert.Equal(t, map[string]string{"power": "on", "volume": "30", "input": "cd", "playback": "play"}, values(summary))
+
+	summary.Mute = testhelper.Ptr(false)
+	assert.Equal(t, "false", values(summary)["mute"])
+}
+
+// the options of Home Assistant's MQTT switch, number and select integrations which ymc uses
+var discoverySchema = map[string][]string{
+	"switch": {"availability", "availability_mode", "command_topic", "device", "json_attributes_topic", "name",
+		"payload_off", "payload_on", "state_off", "state_on", "state_topic", "unique_id"},
+	"number": {"availability", "availability_mode", "command_topic", "device", "json_attributes_topic", "max", "min",
+		"mode", "name", "state_topic", "step", "unique_id"},
+	"select": {"availability", "availability_mode", "command_topic", "device", "json_attributes_topic", "name",
+		"options", "state_topic", "unique_id"},
+}
+
+func TestDiscoveryConfigs(t *testing.T) {
+	summary := state.Summary{Id: "1", Name: "Kitchen", Model: "WX-021", MaxVolume: 60, Inputs: []string{"net_radio", "cd"}}
+	entities := discoveryConfigs("ymc", "1", summary)
+	assert.Len(t, entities, 4)
+	configs := make(map[string]map[string]any)
+	for _, entity := range entities {
+		for key := range entity.config {
+			assert.Contains(t, discoverySchema[entity.component], key, "%s %s", entity.component, entity.name)
+		}
+		configs[entity.name] = entity.config
+	}
+
+	assert.Equal(t, "ymc_1_power", configs["power"]["unique_id"])
+	assert.Equal(t, "ymc/1/power/set", configs["power"]["command_topic"])
+	assert.Equal(t, "standby", configs["power"]["payload_off"])
+	assert.Equal(t, "ymc/1/volume", configs["volume"]["state_topic"])
+	assert.Equal(t, 60, configs["volume"]["max"])
+	assert.Equal(t, "true", configs["mute"]["payload_on"])
+	assert.Equal(t, []string{"net_radio", "cd"}, configs["input"]["options"])
+	assert.Equal(t, "Kitchen", configs["input"]["device"].(map[string]any)["name"])
+
+	summary.Inputs = nil
+	assert.Len(t, discoveryConfigs("ymc", "1", summary), 3)
+}
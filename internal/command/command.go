@@ -0,0 +1,160 @@
+// Package command runs the speaker commands the gateways (REST, MQTT) have in common
+package command
+
+import (
+	"errors"
+	"fmt"
+	"github.com/atamanroman/ymc/musiccast"
+	"strconv"
+	"strings"
+)
+
+// Names lists the commands in display order
+var Names = []string{"power", "volume", "mute", "input", "playback"}
+
+// ErrUnknown is returned for command names which are not in Names
+var ErrUnknown = errors.New("unknown command")
+
+// InvalidError marks errors caused by the request rather than the speaker
+type InvalidError struct {
+	error
+}
+
+func (e InvalidError) Unwrap() error {
+	return e.error
+}
+
+// Request is the union of all command payloads, every command reads its own field
+type Request struct {
+	Power    musiccast.Power    `json:"power"`
+	Volume   *int               `json:"volume"`
+	Step     *int               `json:"step"`
+	Mute     *bool              `json:"mute"`
+	Input    string             `json:"input"`
+	Playback musiccast.Playback `json:"playback"`
+}
+
+// PowerToggle switches on speakers in standby and vice versa
+const PowerToggle = "toggle"
+
+// IsKnown checks if the name is one of Names
+func IsKnown(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
+// Execute runs the named command on the speaker
+func Execute(speaker *musiccast.Speaker, name string, request Request) error {
+	command, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknown, name)
+	}
+	return command(speaker, request)
+}
+
+var commands = map[string]func(speaker *musiccast.Speaker, request Request) error{
+	"power":    powerCommand,
+	"volume":   volumeCommand,
+	"mute":     muteCommand,
+	"input":    inputCommand,
+	"playback": playbackCommand,
+}
+
+func powerCommand(speaker *musiccast.Speaker, request Request) error {
+	switch request.Power {
+	case musiccast.On, musiccast.Standby:
+		return musiccast.SetPower(speaker, request.Power)
+	case PowerToggle:
+		if speaker.Power == musiccast.On {
+			return musiccast.SetPower(speaker, musiccast.Standby)
+		}
+		return musiccast.SetPower(speaker, musiccast.On)
+	}
+	return InvalidError{fmt.Errorf("power must be on, standby or toggle, got %q", request.Power)}
+}
+
+func volumeCommand(speaker *musiccast.Speaker, request Request) error {
+	switch {
+	case request.Volume != nil && request.Step != nil:
+		return InvalidError{errors.New("volume and step are mutually exclusive")}
+	case request.Volume != nil:
+		// speakers which aren't loaded yet have no max volume, the speaker checks it then
+		if *request.Volume < 0 {
+			return InvalidError{fmt.Errorf("volume must not be negative, got %d", *request.Volume)}
+		}
+		if speaker.MaxVolume > 0 && *request.Volume > int(speaker.MaxVolume) {
+			return InvalidError{fmt.Errorf("volume must be 0..%d, got %d", speaker.MaxVolume, *request.Volume)}
+		}
+		return musiccast.SetVolumeTo(speaker, LimitVolume(speaker, *request.Volume))
+	case request.Step != nil && *request.Step > 0:
+		if speaker.Volume != nil {
+			// stop at the limit rather than jumping over it
+			volume := int(*speaker.Volume) + *request.Step
+			if limited := LimitVolume(speaker, volume); limited < volume {
+				return musiccast.SetVolumeTo(speaker, limited)
+			}
+		}
+		return musiccast.SetVolume(speaker, musiccast.Up, *request.Step)
+	case request.Step != nil && *request.Step < 0:
+		return musiccast.SetVolume(speaker, musiccast.Down, -*request.Step)
+	}
+	return InvalidError{errors.New("volume or a non-zero step is required")}
+}
+
+func muteCommand(speaker *musiccast.Speaker, request Request) error {
+	if request.Mute != nil {
+		return musiccast.SetMute(speaker, *request.Mute)
+	}
+	return musiccast.SetMute(speaker, speaker.Mute == nil || !*speaker.Mute)
+}
+
+func inputCommand(speaker *musiccast.Speaker, request Request) error {
+	if err := musiccast.ValidateInput(speaker, request.Input); err != nil {
+		return InvalidError{err}
+	}
+	return musiccast.SetInput(speaker, request.Input)
+}
+
+func playbackCommand(speaker *musiccast.Speaker, request Request) error {
+	switch request.Playback {
+	case musiccast.Play, musiccast.Pause, musiccast.Stop, musiccast.Previous, musiccast.Next:
+		return musiccast.SetPlayback(speaker, request.Playback)
+	}
+	return InvalidError{fmt.Errorf("playback must be play, pause, stop, previous or next, got %q", request.Playback)}
+}
+
+// ParseText reads the plain text payload of a command, like "on" for power, "30" or "+5" for volume
+// and "true", "false" or "toggle" for mute
+func ParseText(name string, text string) (Request, error) {
+	text = strings.TrimSpace(text)
+	request := Request{}
+	switch name {
+	case "power":
+		request.Power = musiccast.Power(strings.ToLower(text))
+	case "volume":
+		value, err := strconv.Atoi(text)
+		if err != nil {
+			return request, InvalidError{fmt.Errorf("volume must be a number, got %q", text)}
+		}
+		if strings.HasPrefix(text, "+") || strings.HasPrefix(text, "-") {
+			request.Step = &value
+		} else {
+			request.Volume = &value
+		}
+	case "mute":
+		if !strings.EqualFold(text, "toggle") {
+			mute, err := strconv.ParseBool(strings.ToLower(text))
+			if err != nil {
+				return request, InvalidError{fmt.Errorf("mute must be true, false or toggle, got %q", text)}
+			}
+			request.Mute = &mute
+		}
+	case "input":
+		request.Input = text
+	case "playback":
+		request.Playback = musiccast.Playback(strings.ToLower(text))
+	default:
+		return request, fmt.Errorf("%w %q", ErrUnknown, name)
+	}
+	return request, nil
+}
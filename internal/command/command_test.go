@@ -0,0 +1,50 @@
+package command
+
+import (
+	"errors"
+	"github.com/atamanroman/ymc/internal/testhelper"
+	"github.com/atamanroman/ymc/musiccast"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseText(t *testing.T) {
+	request, err := ParseText("power", " ON\n")
+	assert.NoError(t, err)
+	assert.Equal(t, musiccast.On, request.Power)
+
+	request, err = ParseText("volume", "30")
+	assert.NoError(t, err)
+	assert.Equal(t, 30, *request.Volume)
+	assert.Nil(t, request.Step)
+
+	request, err = ParseText("volume", "-5")
+	assert.NoError(t, err)
+	assert.Equal(t, -5, *request.Step)
+	assert.Nil(t, request.Volume)
+
+	request, err = ParseText("mute", "toggle")
+	assert.NoError(t, err)
+	assert.Nil(t, request.Mute)
+	request, err = ParseText("mute", "TRUE")
+	assert.NoError(t, err)
+	assert.True(t, *request.Mute)
+
+	_, err = ParseText("volume", "loud")
+	assert.True(t, errors.As(err, &InvalidError{}))
+	_, err = ParseText("eject", "")
+	assert.ErrorIs(t, err, ErrUnknown)
+}
+
+func TestExecuteInvalid(t *testing.T) {
+	speaker := musiccast.Speaker{MaxVolume: 60}
+	assert.ErrorIs(t, Execute(&speaker, "eject", Request{}), ErrUnknown)
+
+	invalid := InvalidError{}
+	assert.ErrorAs(t, Execute(&speaker, "power", Request{Power: "off"}), &invalid)
+	assert.ErrorAs(t, Execute(&speaker, "volume", Request{Volume: new(int), Step: new(int)}), &invalid)
+	assert.ErrorAs(t, Execute(&speaker, "volume", Request{Volume: testhelper.Ptr(61)}), &invalid)
+	assert.ErrorAs(t, Execute(&musiccast.Speaker{}, "volume", Request{Volume: testhelper.Ptr(-1)}), &invalid)
+	assert.ErrorAs(t, Execute(&speaker, "input", Request{}), &invalid)
+	assert.ErrorAs(t, Execute(&speaker, "playback", Request{Playback: "rewind"}), &invalid)
+}
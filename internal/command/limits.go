@@ -0,0 +1,195 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"github.com/atamanroman/ymc/internal/logging"
+	"github.com/atamanroman/ymc/internal/state"
+	"github.com/atamanroman/ymc/musiccast"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VolumeLimit caps the volume of speakers, only during the quiet hours from From to To if they are set
+type VolumeLimit struct {
+	// Speakers are names or IDs, all speakers if empty
+	Speakers  []string `json:"speakers,omitempty"`
+	MaxVolume int      `json:"max_volume"`
+	// From and To are HH:MM, the quiet hours may span midnight like 21:00 to 07:00
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// Validate checks the limit without speakers
+func (l VolumeLimit) Validate() error {
+	if l.MaxVolume < 0 {
+		return fmt.Errorf("invalid max volume %d", l.MaxVolume)
+	}
+	if (l.From == "") != (l.To == "") {
+		return fmt.Errorf("quiet hours need from and to, got %q and %q", l.From, l.To)
+	}
+	if l.From == "" {
+		return nil
+	}
+	if _, err := parseClock(l.From); err != nil {
+		return err
+	}
+	_, err := parseClock(l.To)
+	return err
+}
+
+// appliesTo checks if the limit is for the speaker and active at the time
+func (l VolumeLimit) appliesTo(speaker *musiccast.Speaker, t time.Time) bool {
+	if len(l.Speakers) > 0 {
+		found := false
+		for _, name := range l.Speakers {
+			found = found || name == speaker.ID || strings.EqualFold(name, speaker.FriendlyName)
+		}
+		if !found {
+			return false
+		}
+	}
+	if l.From == "" {
+		return true
+	}
+	from, _ := parseClock(l.From)
+	to, _ := parseClock(l.To)
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if from <= to {
+		return now >= from && now < to
+	}
+	return now >= from || now < to
+}
+
+// parseClock parses HH:MM as time since midnight
+func parseClock(clock string) (time.Duration, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+var log = logging.Instance
+
+var limits []VolumeLimit
+var limitsLock sync.RWMutex
+
+// SetLimits replaces the volume limits the volume command and the Watchdog enforce
+func SetLimits(volumeLimits []VolumeLimit) error {
+	for _, limit := range volumeLimits {
+		if err := limit.Validate(); err != nil {
+			return err
+		}
+	}
+	limitsLock.Lock()
+	defer limitsLock.Unlock()
+	limits = volumeLimits
+	return nil
+}
+
+// MaxVolume returns the lowest limit of the speaker at the time, false if there is none
+func MaxVolume(speaker *musiccast.Speaker, t time.Time) (int, bool) {
+	limitsLock.RLock()
+	defer limitsLock.RUnlock()
+	maxVolume, limited := 0, false
+	for _, limit := range limits {
+		if limit.appliesTo(speaker, t) && (!limited || limit.MaxVolume < maxVolume) {
+			maxVolume, limited = limit.MaxVolume, true
+		}
+	}
+	return maxVolume, limited
+}
+
+// LimitVolume caps the volume at the speaker's current limit, it's the musiccast.VolumeLimiter for
+// scenes and snapshots
+func LimitVolume(speaker *musiccast.Speaker, volume int) int {
+	if maxVolume, ok := MaxVolume(speaker, time.Now()); ok && volume > maxVolume {
+		return maxVolume
+	}
+	return volume
+}
+
+// how often the Watchdog checks all speakers, quiet hours start without an event
+const watchdogInterval = time.Minute
+
+// Watchdog pulls the volume of speakers above their limit down to it until the context is done. It
+// reacts to volume changes from everywhere, like the MusicCast app or the remote. Without limits it
+// returns at once.
+func Watchdog(ctx context.Context, speakers *state.Store) {
+	limitsLock.RLock()
+	limited := len(limits) > 0
+	limitsLock.RUnlock()
+	if !limited {
+		return
+	}
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+	var seq uint64
+	for ctx.Err() == nil {
+		backlog, changes, cancel := speakers.Subscribe(seq)
+		for _, change := range backlog {
+			seq = change.Seq
+		}
+		enforceAll(speakers)
+		seq = watch(ctx, speakers, changes, ticker.C, seq)
+		cancel()
+	}
+}
+
+// watch enforces the limits on changes until the context is done or the store drops the subscriber,
+// returns the last seen sequence
+func watch(ctx context.Context, speakers *state.Store, changes <-chan state.Change, tick <-chan time.Time, seq uint64) uint64 {
+	for {
+		select {
+		case <-ctx.Done():
+			return seq
+		case <-tick:
+			enforceAll(speakers)
+		case change, ok := <-changes:
+			if !ok {
+				return seq
+			}
+			seq = change.Seq
+			spkr := speakers.Get(change.Speaker)
+			if spkr == nil {
+				continue
+			}
+			switch change.Type {
+			case state.Volume:
+				// the store may already have a later volume, which has its own change
+				if volume, ok := change.Value.(int); ok {
+					enforce(spkr, volume)
+				}
+			case state.Power, state.Added:
+				if spkr.Volume != nil {
+					enforce(spkr, int(*spkr.Volume))
+				}
+			}
+		}
+	}
+}
+
+func enforceAll(speakers *state.Store) {
+	for _, spkr := range speakers.Sorted() {
+		if spkr.Volume != nil {
+			enforce(spkr, int(*spkr.Volume))
+		}
+	}
+}
+
+// enforce pulls the volume of the speaker down if it's above the limit
+func enforce(speaker *musiccast.Speaker, volume int) {
+	if speaker.Power != musiccast.On {
+		return
+	}
+	maxVolume, ok := MaxVolume(speaker, time.Now())
+	if !ok || volume <= maxVolume {
+		return
+	}
+	log.Infof("Volume of %s is %d above the limit %d - pull down", speaker.FriendlyName, volume, maxVolume)
+	if err := musiccast.SetVolumeTo(speaker, maxVolume); err != nil {
+		log.Warn("Failed to limit volume:", speaker.FriendlyName, err)
+	}
+}
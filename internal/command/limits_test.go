@@ -0,0 +1,112 @@
+package command
+
+import (
+	"context"
+	"github.com/atamanroman/ymc/internal/state"
+	"github.com/atamanroman/ymc/internal/testhelper"
+	"github.com/atamanroman/ymc/musiccast"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMaxVolume(t *testing.T) {
+	t.Cleanup(func() { _ = SetLimits(nil) })
+	bedroom := &musiccast.Speaker{ID: "1", FriendlyName: "Bedroom"}
+	kitchen := &musiccast.Speaker{ID: "2", FriendlyName: "Kitchen"}
+	assert.NoError(t, SetLimits([]VolumeLimit{
+		{MaxVolume: 60},
+		{Speakers: []string{"bedroom"}, MaxVolume: 40},
+		{Speakers: []string{"1"}, MaxVolume: 15, From: "21:00", To: "07:00"},
+	}))
+
+	at := func(clock string) time.Time {
+		t, _ := time.Parse("15:04", clock)
+		return t
+	}
+	for clock, expected := range map[string]int{"12:00": 40, "21:00": 15, "23:59": 15, "06:59": 15, "07:00": 40} {
+		maxVolume, ok := MaxVolume(bedroom, at(clock))
+		assert.True(t, ok)
+		assert.Equal(t, expected, maxVolume, clock)
+	}
+	maxVolume, _ := MaxVolume(kitchen, at("22:00"))
+	assert.Equal(t, 60, maxVolume)
+
+	assert.NoError(t, SetLimits([]VolumeLimit{{Speakers: []string{"Bedroom"}, MaxVolume: 20, From: "08:00", To: "09:00"}}))
+	_, ok := MaxVolume(kitchen, at("08:30"))
+	assert.False(t, ok)
+	assert.Equal(t, 50, LimitVolume(kitchen, 50))
+
+	assert.EqualError(t, SetLimits([]VolumeLimit{{MaxVolume: 10, From: "21:00"}}), `quiet hours need from and to, got "21:00" and ""`)
+	assert.EqualError(t, SetLimits([]VolumeLimit{{MaxVolume: 10, From: "21:00", To: "7"}}), `invalid time "7", expected HH:MM`)
+}
+
+// fakeSpeaker records the YXC requests and answers all with success
+func fakeSpeaker(t *testing.T) (*httptest.Server, func() []string) {
+	lock := sync.Mutex{}
+	requests := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests = append(requests, strings.TrimPrefix(r.URL.RequestURI(), "/YamahaExtendedControl/v1/"))
+		lock.Unlock()
+		_, _ = w.Write([]byte(`{"response_code":0}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string{}, requests...)
+	}
+}
+
+func TestVolumeLimits(t *testing.T) {
+	t.Cleanup(func() { _ = SetLimits(nil) })
+	server, requests := fakeSpeaker(t)
+	assert.NoError(t, SetLimits([]VolumeLimit{{Speakers: []string{"Bedroom"}, MaxVolume: 30}}))
+
+	speaker := &musiccast.Speaker{ID: server.URL, FriendlyName: "Bedroom", BaseUrl: server.URL + "/", Power: musiccast.On,
+		Volume: testhelper.Ptr(int8(28)), MaxVolume: 60}
+	assert.NoError(t, Execute(speaker, "volume", Request{Volume: testhelper.Ptr(50)}))
+	assert.NoError(t, Execute(speaker, "volume", Request{Step: testhelper.Ptr(5)}))
+	assert.NoError(t, Execute(speaker, "volume", Request{Step: testhelper.Ptr(1)}))
+	assert.NoError(t, Execute(speaker, "volume", Request{Step: testhelper.Ptr(-5)}))
+	assert.Equal(t, []string{
+		"main/setVolume?volume=30",
+		"main/setVolume?volume=30",
+		"main/setVolume?volume=up",
+		"main/setVolume?volume=down&step=5",
+	}, requests())
+
+	// not loaded yet, still capped at the limit
+	speaker.MaxVolume = 0
+	assert.NoError(t, Execute(speaker, "volume", Request{Volume: testhelper.Ptr(50)}))
+	assert.Equal(t, "main/setVolume?volume=30", requests()[4])
+}
+
+func TestWatchdog(t *testing.T) {
+	t.Cleanup(func() { _ = SetLimits(nil) })
+	server, requests := fakeSpeaker(t)
+	assert.NoError(t, SetLimits([]VolumeLimit{{MaxVolume: 30}}))
+
+	speakers := state.NewStore()
+	speakers.Apply(&musiccast.Speaker{ID: server.URL, FriendlyName: "Bedroom", BaseUrl: server.URL + "/", Power: musiccast.On,
+		Volume: testhelper.Ptr(int8(40))})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Watchdog(ctx, speakers)
+	assert.Eventually(t, func() bool {
+		return len(requests()) == 1
+	}, time.Second, time.Millisecond)
+
+	// the speaker reports the pulled down volume, then someone turns it up again
+	speakers.Apply(&musiccast.Speaker{ID: server.URL, Volume: testhelper.Ptr(int8(30)), PartialUpdate: true})
+	speakers.Apply(&musiccast.Speaker{ID: server.URL, Volume: testhelper.Ptr(int8(45)), PartialUpdate: true})
+	assert.Eventually(t, func() bool {
+		return len(requests()) == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"main/setVolume?volume=30", "main/setVolume?volume=30"}, requests())
+}
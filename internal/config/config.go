@@ -0,0 +1,111 @@
+// Package config reads and writes the ymc config file, config.json in the ymc directory of
+// os.UserConfigDir (like ~/.config/ymc/config.json) or $YMC_CONFIG
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/atamanroman/ymc/internal/command"
+	"github.com/atamanroman/ymc/internal/schedule"
+	"github.com/atamanroman/ymc/musiccast"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+type Config struct {
+	Scenes    map[string]musiccast.Scene `json:"scenes,omitempty"`
+	Schedules []schedule.Schedule        `json:"schedules,omitempty"`
+	// PowerFade fades the volume in and out when the UI powers speakers on and off, 0 to switch at once
+	PowerFade schedule.Duration   `json:"power_fade,omitempty"`
+	FadeCurve musiccast.FadeCurve `json:"fade_curve,omitempty"`
+	// VolumeLimits are enforced by the commands and pulled down to by the daemons
+	VolumeLimits []command.VolumeLimit `json:"volume_limits,omitempty"`
+	// Keymap is the UI's keymap to start from, default or vi, Keys bind keys to actions on top of it
+	Keymap string            `json:"keymap,omitempty"`
+	Keys   map[string]string `json:"keys,omitempty"`
+	// Theme is the UI's theme, ymc -theme overrides it
+	Theme string `json:"theme,omitempty"`
+}
+
+// Path is where Load and Save expect the config file
+func Path() (string, error) {
+	if path := os.Getenv("YMC_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ymc", "config.json"), nil
+}
+
+// StatePath is where ymc keeps the named state file like the last runs of the schedules, next to
+// the config file
+func StatePath(name string) (string, error) {
+	path, err := Path()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), name), nil
+}
+
+// Load reads the config file, a missing file is an empty config
+func Load() (*Config, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	return load(path)
+}
+
+func load(path string) (*Config, error) {
+	config := &Config{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Save writes the config file, replacing it at once so a crash doesn't leave half a file
+func (c *Config) Save() error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	return c.save(path)
+}
+
+func (c *Config) save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// SceneNames returns the names of the scenes in alphabetical order
+func (c *Config) SceneNames() []string {
+	names := make([]string, 0, len(c.Scenes))
+	for name := range c.Scenes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
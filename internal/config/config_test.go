@@ -0,0 +1,42 @@
+package config
+
+import (
+	"github.com/atamanroman/ymc/internal/schedule"
+	"github.com/atamanroman/ymc/internal/testhelper"
+	"github.com/atamanroman/ymc/musiccast"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ymc", "config.json")
+	t.Setenv("YMC_CONFIG", path)
+
+	config, err := Load()
+	assert.NoError(t, err)
+	assert.Empty(t, config.SceneNames())
+
+	config.Scenes = map[string]musiccast.Scene{
+		"dinner":  {Speakers: []musiccast.SpeakerState{{ID: "1", Name: "Kitchen", Power: musiccast.On, Preset: 3, Volume: testhelper.Ptr(30)}}},
+		"bedtime": {Speakers: []musiccast.SpeakerState{{ID: "1", Name: "Kitchen", Power: musiccast.Standby}}},
+	}
+	config.Schedules = []schedule.Schedule{
+		{Name: "wake-up", When: "weekdays 07:00", Speakers: []string{"Kitchen"}, Power: musiccast.On, Volume: testhelper.Ptr(20), Fade: schedule.Duration(5 * time.Minute)},
+	}
+	assert.NoError(t, config.Save())
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"fade": "5m0s"`)
+
+	loaded, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, config, loaded)
+	assert.Equal(t, []string{"bedtime", "dinner"}, loaded.SceneNames())
+
+	assert.NoError(t, os.WriteFile(path, []byte("{"), 0o644))
+	_, err = Load()
+	assert.ErrorContains(t, err, "invalid config")
+}
@@ -1,29 +1,62 @@
 package logging
 
 import (
-	"fmt"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"io"
+	"os"
+	"sync"
 )
 
+// Instance logs to stderr, only fatal errors unless SetLevel lowers the level. Packages keep the
+// Instance, so SetLevel and SetOutput change it in place.
 var Instance *zap.SugaredLogger
 
+var level = zap.NewAtomicLevelAt(zap.FatalLevel)
+var output = &syncer{out: zapcore.Lock(os.Stderr)}
+
 func init() {
-	buildLogger("")
+	encoder := zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
+	core := zapcore.NewCore(encoder, output, level)
+	// zap's own errors go where the log goes, stderr belongs to the UI while it runs
+	Instance = zap.New(core, zap.Development(), zap.AddCaller(), zap.AddStacktrace(zap.ErrorLevel),
+		zap.ErrorOutput(output)).Sugar()
+}
+
+// SetLevel logs messages of this level and above
+func SetLevel(l zapcore.Level) {
+	level.SetLevel(l)
 }
 
-func buildLogger(output string) {
-	config := zap.NewDevelopmentConfig()
-	config.Level = zap.NewAtomicLevelAt(zap.FatalLevel)
-	if output != "" {
-		config.OutputPaths = []string{output}
-	}
-	build, err := config.Build()
-	if err != nil {
-		panic(fmt.Errorf("zap logger setup failed: %w", err))
-	}
-	Instance = build.Sugar()
+// SetOutput writes the log to w instead of stderr, like the UI's log view
+func SetOutput(w io.Writer) {
+	output.set(zapcore.AddSync(w))
 }
 
 func Close() {
 	Instance.Sync()
 }
+
+// syncer forwards to an output which can be replaced while logging
+type syncer struct {
+	lock sync.Mutex
+	out  zapcore.WriteSyncer
+}
+
+func (s *syncer) set(out zapcore.WriteSyncer) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.out = out
+}
+
+func (s *syncer) Write(p []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.out.Write(p)
+}
+
+func (s *syncer) Sync() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.out.Sync()
+}
@@ -0,0 +1,131 @@
+package media
+
+import (
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func id3Frame(id string, text []byte) []byte {
+	frame := []byte(id)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(text)))
+	return append(append(frame, 0, 0), text...)
+}
+
+func id3v2(version byte, frames ...[]byte) []byte {
+	body := make([]byte, 0)
+	for _, frame := range frames {
+		body = append(body, frame...)
+	}
+	size := len(body)
+	header := []byte{'I', 'D', '3', version, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(header, body...)
+}
+
+func flac(comments ...string) []byte {
+	block := binary.LittleEndian.AppendUint32(nil, 3)
+	block = append(block, "ymc"...)
+	block = binary.LittleEndian.AppendUint32(block, uint32(len(comments)))
+	for _, comment := range comments {
+		block = binary.LittleEndian.AppendUint32(block, uint32(len(comment)))
+		block = append(block, comment...)
+	}
+	data := []byte("fLaC")
+	// STREAMINFO first, then the comments as last block
+	data = append(data, 0, 0, 0, 34)
+	data = append(data, make([]byte, 34)...)
+	data = append(data, 0x84, byte(len(block)>>16), byte(len(block)>>8), byte(len(block)))
+	return append(data, block...)
+}
+
+func writeFile(t *testing.T, path string, data []byte) string {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+	return path
+}
+
+func TestReadTags(t *testing.T) {
+	dir := t.TempDir()
+
+	mp3 := writeFile(t, filepath.Join(dir, "v3.mp3"), append(id3v2(3,
+		id3Frame("TIT2", []byte("\x00Caf\xe9")),
+		// UTF-16 with BOM
+		id3Frame("TPE1", []byte{1, 0xff, 0xfe, 'A', 0, 'r', 0, 't', 0}),
+		id3Frame("TALB", []byte("\x03Album\x00Other")),
+	), make([]byte, 512)...))
+	tags, err := ReadTags(mp3)
+	assert.NoError(t, err)
+	assert.Equal(t, Tags{Title: "Café", Artist: "Art", Album: "Album"}, tags)
+
+	v1 := make([]byte, 256)
+	copy(v1[128:], "TAG")
+	copy(v1[131:], "Old Title")
+	copy(v1[161:], "Old Artist")
+	tags, err = ReadTags(writeFile(t, filepath.Join(dir, "v1.mp3"), v1))
+	assert.NoError(t, err)
+	assert.Equal(t, Tags{Title: "Old Title", Artist: "Old Artist"}, tags)
+
+	tags, err = ReadTags(writeFile(t, filepath.Join(dir, "a.flac"), flac("title=Song", "ARTIST=Band", "ARTIST=Other")))
+	assert.NoError(t, err)
+	assert.Equal(t, Tags{Title: "Song", Artist: "Band"}, tags)
+
+	tags, err = ReadTags(writeFile(t, filepath.Join(dir, "empty.wav"), make([]byte, 16)))
+	assert.Error(t, err)
+	assert.Equal(t, Tags{}, tags)
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "b", "02 Second.flac"), flac("TITLE=Second"))
+	writeFile(t, filepath.Join(dir, "b", "01 First.MP3"), make([]byte, 256))
+	writeFile(t, filepath.Join(dir, "a.wav"), nil)
+	writeFile(t, filepath.Join(dir, "cover.jpg"), nil)
+	writeFile(t, filepath.Join(dir, ".hidden", "c.mp3"), nil)
+
+	tracks, err := Scan(dir)
+	assert.NoError(t, err)
+	if assert.Len(t, tracks, 3) {
+		assert.Equal(t, Track{Path: filepath.Join(dir, "a.wav"), MimeType: "audio/wav", Tags: Tags{Title: "a"}}, tracks[0])
+		assert.Equal(t, "01 First", tracks[1].Title)
+		assert.Equal(t, "audio/mpeg", tracks[1].MimeType)
+		assert.Equal(t, "Second", tracks[2].Title)
+		assert.Equal(t, "audio/flac", tracks[2].MimeType)
+	}
+
+	_, err = Scan(filepath.Join(dir, "cover.jpg"))
+	assert.EqualError(t, err, filepath.Join(dir, "cover.jpg")+" is no known audio file")
+	_, err = Scan(filepath.Join(dir, ".hidden", "missing"))
+	assert.Error(t, err)
+}
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, filepath.Join(dir, "my song.flac"), []byte("0123456789"))
+	server, err := NewServer(net.IPv4(127, 0, 0, 1))
+	assert.NoError(t, err)
+	defer server.Close()
+
+	uri := server.Add(Track{Path: path, MimeType: "audio/flac"})
+	assert.Regexp(t, `^http://127\.0\.0\.1:\d+/1/my%20song\.flac$`, uri)
+
+	request, _ := http.NewRequest(http.MethodGet, uri, nil)
+	request.Header.Set("Range", "bytes=2-4")
+	resp, err := http.DefaultClient.Do(request)
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "audio/flac", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "Streaming", resp.Header.Get("transferMode.dlna.org"))
+	assert.Equal(t, "234", string(body))
+
+	resp, err = http.Get(uri[:len(uri)-len("1/my%20song.flac")] + "2/my%20song.flac")
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,104 @@
+// Package media serves local audio files to the speakers' DLNA renderers
+package media
+
+import (
+	"fmt"
+	"github.com/atamanroman/ymc/internal/logging"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var log = logging.Instance
+
+// Server serves the added tracks over HTTP with range requests, which renderers use to seek
+type Server struct {
+	listener net.Listener
+	server   *http.Server
+	base     string
+
+	lock   sync.Mutex
+	tracks map[string]Track
+}
+
+// NewServer listens on a random port of the address, which should be the one facing the speakers,
+// see LocalAddress
+func NewServer(address net.IP) (*Server, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(address.String(), "0"))
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		listener: listener,
+		base:     "http://" + listener.Addr().String(),
+		tracks:   make(map[string]Track),
+	}
+	s.server = &http.Server{Handler: s}
+	go func() {
+		_ = s.server.Serve(listener)
+	}()
+	return s, nil
+}
+
+// Add makes the track available and returns its URL
+func (s *Server) Add(track Track) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	id := strconv.Itoa(len(s.tracks) + 1)
+	s.tracks[id] = track
+	// the file name helps renderers which guess the format from the URL
+	return s.base + "/" + id + "/" + url.PathEscape(filepath.Base(track.Path))
+}
+
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	s.lock.Lock()
+	track, ok := s.tracks[id]
+	s.lock.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	log.Debug("Serve", track.Path, "to", r.RemoteAddr, r.Header.Get("Range"))
+
+	file, err := os.Open(track.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", track.MimeType)
+	// DLNA renderers check these before they seek with range requests
+	w.Header().Set("transferMode.dlna.org", "Streaming")
+	w.Header().Set("contentFeatures.dlna.org", "DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=01700000000000000000000000000000")
+	http.ServeContent(w, r, track.Path, info.ModTime(), file)
+}
+
+// LocalAddress is the address of the interface this host uses to reach the host
+func LocalAddress(host string) (net.IP, error) {
+	// UDP doesn't send anything, it only picks the route
+	conn, err := net.Dial("udp", net.JoinHostPort(host, "80"))
+	if err != nil {
+		return nil, fmt.Errorf("no route to %s: %w", host, err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
@@ -0,0 +1,240 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// Tags is the metadata of an audio file, fields are empty if the file doesn't have them
+type Tags struct {
+	Title  string
+	Artist string
+	Album  string
+}
+
+// ReadTags reads ID3 tags of MP3 files and Vorbis comments of FLAC files, other formats have no tags
+func ReadTags(path string) (Tags, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Tags{}, err
+	}
+	defer file.Close()
+
+	magic := make([]byte, 4)
+	if _, err = io.ReadFull(file, magic); err != nil {
+		return Tags{}, err
+	}
+	switch {
+	case string(magic) == "fLaC":
+		return readFlac(file)
+	case string(magic[:3]) == "ID3":
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			return Tags{}, err
+		}
+		tags, err := readId3v2(file)
+		if err == nil && tags.Title != "" {
+			return tags, nil
+		}
+		// ID3v2 tags without the interesting frames are common, try the old tag at the end
+		return readId3v1(file)
+	default:
+		return readId3v1(file)
+	}
+}
+
+// readId3v2 reads the text frames of an ID3v2.3 or ID3v2.4 tag
+func readId3v2(r io.Reader) (Tags, error) {
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Tags{}, err
+	}
+	version := header[3]
+	if version != 3 && version != 4 {
+		return Tags{}, errors.New("unsupported ID3 version")
+	}
+	tag := make([]byte, syncsafe(header[6:10]))
+	if _, err := io.ReadFull(r, tag); err != nil {
+		return Tags{}, err
+	}
+	if header[5]&0x40 != 0 && len(tag) >= 4 {
+		// skip the extended header, its size includes itself in v2.4 only
+		size := int(binary.BigEndian.Uint32(tag))
+		if version == 4 {
+			size = syncsafe(tag[:4])
+		} else {
+			size += 4
+		}
+		if size > len(tag) {
+			return Tags{}, errors.New("invalid ID3 extended header")
+		}
+		tag = tag[size:]
+	}
+
+	tags := Tags{}
+	for len(tag) >= 10 && tag[0] != 0 {
+		id := string(tag[:4])
+		size := int(binary.BigEndian.Uint32(tag[4:8]))
+		if version == 4 {
+			size = syncsafe(tag[4:8])
+		}
+		if size > len(tag)-10 {
+			break
+		}
+		frame := tag[10 : 10+size]
+		switch id {
+		case "TIT2":
+			tags.Title = id3Text(frame)
+		case "TPE1":
+			tags.Artist = id3Text(frame)
+		case "TALB":
+			tags.Album = id3Text(frame)
+		}
+		tag = tag[10+size:]
+	}
+	return tags, nil
+}
+
+// syncsafe decodes ID3 sizes, which use 7 bits per byte
+func syncsafe(b []byte) int {
+	return int(b[0])<<21 | int(b[1])<<14 | int(b[2])<<7 | int(b[3])
+}
+
+// id3Text decodes a text frame, the first byte is the encoding
+func id3Text(frame []byte) string {
+	if len(frame) == 0 {
+		return ""
+	}
+	text := frame[1:]
+	var decoded string
+	switch frame[0] {
+	case 0:
+		// ISO-8859-1 maps to the first 256 code points
+		runes := make([]rune, len(text))
+		for i, b := range text {
+			runes[i] = rune(b)
+		}
+		decoded = string(runes)
+	case 1:
+		if len(text) >= 2 && text[0] == 0xff && text[1] == 0xfe {
+			decoded = utf16Text(text[2:], binary.LittleEndian)
+		} else if len(text) >= 2 && text[0] == 0xfe && text[1] == 0xff {
+			decoded = utf16Text(text[2:], binary.BigEndian)
+		} else {
+			decoded = utf16Text(text, binary.LittleEndian)
+		}
+	case 2:
+		decoded = utf16Text(text, binary.BigEndian)
+	default:
+		decoded = string(text)
+	}
+	// multiple values are separated by null characters, keep the first
+	decoded, _, _ = strings.Cut(decoded, "\x00")
+	return strings.TrimSpace(decoded)
+}
+
+func utf16Text(b []byte, order binary.ByteOrder) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = order.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// readId3v1 reads the fixed size tag in the last 128 bytes of the file
+func readId3v1(file *os.File) (Tags, error) {
+	if _, err := file.Seek(-128, io.SeekEnd); err != nil {
+		return Tags{}, err
+	}
+	tag := make([]byte, 128)
+	if _, err := io.ReadFull(file, tag); err != nil {
+		return Tags{}, err
+	}
+	if string(tag[:3]) != "TAG" {
+		return Tags{}, nil
+	}
+	field := func(b []byte) string {
+		return strings.TrimSpace(string(bytes.TrimRight(b, "\x00")))
+	}
+	return Tags{Title: field(tag[3:33]), Artist: field(tag[33:63]), Album: field(tag[63:93])}, nil
+}
+
+// readFlac reads the Vorbis comment block, r is positioned after the magic
+func readFlac(r io.Reader) (Tags, error) {
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return Tags{}, err
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		size := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		block := make([]byte, size)
+		if _, err := io.ReadFull(r, block); err != nil {
+			return Tags{}, err
+		}
+		if blockType == 4 {
+			return vorbisComments(block)
+		}
+		if last {
+			return Tags{}, nil
+		}
+	}
+}
+
+// vorbisComments decodes the KEY=value comments, lengths are little endian unlike the rest of FLAC
+func vorbisComments(block []byte) (Tags, error) {
+	invalid := errors.New("invalid Vorbis comment")
+	next := func() (string, bool) {
+		if len(block) < 4 {
+			return "", false
+		}
+		length := int(binary.LittleEndian.Uint32(block))
+		if length > len(block)-4 {
+			return "", false
+		}
+		value := string(block[4 : 4+length])
+		block = block[4+length:]
+		return value, true
+	}
+	if _, ok := next(); !ok { // vendor
+		return Tags{}, invalid
+	}
+	if len(block) < 4 {
+		return Tags{}, invalid
+	}
+	count := int(binary.LittleEndian.Uint32(block))
+	block = block[4:]
+
+	tags := Tags{}
+	for i := 0; i < count; i++ {
+		comment, ok := next()
+		if !ok {
+			return tags, invalid
+		}
+		key, value, _ := strings.Cut(comment, "=")
+		// keys are case-insensitive and may repeat, keep the first value
+		switch strings.ToUpper(key) {
+		case "TITLE":
+			tags.Title = firstNonEmpty(tags.Title, value)
+		case "ARTIST":
+			tags.Artist = firstNonEmpty(tags.Artist, value)
+		case "ALBUM":
+			tags.Album = firstNonEmpty(tags.Album, value)
+		}
+	}
+	return tags, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package media
+
+import (
+	"fmt"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Track is a local audio file with the metadata the renderer shows
+type Track struct {
+	Path     string
+	MimeType string
+	Tags
+}
+
+// audio types by extension, mime.TypeByExtension depends on the system and misses most of them
+var audioTypes = map[string]string{
+	".aac":  "audio/aac",
+	".aif":  "audio/aiff",
+	".aiff": "audio/aiff",
+	".alac": "audio/mp4",
+	".dsf":  "audio/dsf",
+	".flac": "audio/flac",
+	".m4a":  "audio/mp4",
+	".mp3":  "audio/mpeg",
+	".oga":  "audio/ogg",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg",
+	".wav":  "audio/wav",
+	".wma":  "audio/x-ms-wma",
+}
+
+// MimeType returns the audio MIME type of the file by its extension, empty if it's no audio file
+func MimeType(path string) string {
+	extension := strings.ToLower(filepath.Ext(path))
+	if mimeType, ok := audioTypes[extension]; ok {
+		return mimeType
+	}
+	if mimeType := mime.TypeByExtension(extension); strings.HasPrefix(mimeType, "audio/") {
+		return mimeType
+	}
+	return ""
+}
+
+// Scan returns the file as track or the audio files of the directory and its subdirectories in
+// path order, which keeps albums together
+func Scan(path string) ([]Track, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		mimeType := MimeType(path)
+		if mimeType == "" {
+			return nil, fmt.Errorf("%s is no known audio file", path)
+		}
+		return []Track{newTrack(path, mimeType)}, nil
+	}
+
+	tracks := make([]Track, 0)
+	err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), ".") && file != path {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if mimeType := MimeType(file); !entry.IsDir() && mimeType != "" {
+			tracks = append(tracks, newTrack(file, mimeType))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("no audio files in %s", path)
+	}
+	return tracks, nil
+}
+
+func newTrack(path string, mimeType string) Track {
+	tags, err := ReadTags(path)
+	if err != nil {
+		log.Debug("Failed to read tags of", path, err)
+	}
+	if tags.Title == "" {
+		tags.Title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return Track{Path: path, MimeType: mimeType, Tags: tags}
+}
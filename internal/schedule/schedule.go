@@ -0,0 +1,238 @@
+// Package schedule runs timed actions from the config file like powering on the kitchen speaker
+// with a radio preset on weekday mornings
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/atamanroman/ymc/internal/command"
+	"github.com/atamanroman/ymc/internal/logging"
+	"github.com/atamanroman/ymc/musiccast"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var log = logging.Instance
+
+// MissedPolicy decides what happens to runs which were missed, because ymc wasn't running or the
+// machine was asleep
+type MissedPolicy string
+
+const (
+	// MissedSkip drops missed runs, the default
+	MissedSkip MissedPolicy = "skip"
+	// MissedRun runs once as soon as possible for all missed runs
+	MissedRun MissedPolicy = "run"
+)
+
+// Schedule runs its actions on the speakers at the times of When, in the order power on, input,
+// preset, volume and standby
+type Schedule struct {
+	Name string `json:"name"`
+	// When is "[days] HH:MM" or a cron expression, see ParseSpec
+	When string `json:"when"`
+	// Speakers are names or IDs, all speakers if empty
+	Speakers []string        `json:"speakers,omitempty"`
+	Power    musiccast.Power `json:"power,omitempty"`
+	Input    string          `json:"input,omitempty"`
+	// Preset is the net/USB preset to recall, 0 for none
+	Preset int  `json:"preset,omitempty"`
+	Volume *int `json:"volume,omitempty"`
+	// Fade fades in from 0 to Volume when powering on and out to 0 before standby
+	Fade Duration `json:"fade,omitempty"`
+	// Curve is the shape of the fade, linear if empty
+	Curve musiccast.FadeCurve `json:"curve,omitempty"`
+	// Jitter delays each run by a random duration up to Jitter
+	Jitter Duration     `json:"jitter,omitempty"`
+	Missed MissedPolicy `json:"missed,omitempty"`
+}
+
+// Duration is a time.Duration written as string like "5m" in the config file
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// Validate checks the schedule without speakers, the speakers and inputs are checked when it runs
+func (s Schedule) Validate() error {
+	if s.Name == "" {
+		return errors.New("schedule without name")
+	}
+	if _, err := ParseSpec(s.When); err != nil {
+		return fmt.Errorf("schedule %s: %w", s.Name, err)
+	}
+	switch {
+	case s.Power != "" && s.Power != musiccast.On && s.Power != musiccast.Standby:
+		return fmt.Errorf("schedule %s: power must be on or standby, got %q", s.Name, s.Power)
+	case s.Power == musiccast.Standby && (s.Input != "" || s.Preset != 0 || s.Volume != nil):
+		return fmt.Errorf("schedule %s: standby can't be combined with input, preset or volume", s.Name)
+	case s.Preset < 0:
+		return fmt.Errorf("schedule %s: invalid preset %d", s.Name, s.Preset)
+	case s.Volume != nil && *s.Volume < 0:
+		return fmt.Errorf("schedule %s: invalid volume %d", s.Name, *s.Volume)
+	case s.Fade < 0 || s.Jitter < 0:
+		return fmt.Errorf("schedule %s: fade and jitter must not be negative", s.Name)
+	case s.Fade > 0 && s.Power != musiccast.Standby && (s.Power != musiccast.On || s.Volume == nil):
+		return fmt.Errorf("schedule %s: fade needs power standby or power on with volume", s.Name)
+	case s.Curve != "" && s.Curve != musiccast.FadeLinear && s.Curve != musiccast.FadeLog:
+		return fmt.Errorf("schedule %s: curve must be linear or log, got %q", s.Name, s.Curve)
+	case s.Missed != "" && s.Missed != MissedSkip && s.Missed != MissedRun:
+		return fmt.Errorf("schedule %s: missed must be skip or run, got %q", s.Name, s.Missed)
+	case s.Power == "" && s.Input == "" && s.Preset == 0 && s.Volume == nil:
+		return fmt.Errorf("schedule %s: nothing to do", s.Name)
+	}
+	return nil
+}
+
+// Describe lists the actions like "power on, preset 1, volume 20 fading in over 5m0s"
+func (s Schedule) Describe() string {
+	actions := make([]string, 0)
+	if s.Power == musiccast.On {
+		actions = append(actions, "power on")
+	}
+	if s.Input != "" {
+		actions = append(actions, "input "+s.Input)
+	}
+	if s.Preset != 0 {
+		actions = append(actions, "preset "+strconv.Itoa(s.Preset))
+	}
+	if s.Volume != nil {
+		volume := "volume " + strconv.Itoa(*s.Volume)
+		if s.Fade > 0 {
+			volume += " fading in over " + time.Duration(s.Fade).String() + s.curveSuffix()
+		}
+		actions = append(actions, volume)
+	}
+	if s.Power == musiccast.Standby {
+		standby := "standby"
+		if s.Fade > 0 {
+			standby = "fade out over " + time.Duration(s.Fade).String() + s.curveSuffix() + ", standby"
+		}
+		actions = append(actions, standby)
+	}
+	return strings.Join(actions, ", ")
+}
+
+func (s Schedule) curveSuffix() string {
+	if s.curve() == musiccast.FadeLinear {
+		return ""
+	}
+	return " (" + string(s.curve()) + ")"
+}
+
+// SpeakerNames is Speakers for display, "all" if empty
+func (s Schedule) SpeakerNames() string {
+	if len(s.Speakers) == 0 {
+		return "all"
+	}
+	return strings.Join(s.Speakers, ", ")
+}
+
+// Speakers are the speakers the schedules control, like a state.Store
+type Speakers interface {
+	Sorted() []*musiccast.Speaker
+	Find(name string) *musiccast.Speaker
+}
+
+// Execute runs the actions on all speakers of the schedule at once, the error is
+// musiccast.SpeakerErrors
+func (s Schedule) Execute(speakers Speakers) error {
+	errs := musiccast.SpeakerErrors{}
+	targets := speakers.Sorted()
+	if len(s.Speakers) > 0 {
+		targets = make([]*musiccast.Speaker, 0, len(s.Speakers))
+		for _, name := range s.Speakers {
+			spkr := speakers.Find(name)
+			if spkr == nil {
+				errs[name] = errors.New("speaker not found")
+				continue
+			}
+			targets = append(targets, spkr)
+		}
+	}
+
+	lock := sync.Mutex{}
+	wait := sync.WaitGroup{}
+	for _, spkr := range targets {
+		wait.Add(1)
+		go func(spkr *musiccast.Speaker) {
+			defer wait.Done()
+			if err := s.execute(spkr); err != nil {
+				lock.Lock()
+				errs[spkr.FriendlyName] = err
+				lock.Unlock()
+			}
+		}(spkr)
+	}
+	wait.Wait()
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func (s Schedule) execute(speaker *musiccast.Speaker) error {
+	fade := time.Duration(s.Fade)
+	if s.Power == musiccast.On && speaker.Power != musiccast.On {
+		if err := musiccast.SetPower(speaker, musiccast.On); err != nil {
+			return err
+		}
+	}
+	if s.Power == musiccast.On && s.Volume != nil && fade > 0 {
+		// silence before the input starts playing
+		if err := musiccast.SetVolumeTo(speaker, 0); err != nil {
+			return err
+		}
+	}
+	if s.Input != "" {
+		if err := musiccast.SetInput(speaker, s.Input); err != nil {
+			return err
+		}
+	}
+	if s.Preset != 0 {
+		if err := musiccast.RecallPreset(speaker, s.Preset); err != nil {
+			return err
+		}
+	}
+	if s.Volume != nil {
+		volume := command.LimitVolume(speaker, *s.Volume)
+		if fade > 0 {
+			if err := musiccast.FadeVolume(speaker, volume, fade, s.curve()); err != nil {
+				return err
+			}
+		} else if err := musiccast.SetVolumeTo(speaker, volume); err != nil {
+			return err
+		}
+	}
+	if s.Power == musiccast.Standby && speaker.Power != musiccast.Standby {
+		if fade > 0 {
+			return musiccast.StandbyFaded(speaker, fade, s.curve())
+		}
+		return musiccast.SetPower(speaker, musiccast.Standby)
+	}
+	return nil
+}
+
+func (s Schedule) curve() musiccast.FadeCurve {
+	if s.Curve == "" {
+		return musiccast.FadeLinear
+	}
+	return s.Curve
+}
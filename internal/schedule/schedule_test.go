@@ -0,0 +1,184 @@
+package schedule
+
+import (
+	"context"
+	"github.com/atamanroman/ymc/internal/command"
+	"github.com/atamanroman/ymc/internal/testhelper"
+	"github.com/atamanroman/ymc/musiccast"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseSpec(t *testing.T) {
+	// a monday
+	start := time.Date(2024, time.March, 4, 7, 30, 0, 0, time.UTC)
+	tests := []struct {
+		when string
+		next []string
+	}{
+		{"07:45", []string{"2024-03-04 07:45", "2024-03-05 07:45"}},
+		{"daily 7:00", []string{"2024-03-05 07:00", "2024-03-06 07:00"}},
+		{"weekdays 07:30", []string{"2024-03-05 07:30", "2024-03-06 07:30"}},
+		{"weekends 09:00", []string{"2024-03-09 09:00", "2024-03-10 09:00"}},
+		{"mon,fri 23:00", []string{"2024-03-04 23:00", "2024-03-08 23:00"}},
+		{"*/20 8-9 * * *", []string{"2024-03-04 08:00", "2024-03-04 08:20"}},
+		{"0 12 1 * 7", []string{"2024-03-10 12:00", "2024-03-17 12:00"}},
+		{"0 0 29 2 *", []string{"2028-02-29 00:00"}},
+		{"0 0 30 2 *", []string{}},
+	}
+	for _, test := range tests {
+		times, err := Upcoming(Schedule{When: test.when}, start, len(test.next))
+		assert.NoError(t, err, test.when)
+		formatted := make([]string, 0)
+		for _, next := range times {
+			formatted = append(formatted, next.Format("2006-01-02 15:04"))
+		}
+		assert.Equal(t, test.next, formatted, test.when)
+	}
+
+	for _, when := range []string{"", "7", "25:00", "tomorrow 07:00", "* * * *", "*/0 * * * *", "5-1 * * * *"} {
+		_, err := ParseSpec(when)
+		assert.Error(t, err, when)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Schedule{Name: "a", When: "07:00", Power: musiccast.On, Volume: testhelper.Ptr(20), Fade: Duration(time.Minute)}.Validate())
+	assert.NoError(t, Schedule{Name: "a", When: "07:00", Power: musiccast.Standby, Fade: Duration(time.Minute), Missed: MissedRun}.Validate())
+	assert.EqualError(t, Schedule{Name: "a", When: "07:00"}.Validate(), "schedule a: nothing to do")
+	assert.EqualError(t, Schedule{Name: "a", When: "07:00", Power: musiccast.Standby, Volume: testhelper.Ptr(20)}.Validate(),
+		"schedule a: standby can't be combined with input, preset or volume")
+	assert.EqualError(t, Schedule{Name: "a", When: "07:00", Volume: testhelper.Ptr(20), Fade: Duration(time.Minute)}.Validate(),
+		"schedule a: fade needs power standby or power on with volume")
+	assert.EqualError(t, Schedule{Name: "a", When: "07:00", Power: musiccast.On, Missed: "later"}.Validate(),
+		`schedule a: missed must be skip or run, got "later"`)
+}
+
+type fakeSpeakers []*musiccast.Speaker
+
+func (f fakeSpeakers) Sorted() []*musiccast.Speaker {
+	return f
+}
+
+func (f fakeSpeakers) Find(name string) *musiccast.Speaker {
+	for _, spkr := range f {
+		if strings.EqualFold(spkr.FriendlyName, name) || spkr.ID == name {
+			return spkr
+		}
+	}
+	return nil
+}
+
+func TestExecute(t *testing.T) {
+	lock := sync.Mutex{}
+	requests := make([]string, 0)
+	volume := "1"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		requests = append(requests, strings.TrimPrefix(r.URL.RequestURI(), "/YamahaExtendedControl/v1/"))
+		if r.URL.Path == "/YamahaExtendedControl/v1/main/getStatus" {
+			_, _ = w.Write([]byte(`{"response_code":0,"volume":` + volume + `,"max_volume":60}`))
+			return
+		}
+		if r.URL.Query().Has("volume") {
+			volume = r.URL.Query().Get("volume")
+		}
+		_, _ = w.Write([]byte(`{"response_code":0}`))
+	}))
+	defer server.Close()
+	kitchen := &musiccast.Speaker{ID: "1", FriendlyName: "Kitchen", BaseUrl: server.URL + "/", Power: musiccast.Standby}
+
+	// long enough that a busy machine doesn't skip volume steps
+	wakeUp := Schedule{Name: "wake-up", When: "07:00", Speakers: []string{"kitchen", "Garage"}, Power: musiccast.On,
+		Input: "net_radio", Preset: 1, Volume: testhelper.Ptr(2), Fade: Duration(200 * time.Millisecond)}
+	err := wakeUp.Execute(fakeSpeakers{kitchen})
+	assert.EqualError(t, err, "Garage: speaker not found")
+	assert.Equal(t, []string{
+		"main/setPower?power=on",
+		"main/setVolume?volume=0",
+		"main/setInput?input=net_radio",
+		"netusb/recallPreset?zone=main&num=1",
+		"main/getStatus",
+		"main/setVolume?volume=1",
+		"main/setVolume?volume=2",
+	}, requests)
+	assert.Equal(t, "power on, input net_radio, preset 1, volume 2 fading in over 200ms", wakeUp.Describe())
+
+	requests = requests[:0]
+	kitchen.Power = musiccast.On
+	night := Schedule{Name: "night", When: "23:00", Power: musiccast.Standby, Fade: Duration(100 * time.Millisecond), Curve: musiccast.FadeLog}
+	assert.NoError(t, night.Execute(fakeSpeakers{kitchen}))
+	assert.Equal(t, "fade out over 100ms (log), standby", night.Describe())
+	assert.Equal(t, []string{
+		"main/getStatus",
+		"main/getStatus",
+		"main/setVolume?volume=1",
+		"main/setVolume?volume=0",
+		"main/setPower?power=standby",
+		"main/setVolume?volume=2",
+	}, requests)
+
+	requests = requests[:0]
+	t.Cleanup(func() { _ = command.SetLimits(nil) })
+	assert.NoError(t, command.SetLimits([]command.VolumeLimit{{MaxVolume: 5}}))
+	loud := Schedule{Name: "loud", When: "07:00", Speakers: []string{"kitchen"}, Volume: testhelper.Ptr(30)}
+	assert.NoError(t, loud.Execute(fakeSpeakers{kitchen}))
+	assert.Equal(t, []string{"main/setVolume?volume=5"}, requests)
+}
+
+func TestRun(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	now := time.Date(2024, time.March, 4, 12, 0, 0, 0, time.Local)
+	yesterday := now.AddDate(0, 0, -1)
+	assert.NoError(t, saveState(statePath, map[string]time.Time{"skipped": yesterday, "caught-up": yesterday}))
+
+	schedules := []Schedule{
+		{Name: "skipped", When: "08:00", Power: musiccast.Standby},
+		{Name: "caught-up", When: "09:00", Power: musiccast.Standby, Missed: MissedRun},
+		{Name: "later", When: "13:00", Power: musiccast.Standby},
+	}
+	scheduler, err := New(schedules, fakeSpeakers{}, statePath)
+	assert.NoError(t, err)
+	scheduler.now = func() time.Time { return now }
+	results := make(chan Result, 3)
+	scheduler.Report = func(result Result) { results <- result }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		scheduler.Run(ctx)
+		close(done)
+	}()
+	received := map[string]Result{}
+	for len(received) < 2 {
+		select {
+		case result := <-results:
+			received[result.Schedule.Name] = result
+		case <-time.After(5 * time.Second):
+			t.Fatal("schedules didn't run")
+		}
+	}
+	cancel()
+	<-done
+
+	assert.True(t, received["skipped"].Skipped)
+	assert.Equal(t, 8, received["skipped"].Planned.Hour())
+	assert.False(t, received["caught-up"].Skipped)
+	assert.NoError(t, received["caught-up"].Err)
+	assert.Empty(t, results)
+
+	state, err := loadState(statePath)
+	assert.NoError(t, err)
+	assert.True(t, state["caught-up"].Equal(time.Date(2024, time.March, 4, 9, 0, 0, 0, time.Local)))
+	assert.NotContains(t, state, "later")
+
+	_, err = New([]Schedule{schedules[0], schedules[0]}, fakeSpeakers{}, statePath)
+	assert.EqualError(t, err, "duplicate schedule skipped")
+}
@@ -0,0 +1,197 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// runs later than this (plus jitter) count as missed, the timer itself is a bit late at times
+const missedAfter = 2 * time.Minute
+
+// the scheduler checks at least this often, timers don't notice when the clock jumps or the machine
+// wakes up from sleep
+const maxWait = time.Minute
+
+// Result is the outcome of a run, logged by the daemon
+type Result struct {
+	Schedule Schedule
+	// Planned is the time of the run from When, the run is later with jitter or when missed
+	Planned time.Time
+	// Skipped runs were missed and not run because of MissedSkip
+	Skipped bool
+	// Err is musiccast.SpeakerErrors if some speakers failed
+	Err error
+}
+
+// Scheduler runs the schedules and remembers the last runs in a state file so it notices missed
+// runs across restarts
+type Scheduler struct {
+	schedules []Schedule
+	specs     []Spec
+	speakers  Speakers
+	statePath string
+	// Report is called for every run and skipped run, from several goroutines
+	Report func(Result)
+
+	now    func() time.Time
+	jitter func(max time.Duration) time.Duration
+}
+
+// New checks the schedules, the state file keeps the time of the last run of every schedule
+func New(schedules []Schedule, speakers Speakers, statePath string) (*Scheduler, error) {
+	specs := make([]Spec, 0, len(schedules))
+	names := make(map[string]bool)
+	for _, schedule := range schedules {
+		if err := schedule.Validate(); err != nil {
+			return nil, err
+		}
+		if names[schedule.Name] {
+			return nil, fmt.Errorf("duplicate schedule %s", schedule.Name)
+		}
+		names[schedule.Name] = true
+		spec, _ := ParseSpec(schedule.When)
+		specs = append(specs, spec)
+	}
+	return &Scheduler{
+		schedules: schedules,
+		specs:     specs,
+		speakers:  speakers,
+		statePath: statePath,
+		Report:    func(Result) {},
+		now:       time.Now,
+		jitter: func(max time.Duration) time.Duration {
+			if max <= 0 {
+				return 0
+			}
+			return time.Duration(rand.Int63n(int64(max)))
+		},
+	}, nil
+}
+
+// Upcoming returns the next n planned times of the schedule after t, without jitter
+func Upcoming(schedule Schedule, t time.Time, n int) ([]time.Time, error) {
+	spec, err := ParseSpec(schedule.When)
+	if err != nil {
+		return nil, err
+	}
+	times := make([]time.Time, 0, n)
+	for len(times) < n {
+		t = spec.Next(t)
+		if t.IsZero() {
+			break
+		}
+		times = append(times, t)
+	}
+	return times, nil
+}
+
+type pending struct {
+	planned time.Time
+	due     time.Time
+}
+
+// Run runs the schedules until the context is done, runs which already started finish in the
+// background
+func (s *Scheduler) Run(ctx context.Context) {
+	lastRuns, err := loadState(s.statePath)
+	if err != nil {
+		log.Warn("Failed to load schedule state, missed runs are unknown:", err)
+		lastRuns = make(map[string]time.Time)
+	}
+	now := s.now()
+	next := make([]pending, len(s.schedules))
+	for i, schedule := range s.schedules {
+		from := now
+		if last, ok := lastRuns[schedule.Name]; ok && last.Before(now) {
+			from = last
+		}
+		next[i] = s.plan(i, from)
+	}
+
+	for {
+		wait := maxWait
+		for _, p := range next {
+			if !p.due.IsZero() && p.due.Sub(now) < wait {
+				wait = p.due.Sub(now)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		now = s.now()
+		changed := false
+		for i, p := range next {
+			if p.due.IsZero() || p.due.After(now) {
+				continue
+			}
+			s.due(s.schedules[i], p, now)
+			lastRuns[s.schedules[i].Name] = p.planned
+			changed = true
+			// all runs missed until now collapse into this one
+			next[i] = s.plan(i, now)
+		}
+		if changed {
+			if err = saveState(s.statePath, lastRuns); err != nil {
+				log.Warn("Failed to save schedule state:", err)
+			}
+		}
+	}
+}
+
+// plan picks the next run after t
+func (s *Scheduler) plan(i int, t time.Time) pending {
+	planned := s.specs[i].Next(t)
+	if planned.IsZero() {
+		return pending{}
+	}
+	return pending{planned, planned.Add(s.jitter(time.Duration(s.schedules[i].Jitter)))}
+}
+
+// due runs or skips the schedule, runs don't block the other schedules
+func (s *Scheduler) due(schedule Schedule, p pending, now time.Time) {
+	if now.Sub(p.due) > missedAfter && schedule.Missed != MissedRun {
+		s.Report(Result{Schedule: schedule, Planned: p.planned, Skipped: true})
+		return
+	}
+	go func() {
+		err := schedule.Execute(s.speakers)
+		s.Report(Result{Schedule: schedule, Planned: p.planned, Err: err})
+	}()
+}
+
+func loadState(path string) (map[string]time.Time, error) {
+	lastRuns := make(map[string]time.Time)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return lastRuns, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lastRuns, json.Unmarshal(data, &lastRuns)
+}
+
+func saveState(path string, lastRuns map[string]time.Time) error {
+	data, err := json.MarshalIndent(lastRuns, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,166 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spec is a parsed When, a cron expression with a bit per allowed value of each field
+type Spec struct {
+	minutes uint64
+	hours   uint64
+	days    uint64
+	months  uint64
+	// weekdays uses 0 for sunday like time.Weekday
+	weekdays uint64
+	// cron runs on days matching days OR weekdays if both are restricted
+	daysRestricted     bool
+	weekdaysRestricted bool
+}
+
+var weekdayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// ParseSpec parses a cron expression with five fields (minute hour day month weekday) or the short
+// form "[days] HH:MM" where days is daily (the default), weekdays, weekends or weekday names like
+// mon,wed or mon-fri
+func ParseSpec(when string) (Spec, error) {
+	fields := strings.Fields(strings.ToLower(when))
+	switch len(fields) {
+	case 5:
+		return parseCron(fields)
+	case 1, 2:
+		return parseShort(fields)
+	}
+	return Spec{}, fmt.Errorf("invalid schedule %q, expected [days] HH:MM or a cron expression", when)
+}
+
+func parseShort(fields []string) (Spec, error) {
+	clock := fields[len(fields)-1]
+	hour, minute, ok := strings.Cut(clock, ":")
+	if !ok {
+		return Spec{}, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+	days := "*"
+	if len(fields) == 2 {
+		switch fields[0] {
+		case "daily":
+		case "weekdays":
+			days = "mon-fri"
+		case "weekends":
+			days = "sat,sun"
+		default:
+			days = fields[0]
+		}
+	}
+	return parseCron([]string{minute, hour, "*", "*", days})
+}
+
+func parseCron(fields []string) (Spec, error) {
+	spec := Spec{}
+	var err error
+	if spec.minutes, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return Spec{}, fmt.Errorf("invalid minute: %w", err)
+	}
+	if spec.hours, err = parseField(fields[1], 0, 23, nil); err != nil {
+		return Spec{}, fmt.Errorf("invalid hour: %w", err)
+	}
+	if spec.days, err = parseField(fields[2], 1, 31, nil); err != nil {
+		return Spec{}, fmt.Errorf("invalid day: %w", err)
+	}
+	if spec.months, err = parseField(fields[3], 1, 12, nil); err != nil {
+		return Spec{}, fmt.Errorf("invalid month: %w", err)
+	}
+	if spec.weekdays, err = parseField(fields[4], 0, 7, weekdayNames); err != nil {
+		return Spec{}, fmt.Errorf("invalid weekday: %w", err)
+	}
+	// 7 is sunday too
+	if spec.weekdays&(1<<7) != 0 {
+		spec.weekdays |= 1
+	}
+	spec.daysRestricted = fields[2] != "*"
+	spec.weekdaysRestricted = fields[4] != "*"
+	return spec, nil
+}
+
+// parseField parses comma separated values, ranges like 1-5 and steps like */15 into a bit set
+func parseField(field string, min int, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+		}
+		from, to := min, max
+		if rangePart != "*" {
+			first, last, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if from, err = fieldValue(first, names); err != nil {
+				return 0, err
+			}
+			to = from
+			if isRange {
+				if to, err = fieldValue(last, names); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				to = max
+			}
+		}
+		if from < min || to > max || from > to {
+			return 0, fmt.Errorf("%q is not within %d-%d", part, min, max)
+		}
+		for value := from; value <= to; value += step {
+			bits |= 1 << value
+		}
+	}
+	return bits, nil
+}
+
+func fieldValue(text string, names map[string]int) (int, error) {
+	if value, ok := names[text]; ok {
+		return value, nil
+	}
+	value, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", text)
+	}
+	return value, nil
+}
+
+// Next returns the first time after t which matches the spec, zero if there is none within 5 years
+// like for the 31st of February
+func (s Spec) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		year, month, day := t.Date()
+		switch {
+		case s.months&(1<<month) == 0:
+			t = time.Date(year, month+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(year, month, day+1, 0, 0, 0, 0, t.Location())
+		case s.hours&(1<<t.Hour()) == 0:
+			t = time.Date(year, month, day, t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minutes&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s Spec) matchesDay(t time.Time) bool {
+	day := s.days&(1<<t.Day()) != 0
+	weekday := s.weekdays&(1<<t.Weekday()) != 0
+	if s.daysRestricted && s.weekdaysRestricted {
+		return day || weekday
+	}
+	return day && weekday
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"fmt"
+	"github.com/atamanroman/ymc/internal/state"
+	"github.com/atamanroman/ymc/musiccast"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metrics serves the speakers and musiccast.GetMetrics in the Prometheus text format. Speakers are
+// labeled by device ID, ymc_speaker_info maps them to names.
+func Metrics(store *state.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, store.Sorted(), musiccast.GetMetrics(), time.Now())
+	})
+}
+
+func writeMetrics(w io.Writer, speakers []*musiccast.Speaker, metrics musiccast.Metrics, now time.Time) {
+	m := metricsWriter{w}
+
+	m.header("ymc_speaker_info", "gauge", "Speaker name and model, always 1")
+	for _, spkr := range speakers {
+		m.sample("ymc_speaker_info", 1, "speaker", spkr.ID, "name", spkr.FriendlyName, "model", spkr.DeviceType)
+	}
+	m.header("ymc_speaker_online", "gauge", "1 if the speaker answered the last event subscription renewal")
+	for _, spkr := range speakers {
+		m.sample("ymc_speaker_online", boolValue(spkr.IsOnline()), "speaker", spkr.ID)
+	}
+	m.header("ymc_speaker_power", "gauge", "Current power state, 1 for the label that applies")
+	for _, spkr := range speakers {
+		m.sample("ymc_speaker_power", 1, "speaker", spkr.ID, "power", string(spkr.Power))
+	}
+	m.header("ymc_speaker_volume", "gauge", "Current volume")
+	for _, spkr := range speakers {
+		if spkr.Volume != nil {
+			m.sample("ymc_speaker_volume", float64(*spkr.Volume), "speaker", spkr.ID)
+		}
+	}
+	m.header("ymc_speaker_max_volume", "gauge", "Maximum volume")
+	for _, spkr := range speakers {
+		m.sample("ymc_speaker_max_volume", float64(spkr.MaxVolume), "speaker", spkr.ID)
+	}
+	m.header("ymc_speaker_muted", "gauge", "1 if the speaker is muted")
+	for _, spkr := range speakers {
+		if spkr.Mute != nil {
+			m.sample("ymc_speaker_muted", boolValue(*spkr.Mute), "speaker", spkr.ID)
+		}
+	}
+	m.header("ymc_speaker_input", "gauge", "Current input, 1 for the label that applies")
+	for _, spkr := range speakers {
+		m.sample("ymc_speaker_input", 1, "speaker", spkr.ID, "input", spkr.Input)
+	}
+	m.header("ymc_speaker_playback", "gauge", "Playback of the CD or netusb input, 1 for the label that applies")
+	for _, spkr := range speakers {
+		if playback := state.Summarize(spkr).Playback; playback != "" {
+			m.sample("ymc_speaker_playback", 1, "speaker", spkr.ID, "playback", string(playback))
+		}
+	}
+
+	m.header("ymc_event_subscription_age_seconds", "gauge", "Time since the last event subscription, speakers drop it after 600s")
+	for _, spkr := range speakers {
+		if stats := musiccast.GetEventStats(spkr.ID); !stats.Subscribed.IsZero() {
+			m.sample("ymc_event_subscription_age_seconds", now.Sub(stats.Subscribed).Seconds(), "speaker", spkr.ID)
+		}
+	}
+	m.header("ymc_events_total", "counter", "Events received from the speaker")
+	for _, spkr := range speakers {
+		m.sample("ymc_events_total", float64(musiccast.GetEventStats(spkr.ID).Count), "speaker", spkr.ID)
+	}
+	m.header("ymc_speaker_last_seen_timestamp_seconds", "gauge", "Unix time of the last response or event of the speaker")
+	for _, spkr := range speakers {
+		if seen, ok := metrics.LastSeen[spkr.ID]; ok {
+			m.sample("ymc_speaker_last_seen_timestamp_seconds", float64(seen.UnixMilli())/1000, "speaker", spkr.ID)
+		}
+	}
+
+	m.header("ymc_yxc_request_duration_seconds", "histogram", "Latency of the YXC HTTP calls by endpoint")
+	for _, endpoint := range sortedKeys(metrics.Latency) {
+		histogram := metrics.Latency[endpoint]
+		for i, bound := range musiccast.LatencyBuckets {
+			m.sample("ymc_yxc_request_duration_seconds_bucket", float64(histogram.Buckets[i]), "endpoint", endpoint, "le", formatValue(bound))
+		}
+		m.sample("ymc_yxc_request_duration_seconds_bucket", float64(histogram.Count), "endpoint", endpoint, "le", "+Inf")
+		m.sample("ymc_yxc_request_duration_seconds_sum", histogram.Sum, "endpoint", endpoint)
+		m.sample("ymc_yxc_request_duration_seconds_count", float64(histogram.Count), "endpoint", endpoint)
+	}
+	m.header("ymc_yxc_errors_total", "counter", "YXC responses with a response_code other than 0")
+	errorKeys := make([]musiccast.ErrorKey, 0, len(metrics.Errors))
+	for key := range metrics.Errors {
+		errorKeys = append(errorKeys, key)
+	}
+	sort.Slice(errorKeys, func(a int, b int) bool {
+		if errorKeys[a].Speaker != errorKeys[b].Speaker {
+			return errorKeys[a].Speaker < errorKeys[b].Speaker
+		}
+		return errorKeys[a].Code < errorKeys[b].Code
+	})
+	for _, key := range errorKeys {
+		m.sample("ymc_yxc_errors_total", float64(metrics.Errors[key]), "speaker", key.Speaker, "code", strconv.Itoa(key.Code))
+	}
+	m.header("ymc_yxc_failures_total", "counter", "YXC calls without a valid response like timeouts")
+	for _, id := range sortedKeys(metrics.Failures) {
+		m.sample("ymc_yxc_failures_total", float64(metrics.Failures[id]), "speaker", id)
+	}
+
+	m.header("ymc_ssdp_discovered_total", "counter", "SSDP responses by result: musiccast, ignored (other devices) or failed")
+	for _, result := range sortedKeys(metrics.Discovery) {
+		m.sample("ymc_ssdp_discovered_total", float64(metrics.Discovery[result]), "result", result)
+	}
+}
+
+type metricsWriter struct {
+	w io.Writer
+}
+
+func (m metricsWriter) header(name string, kind string, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one line, labels are name value pairs
+func (m metricsWriter) sample(name string, value float64, labels ...string) {
+	line := name
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, labels[i]+`="`+labelEscaper.Replace(labels[i+1])+`"`)
+		}
+		line += "{" + strings.Join(pairs, ",") + "}"
+	}
+	fmt.Fprintf(m.w, "%s %s\n", line, formatValue(value))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
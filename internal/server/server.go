@@ -0,0 +1,151 @@
+// Package server is the REST API of ymc serve. Speakers are addressed by device ID or name.
+//
+//	GET  /speakers                all speakers as a list of state.Summary
+//	GET  /speakers/{id}           one speaker as state.Summary
+//	POST /speakers/{id}/power     {"power": "on"}, "standby" or "toggle"
+//	POST /speakers/{id}/volume    {"volume": 30} to set it, {"step": -5} to change it
+//	POST /speakers/{id}/mute      {"mute": true}, without value it toggles
+//	POST /speakers/{id}/input     {"input": "net_radio"}
+//	POST /speakers/{id}/playback  {"playback": "play"}, "pause", "stop", "previous" or "next"
+//	GET  /events                  state.Change stream as Server-Sent Events
+//	GET  /events/ws               state.Change stream as WebSocket JSON messages
+//
+// Commands answer 204 No Content once the speaker accepted them, the new state follows with the
+// speaker's events, which are also streamed. Streams start with the current speakers as "added"
+// changes, clients which reconnect pass the last epoch-seq (Last-Event-ID or ?since=epoch-seq) to get
+// what they missed. Errors are {"error": "..."} with 400 for invalid requests, 404 for unknown
+// speakers, 409 while a speaker updates its firmware, 501 if the speaker lacks the function and 502
+// if the speaker failed.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/atamanroman/ymc/internal/command"
+	"github.com/atamanroman/ymc/internal/logging"
+	"github.com/atamanroman/ymc/internal/state"
+	"github.com/atamanroman/ymc/musiccast"
+	"net/http"
+	"strings"
+)
+
+var log = logging.Instance
+
+type Server struct {
+	store *state.Store
+	mux   *http.ServeMux
+}
+
+// New creates the REST API for the speakers of the store
+func New(store *state.Store) *Server {
+	s := &Server{store: store, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/speakers", s.handleSpeakers)
+	s.mux.HandleFunc("/speakers/", s.handleSpeaker)
+	s.mux.HandleFunc("/events", s.handleEvents)
+	s.mux.HandleFunc("/events/ws", s.handleWebSocket)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Handle registers additional endpoints like streams or metrics
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+func (s *Server) handleSpeakers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	summaries := make([]state.Summary, 0)
+	for _, spkr := range s.store.Sorted() {
+		summaries = append(summaries, state.Summarize(spkr))
+	}
+	writeJson(w, http.StatusOK, summaries)
+}
+
+// handleSpeaker serves /speakers/{id} and /speakers/{id}/{command}
+func (s *Server) handleSpeaker(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/speakers/"), "/")
+	if len(parts) > 2 || parts[0] == "" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	speaker := s.store.Find(parts[0])
+	if speaker == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("speaker %q not found", parts[0]))
+		return
+	}
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		writeJson(w, http.StatusOK, state.Summarize(speaker))
+		return
+	}
+
+	if !command.IsKnown(parts[1]) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown command %q", parts[1]))
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	if speaker.IsUpdating() {
+		writeError(w, http.StatusConflict, fmt.Errorf("%s is updating its firmware", speaker.FriendlyName))
+		return
+	}
+
+	request := command.Request{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON: %w", err))
+			return
+		}
+	}
+	err := command.Execute(speaker, parts[1], request)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJson(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Warn("Failed to write response:", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, map[string]string{"error": err.Error()})
+}
+
+// badRequest marks errors caused by the request
+type badRequest struct {
+	error
+}
+
+func statusOf(err error) int {
+	var invalid badRequest
+	var invalidCommand command.InvalidError
+	switch {
+	case errors.As(err, &invalid), errors.As(err, &invalidCommand):
+		return http.StatusBadRequest
+	case errors.Is(err, musiccast.ErrNotSupported):
+		return http.StatusNotImplemented
+	case musiccast.IsUpdating(err):
+		return http.StatusConflict
+	}
+	// the speaker is unreachable or rejected the command
+	return http.StatusBadGateway
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/atamanroman/ymc/internal/state"
+	"github.com/atamanroman/ymc/internal/testhelper"
+	"github.com/atamanroman/ymc/musiccast"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSpeaker answers every YXC request with response_code 0 and records the paths
+func fakeSpeaker(t *testing.T) (*httptest.Server, *[]string) {
+	requests := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RequestURI())
+		_, _ = w.Write([]byte(`{"response_code":0}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func newTestServer(t *testing.T) (*Server, *[]string) {
+	speaker, requests := fakeSpeaker(t)
+	store := state.NewStore()
+	store.Apply(&musiccast.Speaker{ID: "1", FriendlyName: "Kitchen", BaseUrl: speaker.URL + "/", Power: musiccast.Standby, MaxVolume: 60})
+	return New(store), requests
+}
+
+func request(server *Server, method string, path string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return recorder
+}
+
+func TestGetSpeakers(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	response := request(server, http.MethodGet, "/speakers", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	summaries := make([]state.Summary, 0)
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &summaries))
+	assert.Len(t, summaries, 1)
+	assert.Equal(t, "Kitchen", summaries[0].Name)
+
+	response = request(server, http.MethodGet, "/speakers/kitchen", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `"id":"1"`)
+
+	assert.Equal(t, http.StatusNotFound, request(server, http.MethodGet, "/speakers/bath", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, request(server, http.MethodPost, "/speakers", "").Code)
+}
+
+func TestCommands(t *testing.T) {
+	server, requests := newTestServer(t)
+
+	assert.Equal(t, http.StatusNoContent, request(server, http.MethodPost, "/speakers/1/power", `{"power":"toggle"}`).Code)
+	assert.Equal(t, http.StatusNoContent, request(server, http.MethodPost, "/speakers/1/volume", `{"volume":20}`).Code)
+	assert.Equal(t, http.StatusNoContent, request(server, http.MethodPost, "/speakers/1/volume", `{"step":-5}`).Code)
+	assert.Equal(t, http.StatusNoContent, request(server, http.MethodPost, "/speakers/1/mute", ``).Code)
+	assert.Equal(t, http.StatusNoContent, request(server, http.MethodPost, "/speakers/1/input", `{"input":"net_radio"}`).Code)
+	assert.Equal(t, []string{
+		"/YamahaExtendedControl/v1/main/setPower?power=on",
+		"/YamahaExtendedControl/v1/main/setVolume?volume=20",
+		"/YamahaExtendedControl/v1/main/setVolume?volume=down&step=5",
+		"/YamahaExtendedControl/v1/main/setMute?enable=true",
+		"/YamahaExtendedControl/v1/main/setInput?input=net_radio",
+	}, *requests)
+
+	assert.Equal(t, http.StatusBadRequest, request(server, http.MethodPost, "/speakers/1/power", `{"power":"off"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(server, http.MethodPost, "/speakers/1/volume", `{"volume":61}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(server, http.MethodPost, "/speakers/1/volume", `{`).Code)
+	assert.Equal(t, http.StatusNotImplemented, request(server, http.MethodPost, "/speakers/1/playback", `{"playback":"play"}`).Code)
+	assert.Equal(t, http.StatusNotFound, request(server, http.MethodPost, "/speakers/1/eject", `{}`).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, request(server, http.MethodGet, "/speakers/1/power", ``).Code)
+}
+
+func TestEventStream(t *testing.T) {
+	server, _ := newTestServer(t)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	response, err := http.Get(httpServer.URL + "/events")
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+	reader := bufio.NewReader(response.Body)
+	id := strings.TrimPrefix(readLines(reader, 1), "id: ")
+	epoch, _, _ := strings.Cut(id, "-")
+	assert.Equal(t, epoch+"-1\n", id)
+	assert.Equal(t, "event: added\n", readLines(reader, 1))
+	readLines(reader, 2)
+
+	server.store.Apply(&musiccast.Speaker{ID: "1", Power: musiccast.On, PartialUpdate: true})
+	assert.Equal(t, "id: "+epoch+"-2\nevent: power\n", readLines(reader, 2))
+	data, _ := reader.ReadString('\n')
+	assert.Contains(t, data, `"value":"on"`)
+
+	resume, _ := http.NewRequest(http.MethodGet, httpServer.URL+"/events", nil)
+	resume.Header.Set("Last-Event-ID", epoch+"-1")
+	resumed, err := http.DefaultClient.Do(resume)
+	assert.NoError(t, err)
+	defer resumed.Body.Close()
+	assert.Equal(t, "id: "+epoch+"-2\nevent: power\n", readLines(bufio.NewReader(resumed.Body), 2))
+
+	// the same seq of another server run starts over
+	restarted, err := http.Get(httpServer.URL + "/events?since=other-1")
+	assert.NoError(t, err)
+	defer restarted.Body.Close()
+	assert.Equal(t, "id: "+epoch+"-2\nevent: reset\n", readLines(bufio.NewReader(restarted.Body), 2))
+
+	assert.Equal(t, http.StatusBadRequest, request(server, http.MethodGet, "/events?since=x", "").Code)
+}
+
+func TestWebSocketStream(t *testing.T) {
+	server, _ := newTestServer(t)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http")+"/events/ws?since=0", "", httpServer.URL)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	change := state.Change{}
+	assert.NoError(t, websocket.JSON.Receive(conn, &change))
+	assert.Equal(t, state.Added, change.Type)
+
+	server.store.Apply(&musiccast.Speaker{ID: "1", Volume: testhelper.Ptr(int8(5)), PartialUpdate: true})
+	assert.NoError(t, websocket.JSON.Receive(conn, &change))
+	assert.Equal(t, state.Volume, change.Type)
+	assert.Equal(t, float64(5), change.Value)
+}
+
+func readLines(reader *bufio.Reader, count int) string {
+	lines := ""
+	for i := 0; i < count; i++ {
+		line, _ := reader.ReadString('\n')
+		lines += line
+	}
+	return lines
+}
+
+func TestMetrics(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	speakers := []*musiccast.Speaker{{ID: "1", FriendlyName: `Kitchen "K"`, DeviceType: "WX-021", Power: musiccast.On,
+		Volume: testhelper.Ptr(int8(30)), MaxVolume: 60, Mute: testhelper.Ptr(false), Input: musiccast.CdInput,
+		Cd: &musiccast.CdPlayInfo{Playback: musiccast.Play}}}
+	metrics := musiccast.GetMetrics()
+	metrics.LastSeen = map[string]time.Time{"1": now.Add(-1500 * time.Millisecond)}
+	metrics.Latency = map[string]musiccast.Histogram{"main/getStatus": {Buckets: []uint64{0, 1, 1, 1, 1, 1, 1, 1, 1, 1}, Count: 2, Sum: 10.02}}
+	metrics.Errors = map[musiccast.ErrorKey]uint64{{Speaker: "1", Code: 3}: 2}
+	metrics.Discovery = map[string]uint64{musiccast.DiscoveryMusicCast: 1, musiccast.DiscoveryIgnored: 4}
+
+	out := strings.Builder{}
+	writeMetrics(&out, speakers, metrics, now)
+	text := out.String()
+	for _, line := range []string{
+		"# TYPE ymc_speaker_volume gauge",
+		`ymc_speaker_info{speaker="1",name="Kitchen \"K\"",model="WX-021"} 1`,
+		`ymc_speaker_power{speaker="1",power="on"} 1`,
+		`ymc_speaker_volume{speaker="1"} 30`,
+		`ymc_speaker_muted{speaker="1"} 0`,
+		`ymc_speaker_input{speaker="1",input="cd"} 1`,
+		`ymc_speaker_playback{speaker="1",playback="play"} 1`,
+		`ymc_speaker_last_seen_timestamp_seconds{speaker="1"} 1.6999999985e+09`,
+		`ymc_yxc_request_duration_seconds_bucket{endpoint="main/getStatus",le="0.025"} 1`,
+		`ymc_yxc_request_duration_seconds_bucket{endpoint="main/getStatus",le="+Inf"} 2`,
+		`ymc_yxc_request_duration_seconds_count{endpoint="main/getStatus"} 2`,
+		`ymc_yxc_errors_total{speaker="1",code="3"} 2`,
+		`ymc_ssdp_discovered_total{result="ignored"} 4`,
+	} {
+		assert.Contains(t, text, line+"\n")
+	}
+
+	server, _ := newTestServer(t)
+	server.Handle("/metrics", Metrics(server.store))
+	response := request(server, http.MethodGet, "/metrics", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `ymc_speaker_power{speaker="1",power="standby"} 1`)
+}
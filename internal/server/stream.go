@@ -0,0 +1,145 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/atamanroman/ymc/internal/state"
+	"golang.org/x/net/websocket"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// keeps proxies from closing idle streams
+const streamHeartbeat = 30 * time.Second
+
+// handleEvents streams the changes as Server-Sent Events with epoch-seq as ID. Clients resume with the
+// Last-Event-ID header, which browsers send on reconnect, or with ?since=epoch-seq.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+	since := r.Header.Get("Last-Event-ID")
+	if since == "" {
+		since = r.URL.Query().Get("since")
+	}
+	epoch, after, err := parseCursor(since)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	backlog, changes, cancel := s.store.Resume(epoch, after)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	for _, change := range backlog {
+		writeEvent(w, change)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case change, ok := <-changes:
+			if !ok {
+				// dropped for being too slow, the client reconnects and resumes
+				return
+			}
+			writeEvent(w, change)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, change state.Change) {
+	data, err := json.Marshal(change)
+	if err != nil {
+		log.Warn("Failed to marshal change:", err)
+		return
+	}
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", cursor(change), change.Type, data)
+}
+
+// handleWebSocket streams the changes as JSON text messages, clients resume with ?since=epoch-seq
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	epoch, after, err := parseCursor(r.URL.Query().Get("since"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ws := websocket.Server{
+		// accept clients without Origin, like scripts and wall panels
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			s.streamWebSocket(conn, epoch, after)
+		},
+	}
+	ws.ServeHTTP(w, r)
+}
+
+func (s *Server) streamWebSocket(conn *websocket.Conn, epoch string, after uint64) {
+	backlog, changes, cancel := s.store.Resume(epoch, after)
+	defer cancel()
+
+	// the client doesn't send anything, reading only notices when it's gone
+	closed := make(chan struct{})
+	go func() {
+		var ignored string
+		for websocket.Message.Receive(conn, &ignored) == nil {
+		}
+		close(closed)
+	}()
+
+	for _, change := range backlog {
+		if websocket.JSON.Send(conn, change) != nil {
+			return
+		}
+	}
+	for {
+		select {
+		case change, ok := <-changes:
+			if !ok || websocket.JSON.Send(conn, change) != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// cursor is where a client resumes after the change
+func cursor(change state.Change) string {
+	return change.Epoch + "-" + strconv.FormatUint(change.Seq, 10)
+}
+
+// parseCursor reads epoch-seq, a seq without epoch can't be resumed and gets the current speakers
+func parseCursor(cursor string) (string, uint64, error) {
+	if cursor == "" {
+		return "", 0, nil
+	}
+	epoch, seq, found := strings.Cut(cursor, "-")
+	if !found {
+		epoch, seq = "", cursor
+	}
+	after, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return "", 0, badRequest{fmt.Errorf("invalid cursor %q", cursor)}
+	}
+	return epoch, after, nil
+}
@@ -8,12 +8,18 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
+	"strings"
+	"time"
 )
 
 var log = logging.Instance
 
+// devices which accept the connection but never answer must not block the discovery
+var httpClient = &http.Client{Timeout: 5 * time.Second}
+
 func init() {
 	multicast2.InterfacesProvider = func() []net.Interface {
 		return Interfaces
@@ -27,11 +33,12 @@ var Interfaces []net.Interface
 type MediaRenderer struct {
 	XMLName xml.Name `xml:"root"`
 	Device  struct {
-		UDN              string `xml:"UDN"`
-		FriendlyName     string `xml:"friendlyName"`
-		ModelDescription string `xml:"modelDescription"`
-		ModelName        string `xml:"modelName"`
-		Manufacturer     string `xml:"manufacturer"`
+		UDN              string        `xml:"UDN"`
+		FriendlyName     string        `xml:"friendlyName"`
+		ModelDescription string        `xml:"modelDescription"`
+		ModelName        string        `xml:"modelName"`
+		Manufacturer     string        `xml:"manufacturer"`
+		ServiceList      []UpnpService `xml:"serviceList>service"`
 	} `xml:"device"`
 	XDevice struct {
 		UrlBase    string `xml:"X_URLBase"`
@@ -39,6 +46,65 @@ type MediaRenderer struct {
 	} `xml:"X_device"`
 }
 
+// UpnpService is a UPnP service of the device like AVTransport, the URLs are absolute
+type UpnpService struct {
+	ServiceType string `xml:"serviceType"`
+	ServiceId   string `xml:"serviceId"`
+	ScpdUrl     string `xml:"SCPDURL"`
+	ControlUrl  string `xml:"controlURL"`
+	EventSubUrl string `xml:"eventSubURL"`
+}
+
+// Service returns the service whose type starts with the prefix like urn:schemas-upnp-org:service:AVTransport:,
+// which ignores the version
+func (s *MediaRenderer) Service(typePrefix string) (UpnpService, bool) {
+	for _, service := range s.Device.ServiceList {
+		if strings.HasPrefix(service.ServiceType, typePrefix) {
+			return service, true
+		}
+	}
+	return UpnpService{}, false
+}
+
+// ServiceDescription is the SCPD of a UPnP service, which lists its actions
+type ServiceDescription struct {
+	XMLName    xml.Name `xml:"scpd"`
+	ActionList []struct {
+		Name         string `xml:"name"`
+		ArgumentList []struct {
+			Name      string `xml:"name"`
+			Direction string `xml:"direction"`
+		} `xml:"argumentList>argument"`
+	} `xml:"actionList>action"`
+}
+
+// Actions returns the names of the actions
+func (d *ServiceDescription) Actions() []string {
+	actions := make([]string, 0, len(d.ActionList))
+	for _, action := range d.ActionList {
+		actions = append(actions, action.Name)
+	}
+	return actions
+}
+
+func GetServiceDescription(service UpnpService) (*ServiceDescription, error) {
+	resp, err := httpClient.Get(service.ScpdUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	all, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	description := ServiceDescription{}
+	err = xml.Unmarshal(all, &description)
+	if err != nil {
+		return nil, err
+	}
+	return &description, nil
+}
+
 func (s *MediaRenderer) String() string {
 	str, err := json.Marshal(s)
 	if err != nil {
@@ -108,7 +174,7 @@ func SetMulticastRecvAddrIPv4(addr string) error {
 
 func GetMediaRenderer(device *Service) (*MediaRenderer, error) {
 	log.Debugf("Fetch SSDP info for %v from %v", device.USN, device.Location)
-	resp, err := http.Get(device.Location)
+	resp, err := httpClient.Get(device.Location)
 	if err != nil {
 		return nil, err
 	}
@@ -123,9 +189,37 @@ func GetMediaRenderer(device *Service) (*MediaRenderer, error) {
 	if err != nil {
 		return nil, err
 	}
+	resolveServiceUrls(&ssdpService, device.Location)
 	return &ssdpService, nil
 }
 
+// resolveServiceUrls makes the service URLs absolute, they are relative to the description
+func resolveServiceUrls(renderer *MediaRenderer, location string) {
+	base, err := url.Parse(location)
+	if err != nil {
+		return
+	}
+	resolve := func(ref string) string {
+		if ref == "" {
+			return ""
+		}
+		// some devices leave out the leading slash
+		if !strings.Contains(ref, "://") && !strings.HasPrefix(ref, "/") {
+			ref = "/" + ref
+		}
+		resolved, err := base.Parse(ref)
+		if err != nil {
+			return ref
+		}
+		return resolved.String()
+	}
+	for i, service := range renderer.Device.ServiceList {
+		renderer.Device.ServiceList[i].ScpdUrl = resolve(service.ScpdUrl)
+		renderer.Device.ServiceList[i].ControlUrl = resolve(service.ControlUrl)
+		renderer.Device.ServiceList[i].EventSubUrl = resolve(service.EventSubUrl)
+	}
+}
+
 // SetMulticastSendAddrIPv4 updates a UDP address to send multicast packets.
 // This never fail now.
 func SetMulticastSendAddrIPv4(addr string) error {
@@ -0,0 +1,174 @@
+package state
+
+import (
+	"github.com/atamanroman/ymc/musiccast"
+	"time"
+)
+
+type ChangeType string
+
+const (
+	// Added is sent for new speakers and speakers which are back online, the value is the Summary
+	Added ChangeType = "added"
+	// Removed is sent for speakers which went offline
+	Removed  ChangeType = "removed"
+	Power    ChangeType = "power"
+	Volume   ChangeType = "volume"
+	Mute     ChangeType = "mute"
+	Input    ChangeType = "input"
+	Name     ChangeType = "name"
+	PlayInfo ChangeType = "play_info"
+	// Reset tells a subscriber that the changes it asked for are gone, the Added changes which follow are the current state
+	Reset ChangeType = "reset"
+)
+
+// how many changes to keep for subscribers which resume after a reconnect
+const changeHistorySize = 1024
+
+// how many changes a subscriber may lag behind before it's dropped
+const subscriberBuffer = 256
+
+// Change is a normalized change of a speaker, Seq increases with every change of the store. Epoch
+// identifies the store, sequences of another epoch (like before a restart) can't be resumed.
+type Change struct {
+	Epoch   string     `json:"epoch"`
+	Seq     uint64     `json:"seq"`
+	Type    ChangeType `json:"type"`
+	Speaker string     `json:"speaker"`
+	Time    time.Time  `json:"time"`
+	Value   any        `json:"value,omitempty"`
+}
+
+type InputValue struct {
+	Input     string `json:"input"`
+	InputName string `json:"input_name"`
+}
+
+type PlayInfoValue struct {
+	Playback musiccast.Playback `json:"playback"`
+	Track    string             `json:"track"`
+	Artist   string             `json:"artist"`
+	Album    string             `json:"album"`
+}
+
+// diff lists the changes from before to after, before is nil for new speakers
+func diff(before *Summary, after Summary) []Change {
+	change := func(changeType ChangeType, value any) Change {
+		return Change{Type: changeType, Speaker: after.Id, Value: value}
+	}
+	if before == nil || before.Online != after.Online {
+		if after.Online {
+			return []Change{change(Added, after)}
+		}
+		if before == nil {
+			return nil
+		}
+		return []Change{change(Removed, nil)}
+	}
+
+	changes := make([]Change, 0)
+	if before.Power != after.Power {
+		changes = append(changes, change(Power, after.Power))
+	}
+	if after.Volume != nil && (before.Volume == nil || *before.Volume != *after.Volume) {
+		changes = append(changes, change(Volume, *after.Volume))
+	}
+	if after.Mute != nil && (before.Mute == nil || *before.Mute != *after.Mute) {
+		changes = append(changes, change(Mute, *after.Mute))
+	}
+	if before.Input != after.Input || before.InputName != after.InputName {
+		changes = append(changes, change(Input, InputValue{after.Input, after.InputName}))
+	}
+	if before.Name != after.Name {
+		changes = append(changes, change(Name, after.Name))
+	}
+	if playInfo(*before) != playInfo(after) {
+		changes = append(changes, change(PlayInfo, playInfo(after)))
+	}
+	return changes
+}
+
+func playInfo(summary Summary) PlayInfoValue {
+	return PlayInfoValue{summary.Playback, summary.Track, summary.Artist, summary.Album}
+}
+
+// publish numbers the changes, keeps them for resuming subscribers and sends them to the subscribers.
+// Must be called with the lock held.
+func (s *Store) publish(changes []Change) {
+	now := time.Now()
+	for _, change := range changes {
+		s.seq++
+		change.Epoch = s.epoch
+		change.Seq = s.seq
+		change.Time = now
+		s.history = append(s.history, change)
+		if len(s.history) > changeHistorySize {
+			s.history = s.history[len(s.history)-changeHistorySize:]
+		}
+		for id, ch := range s.subscribers {
+			select {
+			case ch <- change:
+			default:
+				// too slow, the subscriber has to resume from its last sequence
+				log.Warn("Drop slow change subscriber", id)
+				close(ch)
+				delete(s.subscribers, id)
+			}
+		}
+	}
+}
+
+// Subscribe is Resume with the store's own epoch, for subscribers which live as long as the store
+func (s *Store) Subscribe(after uint64) (backlog []Change, changes <-chan Change, cancel func()) {
+	return s.Resume(s.epoch, after)
+}
+
+// Resume returns the changes after the sequence and a channel for the following ones. If these changes
+// are no longer known or are of another epoch, the backlog is a Reset followed by the current speakers as
+// Added. Use 0 to start with the current speakers. The channel is closed by cancel or if the subscriber
+// falls too far behind.
+func (s *Store) Resume(epoch string, after uint64) (backlog []Change, changes <-chan Change, cancel func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	resumable := after > 0 && epoch == s.epoch && after <= s.seq && (after >= s.oldestSeq()-1)
+	if resumable {
+		for _, change := range s.history {
+			if change.Seq > after {
+				backlog = append(backlog, change)
+			}
+		}
+	} else {
+		now := time.Now()
+		if after > 0 {
+			backlog = append(backlog, Change{Epoch: s.epoch, Seq: s.seq, Type: Reset, Time: now})
+		}
+		for _, spkr := range s.sortedLocked() {
+			summary := Summarize(spkr)
+			if summary.Online {
+				backlog = append(backlog, Change{Epoch: s.epoch, Seq: s.seq, Type: Added, Speaker: summary.Id, Time: now, Value: summary})
+			}
+		}
+	}
+
+	ch := make(chan Change, subscriberBuffer)
+	s.nextSubscriber++
+	id := s.nextSubscriber
+	s.subscribers[id] = ch
+	return backlog, ch, func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if _, ok := s.subscribers[id]; ok {
+			close(ch)
+			delete(s.subscribers, id)
+		}
+	}
+}
+
+// oldestSeq is the sequence of the oldest change in the history or the next one if there is none
+func (s *Store) oldestSeq() uint64 {
+	if len(s.history) == 0 {
+		return s.seq + 1
+	}
+	return s.history[0].Seq
+}
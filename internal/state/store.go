@@ -0,0 +1,113 @@
+// Package state keeps the known speakers in sync with the updates of musiccast.StartScan
+package state
+
+import (
+	"github.com/atamanroman/ymc/internal/logging"
+	"github.com/atamanroman/ymc/musiccast"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var log = logging.Instance
+
+// Store holds the known speakers by ID, publishes their changes and is safe for concurrent use
+type Store struct {
+	lock     sync.RWMutex
+	speakers map[string]*musiccast.Speaker
+
+	epoch          string
+	seq            uint64
+	history        []Change
+	subscribers    map[int]chan Change
+	nextSubscriber int
+}
+
+func NewStore() *Store {
+	return &Store{speakers: make(map[string]*musiccast.Speaker), subscribers: make(map[int]chan Change),
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36)}
+}
+
+// Apply merges the update into the known speakers: full updates replace the speaker, partial ones
+// are merged with UpdateValues and ignored if the speaker is unknown. Returns false if it was ignored.
+func (s *Store) Apply(update *musiccast.Speaker) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	known := s.speakers[update.ID]
+	if known == nil {
+		if update.PartialUpdate {
+			log.Debug("Ignore event for unknown MusicCast speaker")
+			return false
+		}
+		log.Info("Found new MusicCast speaker", update)
+		s.speakers[update.ID] = update
+		s.publish(diff(nil, Summarize(update)))
+		return true
+	}
+
+	log.Debug("Got MusicCast speaker update", update)
+	merged := update
+	if update.PartialUpdate {
+		// copy on write, so snapshots handed out earlier don't change
+		copied := *known
+		update.UpdateValues(&copied)
+		merged = &copied
+	}
+	s.speakers[update.ID] = merged
+	before := Summarize(known)
+	s.publish(diff(&before, Summarize(merged)))
+	return true
+}
+
+// Get returns the speaker with the given ID or nil if it's unknown
+func (s *Store) Get(id string) *musiccast.Speaker {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.speakers[id]
+}
+
+// Find returns the speaker whose ID or name (ignoring case) matches
+func (s *Store) Find(name string) *musiccast.Speaker {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if spkr, ok := s.speakers[name]; ok {
+		return spkr
+	}
+	for _, spkr := range s.speakers {
+		if strings.EqualFold(spkr.FriendlyName, name) {
+			return spkr
+		}
+	}
+	return nil
+}
+
+// Snapshot returns the current speakers by ID, the speakers must not be modified
+func (s *Store) Snapshot() map[string]*musiccast.Speaker {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	snapshot := make(map[string]*musiccast.Speaker, len(s.speakers))
+	for id, spkr := range s.speakers {
+		snapshot[id] = spkr
+	}
+	return snapshot
+}
+
+// Sorted returns the current speakers ordered by name
+func (s *Store) Sorted() []*musiccast.Speaker {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.sortedLocked()
+}
+
+func (s *Store) sortedLocked() []*musiccast.Speaker {
+	sorted := make([]*musiccast.Speaker, 0, len(s.speakers))
+	for _, spkr := range s.speakers {
+		sorted = append(sorted, spkr)
+	}
+	sort.Slice(sorted, func(a int, b int) bool {
+		return sorted[a].FriendlyName < sorted[b].FriendlyName
+	})
+	return sorted
+}
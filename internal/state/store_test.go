@@ -0,0 +1,127 @@
+package state
+
+import (
+	"github.com/atamanroman/ymc/internal/testhelper"
+	"github.com/atamanroman/ymc/musiccast"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestStoreApply(t *testing.T) {
+	store := NewStore()
+	assert.False(t, store.Apply(&musiccast.Speaker{ID: "1", PartialUpdate: true}))
+	assert.Nil(t, store.Get("1"))
+
+	assert.True(t, store.Apply(&musiccast.Speaker{ID: "1", FriendlyName: "Kitchen", Power: musiccast.Standby, Volume: testhelper.Ptr(int8(10))}))
+	before := store.Get("1")
+
+	assert.True(t, store.Apply(&musiccast.Speaker{ID: "1", Power: musiccast.On, PartialUpdate: true}))
+	after := store.Get("1")
+	assert.Equal(t, musiccast.On, after.Power)
+	assert.Equal(t, int8(10), *after.Volume)
+	// snapshots handed out earlier are not modified
+	assert.Equal(t, musiccast.Standby, before.Power)
+
+	assert.True(t, store.Apply(&musiccast.Speaker{ID: "2", FriendlyName: "Bath"}))
+	assert.Equal(t, "Kitchen", store.Find("kitchen").FriendlyName)
+	assert.Equal(t, "Bath", store.Find("2").FriendlyName)
+	assert.Nil(t, store.Find("Living room"))
+	assert.Len(t, store.Snapshot(), 2)
+	assert.Equal(t, "Bath", store.Sorted()[0].FriendlyName)
+}
+
+func TestSummarize(t *testing.T) {
+	speaker := musiccast.Speaker{ID: "1", FriendlyName: "Kitchen", DeviceType: "WX-021", Power: musiccast.On,
+		Volume: testhelper.Ptr(int8(30)), MaxVolume: 60, Input: "net_radio", InputText: "Radio",
+		PlayInfo: &musiccast.PlayInfo{Input: "net_radio", Playback: musiccast.Play, Track: "News"},
+		Cd:       &musiccast.CdPlayInfo{Playback: musiccast.Stop}}
+
+	summary := Summarize(&speaker)
+	assert.Equal(t, 30, *summary.Volume)
+	assert.Equal(t, 60, summary.MaxVolume)
+	assert.Equal(t, musiccast.Play, summary.Playback)
+	assert.Equal(t, "News", summary.Track)
+
+	speaker.Input = musiccast.CdInput
+	assert.Equal(t, musiccast.Stop, Summarize(&speaker).Playback)
+
+	speaker.Input = "hdmi"
+	assert.Equal(t, musiccast.Playback(""), Summarize(&speaker).Playback)
+}
+
+func TestDiff(t *testing.T) {
+	before := Summary{Id: "1", Power: musiccast.Standby, Volume: testhelper.Ptr(10), Online: true}
+	after := before
+	assert.Empty(t, diff(&before, after))
+
+	after.Power = musiccast.On
+	after.Volume = testhelper.Ptr(12)
+	after.Input = "cd"
+	changes := diff(&before, after)
+	assert.Len(t, changes, 3)
+	assert.Equal(t, Power, changes[0].Type)
+	assert.Equal(t, 12, changes[1].Value)
+	assert.Equal(t, InputValue{"cd", ""}, changes[2].Value)
+
+	after.Online = false
+	assert.Equal(t, Removed, diff(&before, after)[0].Type)
+	assert.Equal(t, Added, diff(&after, before)[0].Type)
+	assert.Equal(t, Added, diff(nil, before)[0].Type)
+}
+
+func TestSubscribe(t *testing.T) {
+	store := NewStore()
+	store.Apply(&musiccast.Speaker{ID: "1", FriendlyName: "Kitchen"})
+
+	backlog, changes, cancel := store.Subscribe(0)
+	assert.Len(t, backlog, 1)
+	assert.Equal(t, Added, backlog[0].Type)
+	assert.Equal(t, uint64(1), backlog[0].Seq)
+
+	store.Apply(&musiccast.Speaker{ID: "1", Power: musiccast.On, PartialUpdate: true})
+	change := <-changes
+	assert.Equal(t, Power, change.Type)
+	assert.Equal(t, uint64(2), change.Seq)
+	cancel()
+	_, ok := <-changes
+	assert.False(t, ok)
+
+	// resume after a reconnect
+	store.Apply(&musiccast.Speaker{ID: "1", Mute: testhelper.Ptr(true), PartialUpdate: true})
+	backlog, _, cancel = store.Subscribe(2)
+	defer cancel()
+	assert.Len(t, backlog, 1)
+	assert.Equal(t, Mute, backlog[0].Type)
+	assert.Equal(t, uint64(3), backlog[0].Seq)
+
+	// unknown sequence
+	backlog, _, cancel = store.Subscribe(42)
+	defer cancel()
+	assert.Equal(t, Reset, backlog[0].Type)
+	assert.Equal(t, Added, backlog[1].Type)
+	assert.Equal(t, uint64(3), backlog[1].Seq)
+
+	// known sequence of another epoch, e.g. after a restart of the server
+	backlog, _, cancel = store.Resume("other", 2)
+	defer cancel()
+	assert.Equal(t, Reset, backlog[0].Type)
+	assert.Equal(t, change.Epoch, backlog[0].Epoch)
+	backlog, _, cancel = store.Resume(change.Epoch, 2)
+	defer cancel()
+	assert.Equal(t, Mute, backlog[0].Type)
+}
+
+func TestSubscribeSlow(t *testing.T) {
+	store := NewStore()
+	store.Apply(&musiccast.Speaker{ID: "1", FriendlyName: "Kitchen"})
+	_, changes, cancel := store.Subscribe(0)
+	defer cancel()
+	for i := 0; i <= subscriberBuffer; i++ {
+		store.Apply(&musiccast.Speaker{ID: "1", Volume: testhelper.Ptr(int8(i % 2)), PartialUpdate: true})
+	}
+	count := 0
+	for range changes {
+		count++
+	}
+	assert.Equal(t, subscriberBuffer, count)
+}
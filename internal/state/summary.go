@@ -0,0 +1,62 @@
+package state
+
+import (
+	"github.com/atamanroman/ymc/musiccast"
+)
+
+// Summary is the public view of a speaker for the gateways, without the raw API details
+type Summary struct {
+	Id        string          `json:"id"`
+	Name      string          `json:"name"`
+	Model     string          `json:"model"`
+	Power     musiccast.Power `json:"power"`
+	Volume    *int            `json:"volume"`
+	MaxVolume int             `json:"max_volume"`
+	Mute      *bool           `json:"mute"`
+	Input     string          `json:"input"`
+	InputName string          `json:"input_name"`
+	Inputs    []string        `json:"inputs,omitempty"`
+	// what the CD or a netusb input plays, empty for other inputs
+	Playback musiccast.Playback `json:"playback,omitempty"`
+	Track    string             `json:"track,omitempty"`
+	Artist   string             `json:"artist,omitempty"`
+	Album    string             `json:"album,omitempty"`
+	Updating bool               `json:"updating"`
+	// false if the speaker stopped answering
+	Online bool `json:"online"`
+}
+
+func Summarize(speaker *musiccast.Speaker) Summary {
+	summary := Summary{
+		Id:        speaker.ID,
+		Name:      speaker.FriendlyName,
+		Model:     speaker.DeviceType,
+		Power:     speaker.Power,
+		MaxVolume: int(speaker.MaxVolume),
+		Mute:      speaker.Mute,
+		Input:     speaker.Input,
+		InputName: speaker.InputText,
+		Updating:  speaker.IsUpdating(),
+		Online:    speaker.IsOnline(),
+	}
+	if speaker.Volume != nil {
+		volume := int(*speaker.Volume)
+		summary.Volume = &volume
+	}
+	if speaker.Features != nil && speaker.Features.MainZone() != nil {
+		summary.Inputs = speaker.Features.MainZone().InputList
+	}
+	switch {
+	case speaker.Input == musiccast.CdInput && speaker.Cd != nil:
+		summary.Playback = speaker.Cd.Playback
+		summary.Track = speaker.Cd.Track
+		summary.Artist = speaker.Cd.Artist
+		summary.Album = speaker.Cd.Album
+	case speaker.PlayInfo != nil && speaker.PlayInfo.Input == speaker.Input:
+		summary.Playback = speaker.PlayInfo.Playback
+		summary.Track = speaker.PlayInfo.Track
+		summary.Artist = speaker.PlayInfo.Artist
+		summary.Album = speaker.PlayInfo.Album
+	}
+	return summary
+}
@@ -0,0 +1,166 @@
+package tui
+
+import (
+	"fmt"
+	"github.com/atamanroman/ymc/musiccast"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"image"
+	"image/color"
+)
+
+// albumArt draws an image with half blocks, every cell shows two pixels stacked on top of each other
+type albumArt struct {
+	*tview.Box
+	image image.Image
+	// identifies the album art which is shown or loading
+	key string
+}
+
+func newAlbumArt() *albumArt {
+	return &albumArt{Box: tview.NewBox().SetBackgroundColor(theme.Background)}
+}
+
+func (a *albumArt) Draw(screen tcell.Screen) {
+	a.Box.DrawForSubclass(screen, a)
+	if a.image == nil {
+		return
+	}
+	x, y, width, height := a.GetInnerRect()
+	pixels := scaleImage(a.image, width, height*2)
+	trueColor := screen.Colors() >= tview.TrueColor
+	for row := 0; row < height; row++ {
+		for col := 0; col < width; col++ {
+			style := tcell.StyleDefault.
+				Foreground(cellColor(pixels[row*2][col], trueColor)).
+				Background(cellColor(pixels[row*2+1][col], trueColor))
+			screen.SetContent(x+col, y+row, '▀', nil, style)
+		}
+	}
+}
+
+// show loads the album art of the speaker's play info in the background unless it's already shown, nil clears it
+func (a *albumArt) show(speaker *musiccast.Speaker) {
+	if speaker == nil || speaker.PlayInfo == nil || speaker.PlayInfo.AlbumartUrl == "" {
+		a.key = ""
+		a.image = nil
+		return
+	}
+	info := *speaker.PlayInfo
+	key := fmt.Sprintf("%s/%d/%s", speaker.ID, info.AlbumartId, info.AlbumartUrl)
+	if key == a.key {
+		return
+	}
+	a.key = key
+	a.image = nil
+	target := *speaker
+	go func() {
+		art, err := musiccast.AlbumArt(&target, info)
+		if err != nil {
+			log.Warn("Failed to load album art:", err)
+			App.QueueUpdateDraw(func() {
+				// free the space and try again with the next update
+				if a.key == key {
+					a.key = ""
+					playPanel.ResizeItem(a, 0, 0)
+				}
+			})
+			return
+		}
+		App.QueueUpdateDraw(func() {
+			// the track may have changed while loading
+			if a.key == key {
+				a.image = art
+			}
+		})
+	}()
+}
+
+// scaleImage averages the image down to width x height pixels
+func scaleImage(img image.Image, width int, height int) [][]color.RGBA {
+	pixels := make([][]color.RGBA, height)
+	bounds := img.Bounds()
+	for y := 0; y < height; y++ {
+		pixels[y] = make([]color.RGBA, width)
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(bounds.Min.Y+(y+1)*bounds.Dy()/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(bounds.Min.X+(x+1)*bounds.Dx()/width, x0+1)
+			var r, g, b, count uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, _ := img.At(sx, sy).RGBA()
+					r += pr >> 8
+					g += pg >> 8
+					b += pb >> 8
+					count++
+				}
+			}
+			pixels[y][x] = color.RGBA{uint8(r / count), uint8(g / count), uint8(b / count), 255}
+		}
+	}
+	return pixels
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func cellColor(c color.RGBA, trueColor bool) tcell.Color {
+	if trueColor {
+		return tcell.NewRGBColor(int32(c.R), int32(c.G), int32(c.B))
+	}
+	return color256(c)
+}
+
+// the levels of the 6x6x6 color cube of 256 color terminals
+var cubeLevels = []int{0, 95, 135, 175, 215, 255}
+
+// color256 maps the color to the closest one of the xterm color cube or grayscale ramp
+func color256(c color.RGBA) tcell.Color {
+	r, ri := nearestCubeLevel(int(c.R))
+	g, gi := nearestCubeLevel(int(c.G))
+	b, bi := nearestCubeLevel(int(c.B))
+	cube := 16 + 36*ri + 6*gi + bi
+
+	// grayscale ramp 232..255 from 8 to 238 in steps of 10
+	avg := (int(c.R) + int(c.G) + int(c.B)) / 3
+	grayIndex := (avg - 3) / 10
+	if grayIndex < 0 {
+		grayIndex = 0
+	} else if grayIndex > 23 {
+		grayIndex = 23
+	}
+	gray := 8 + grayIndex*10
+
+	if distance(c, gray, gray, gray) < distance(c, r, g, b) {
+		return tcell.PaletteColor(232 + grayIndex)
+	}
+	return tcell.PaletteColor(cube)
+}
+
+func nearestCubeLevel(value int) (int, int) {
+	best := 0
+	for i, level := range cubeLevels {
+		if abs(level-value) < abs(cubeLevels[best]-value) {
+			best = i
+		}
+	}
+	return cubeLevels[best], best
+}
+
+func distance(c color.RGBA, r int, g int, b int) int {
+	dr, dg, db := int(c.R)-r, int(c.G)-g, int(c.B)-b
+	return dr*dr + dg*dg + db*db
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
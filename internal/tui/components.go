@@ -7,21 +7,16 @@ import (
 	"strings"
 )
 
-const (
-	transparent = tcell.ColorDefault
-	light       = tcell.ColorLightGray
-	dark        = tcell.ColorGray
-	black       = tcell.ColorBlack
-	good        = tcell.ColorGrey
-	bad         = tcell.ColorRed
-	accent      = tcell.ColorHotPink
-)
-
 func createFrame() *tview.Frame {
-	frame := tview.NewFrame(speakerList)
-	frame.AddText("Speakers", true, 0, accent)
-	style(frame, "ymc")
-	return frame
+	mainFrame = tview.NewFrame(mainFlex)
+	style(mainFrame, "ymc")
+	styleFrameText()
+	return mainFrame
+}
+
+func styleFrameText() {
+	mainFrame.Clear()
+	mainFrame.AddText("Speakers", true, 0, theme.Title)
 }
 
 func createSpeakerList() *tview.List {
@@ -30,109 +25,230 @@ func createSpeakerList() *tview.List {
 	devices.SetDoneFunc(func() {
 		App.Stop()
 	})
-	devices.SetSelectedFunc(func(index int, friendlyName string, _ string, _ rune) {
-		speaker := knownSpeakers[index]
-		var action Action
-		if speaker.Power == musiccast.On {
-			action = PowerOff
-		} else {
-			action = PowerOn
-		}
-		CommandChan <- SpeakerCommand{Id: speaker.ID, Action: action}
+	devices.SetChangedFunc(func(_ int, _ string, _ string, _ rune) {
+		updatePlayPanel()
 	})
 	devices.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		index := devices.GetCurrentItem()
-		speakerId := knownSpeakers[index].ID
-		isShift := event.Modifiers()&tcell.ModShift > 0
-
-		switch event.Key() {
-		case tcell.KeyLeft:
-			value := 5
-			if isShift {
-				value = 1
-			}
-			CommandChan <- SpeakerCommand{speakerId, VolumeDown, value}
-			return nil
-		case tcell.KeyRight:
-			value := 5
-			if isShift {
-				value = 1
+		speaker := selectedSpeaker()
+		if speaker == nil {
+			return event
+		}
+
+		action := keymap[eventKey(event)]
+		switch action {
+		case PowerToggle:
+			action = PowerOn
+			if speaker.Power == musiccast.On {
+				action = PowerOff
 			}
-			CommandChan <- SpeakerCommand{speakerId, VolumeUp, value}
-			return nil
-		case tcell.KeyRune:
-			switch event.Rune() {
-			case 'm':
-				CommandChan <- SpeakerCommand{speakerId, MuteToggle, nil}
+			CommandChan <- SpeakerCommand{Id: speaker.ID, Action: action}
+		case VolumeUp, VolumeDown:
+			CommandChan <- SpeakerCommand{speaker.ID, action, 5}
+		case VolumeUpFine:
+			CommandChan <- SpeakerCommand{speaker.ID, VolumeUp, 1}
+		case VolumeDownFine:
+			CommandChan <- SpeakerCommand{speaker.ID, VolumeDown, 1}
+		case MuteToggle, SleepCycle:
+			CommandChan <- SpeakerCommand{speaker.ID, action, nil}
+		case ShowSound:
+			showSpeakerPopup("sound", speaker)
+		case ShowTone:
+			showSpeakerPopup("tone", speaker)
+		case ShowRename:
+			showRenameForm(speaker)
+		case ShowSettings:
+			showSpeakerPopup("settings", speaker)
+		case ShowBluetooth:
+			showSpeakerPopup("bluetooth", speaker)
+		case ShowAlarm:
+			showSpeakerPopup("alarm", speaker)
+		case ShowScenes:
+			showScenePicker()
+		case ShowSleepTimer:
+			showSleepForm(speaker)
+		default:
+			if cdActions[action] && speaker.Input == musiccast.CdInput {
+				CommandChan <- SpeakerCommand{speaker.ID, action, nil}
 				return nil
 			}
+			return event
 		}
-		return event
+		return nil
 	})
 
 	return devices
 }
 
+// createPlayPanel shows what the selected speaker plays, with album art if there is any
+func createPlayPanel() *tview.Flex {
+	playText = tview.NewTextView()
+	albumArtView = newAlbumArt()
+	// one column gap to the text
+	albumArtView.SetBorderPadding(0, 0, 0, 1)
+
+	panel := tview.NewFlex().
+		AddItem(albumArtView, 0, 0, false).
+		AddItem(playText, 0, 1, false)
+	panel.SetBorder(true)
+	panel.SetBorderPadding(0, 0, 1, 1)
+	playPanel = panel
+	stylePlayPanel()
+	return panel
+}
+
+func stylePlayPanel() {
+	playText.SetTextColor(theme.Text)
+	playText.SetBackgroundColor(theme.Background)
+	albumArtView.SetBackgroundColor(theme.Background)
+	playPanel.SetBorderColor(theme.Border)
+	playPanel.SetTitleColor(theme.Title)
+	playPanel.SetBackgroundColor(theme.Background)
+}
+
+// createHelpDialog lists the keys of the active keymap
 func createHelpDialog() *tview.Flex {
-	// 19 chars wide
-	help := strings.TrimSpace(`
-RET     Turn on/off
-→        Volume up*
-←      Volume down*
-m       Toggle mute
-
-?         Show help
-q              Quit
-
-*Shift: small steps
-`)
-	helpText := tview.NewTextView().SetText(help)
-
-	style(helpText, "Help (?)")
-	helpText.SetDoneFunc(func(_ tcell.Key) {
-		mainLayout.SwitchToPage("main")
+	help := helpText(keymap)
+	helpView := tview.NewTextView().SetText(help)
+
+	title := "Help"
+	if keys := keymap.keys(ShowHelp); len(keys) > 0 {
+		title += " (" + keyLabel(keys[0]) + ")"
+	}
+	style(helpView, title)
+	helpView.SetDoneFunc(func(_ tcell.Key) {
+		closePopup("help")
 	})
 
-	// center the text
-	helpFlex := tview.NewFlex().
+	// border and padding
+	width := 0
+	lines := strings.Split(help, "\n")
+	for _, line := range lines {
+		width = max(width, tview.TaggedStringWidth(line))
+	}
+	return centered(helpView, width+4, len(lines)+4)
+}
+
+// centered wraps the primitive in a box of the given size in the middle of the screen
+func centered(primitive tview.Primitive, width int, height int) *tview.Flex {
+	return tview.NewFlex().
 		AddItem(nil, 0, 1, false).
 		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
 			AddItem(nil, 0, 1, false).
-			AddItem(helpText, 13, 1, true).
-			AddItem(nil, 0, 1, false), 23, 1, true).
+			AddItem(primitive, height, 1, true).
+			AddItem(nil, 0, 1, false), width, 1, true).
 		AddItem(nil, 0, 1, false)
-	return helpFlex
 }
 
+func createPopupList(title string, page string) *tview.List {
+	list := tview.NewList()
+	style(list, title)
+	list.SetBorder(true)
+	list.SetBorderPadding(0, 0, 1, 1)
+	list.SetDoneFunc(func() {
+		closePopup(page)
+	})
+	return list
+}
+
+func createSoundPopup() *tview.Flex {
+	soundList = createPopupList("Sound", "sound")
+	return centered(soundList, 40, 20)
+}
+
+func createTonePopup() *tview.Flex {
+	toneList = createPopupList("Tone "+adjustKeys(), "tone")
+	toneList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if step := adjustStep(event); step != 0 {
+			adjustTone(step)
+			return nil
+		}
+		return event
+	})
+	return centered(toneList, 40, 20)
+}
+
+func createAlarmPopup() *tview.Flex {
+	alarmList = createPopupList("Alarm", "alarm")
+	return centered(alarmList, 40, 24)
+}
+
+func createSettingsPopup() *tview.Flex {
+	settingsList = createPopupList("Settings "+adjustKeys(), "settings")
+	settingsList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if step := adjustStep(event); step != 0 {
+			adjustSetting(step)
+			return nil
+		}
+		return event
+	})
+	return centered(settingsList, 40, 24)
+}
+
+func createBluetoothPopup() *tview.Flex {
+	bluetoothList = createPopupList("Bluetooth", "bluetooth")
+	return centered(bluetoothList, 40, 20)
+}
+
+func createFormPopup() *tview.Flex {
+	form = tview.NewForm()
+	style(form, "")
+	form.SetCancelFunc(func() {
+		closePopup("form")
+	})
+	return centered(form, 44, 17)
+}
+
+func createPicker() *tview.Flex {
+	picker = createPopupList("", "picker")
+	return centered(picker, 36, 16)
+}
+
+// style sets the title, the border and the colors of the theme, applyTheme colors the layout again
 func style(layout any, title string) {
 	switch x := layout.(type) {
 	case *tview.Frame:
-		if title != "" {
-			x.SetTitle("  " + title + "  ")
-		}
 		x.SetBorder(true)
-		x.SetBorderColor(black)
-		x.SetTitleColor(accent)
-		x.SetBackgroundColor(transparent)
 	case *tview.TextView:
-		if title != "" {
-			x.SetTitle("  " + title + "  ")
-		}
 		x.SetBorder(true)
-		x.SetBorderColor(light)
-		x.SetTitleColor(accent)
-		x.SetTextColor(dark)
-		x.SetBackgroundColor(transparent)
 		x.SetBorderPadding(1, 1, 1, 1)
+	case *tview.Form:
+		x.SetBorder(true)
 	case *tview.List:
-		if title != "" {
-			x.SetTitle("  " + title + "  ")
-		}
 		x.SetBorder(false)
-		x.SetBorderColor(light)
-		x.SetBackgroundColor(transparent)
-		x.SetSelectedBackgroundColor(accent)
-		x.SetSecondaryTextColor(light)
-		x.SetMainTextColor(dark)
+	}
+	if x, ok := layout.(interface{ SetTitle(string) *tview.Box }); ok && title != "" {
+		x.SetTitle("  " + title + "  ")
+	}
+	styled = append(styled, layout)
+	applyStyle(layout)
+}
+
+func applyStyle(layout any) {
+	switch x := layout.(type) {
+	case *tview.Frame:
+		x.SetBorderColor(theme.Frame)
+		x.SetTitleColor(theme.Title)
+		x.SetBackgroundColor(theme.Background)
+	case *tview.TextView:
+		x.SetBorderColor(theme.Border)
+		x.SetTitleColor(theme.Title)
+		x.SetTextColor(theme.Text)
+		x.SetBackgroundColor(theme.Background)
+	case *tview.Form:
+		x.SetBorderColor(theme.Border)
+		x.SetTitleColor(theme.Title)
+		x.SetBackgroundColor(theme.Background)
+		x.SetLabelColor(theme.Text)
+		x.SetFieldBackgroundColor(theme.Field)
+		x.SetFieldTextColor(theme.FieldText)
+		x.SetButtonStyle(tcell.StyleDefault.Background(theme.Field).Foreground(theme.FieldText))
+		x.SetButtonActivatedStyle(selectedStyle())
+	case *tview.List:
+		x.SetBorderColor(theme.Border)
+		x.SetTitleColor(theme.Title)
+		x.SetBackgroundColor(theme.Background)
+		x.SetSelectedStyle(selectedStyle())
+		x.SetSecondaryTextColor(theme.Secondary)
+		x.SetMainTextColor(theme.Text)
 	}
 }
@@ -0,0 +1,232 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"github.com/atamanroman/ymc/musiccast"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+// how long the status bar shows finished commands, errors stay longer so there's time to read them
+const (
+	doneToast   = 3 * time.Second
+	failedToast = 10 * time.Second
+	maxToasts   = 3
+)
+
+type commandState int
+
+const (
+	commandPending commandState = iota
+	commandDone
+	commandFailed
+)
+
+// toast is the last command to a speaker the status bar shows
+type toast struct {
+	target string
+	text   string
+	state  commandState
+	at     time.Time
+}
+
+var statusBar *tview.TextView
+var logView *tview.TextView
+
+// toasts by speaker ID, scenes have an empty ID. Only the UI goroutine touches them.
+var toasts = make(map[string]*toast)
+
+// logChanged wakes up the goroutine which redraws the log, Write must not draw itself
+var logChanged = make(chan struct{}, 1)
+
+// logVisible is set while the log page is open, hidden log lines need no redraw
+var logVisible atomic.Bool
+
+// CommandPending shows the command to the target, a speaker or scene name, until CommandDone
+func CommandPending(command SpeakerCommand, target string) {
+	showToast(command.Id, &toast{target, describeCommand(command), commandPending, time.Now()})
+}
+
+// CommandDone shows the result of the command for a while, err may be a rejection, an API error or
+// a network failure
+func CommandDone(command SpeakerCommand, target string, err error) {
+	t := &toast{target, describeCommand(command), commandDone, time.Now()}
+	timeout := doneToast
+	if err != nil {
+		t.state = commandFailed
+		t.text += ": " + describeError(err)
+		timeout = failedToast
+	}
+	showToast(command.Id, t)
+	time.AfterFunc(timeout, func() {
+		App.QueueUpdateDraw(func() {
+			if toasts[command.Id] == t {
+				delete(toasts, command.Id)
+				updateStatusBar()
+			}
+		})
+	})
+}
+
+// showToast replaces the toast of the speaker unless it has a newer one. The commands are sent from
+// the UI goroutine, so waiting for it here could block both.
+func showToast(id string, t *toast) {
+	go App.QueueUpdateDraw(func() {
+		if old, ok := toasts[id]; ok && old.at.After(t.at) {
+			return
+		}
+		toasts[id] = t
+		updateStatusBar()
+	})
+}
+
+// LogWriter is the log view, see logging.SetOutput
+func LogWriter() io.Writer {
+	return logView
+}
+
+// createStatusBar shows the toasts below the speakers, it has no height without toasts
+func createStatusBar() *tview.TextView {
+	statusBar = tview.NewTextView().SetDynamicColors(true)
+	styleStatusBar()
+	return statusBar
+}
+
+func styleStatusBar() {
+	statusBar.SetTextColor(theme.Text)
+	statusBar.SetBackgroundColor(theme.Background)
+	updateStatusBar()
+}
+
+func updateStatusBar() {
+	sorted := make([]*toast, 0, len(toasts))
+	for _, t := range toasts {
+		sorted = append(sorted, t)
+	}
+	sort.Slice(sorted, func(a int, b int) bool {
+		return sorted[a].at.After(sorted[b].at)
+	})
+	if len(sorted) > maxToasts {
+		sorted = sorted[:maxToasts]
+	}
+	lines := make([]string, 0, len(sorted))
+	for _, t := range sorted {
+		lines = append(lines, toastLine(t))
+	}
+	statusBar.SetText(strings.Join(lines, "\n"))
+	if mainFlex != nil {
+		mainFlex.ResizeItem(statusBar, len(lines), 0)
+	}
+}
+
+func toastLine(t *toast) string {
+	symbol, tag := "…", ""
+	switch t.state {
+	case commandDone:
+		symbol, tag = "✓", styleTag(theme.On)
+	case commandFailed:
+		symbol, tag = "✗", styleTag(theme.Error)
+	}
+	line := fmt.Sprintf(" %s %s: %s", symbol, tview.Escape(t.target), tview.Escape(t.text))
+	if tag == "" {
+		return line
+	}
+	return tag + line + resetTag
+}
+
+// createLogView shows the log, which is written from all goroutines
+func createLogView() *tview.TextView {
+	logView = tview.NewTextView().SetMaxLines(1000)
+	style(logView, "Log")
+	logView.SetChangedFunc(func() {
+		select {
+		case logChanged <- struct{}{}:
+		default:
+		}
+	})
+	logView.SetDoneFunc(func(_ tcell.Key) {
+		logVisible.Store(false)
+		closePopup("log")
+	})
+	go func() {
+		for range logChanged {
+			if logVisible.Load() {
+				App.Draw()
+			}
+		}
+	}()
+	return logView
+}
+
+func showLog() {
+	logVisible.Store(true)
+	logView.ScrollToEnd()
+	mainLayout.ShowPage("log")
+	mainLayout.SendToFront("log")
+}
+
+// describeCommand turns the action into words like "Select sound program Hall in Munich"
+func describeCommand(command SpeakerCommand) string {
+	words := make([]string, 0)
+	start := 0
+	action := string(command.Action)
+	for i, r := range action {
+		if i > 0 && unicode.IsUpper(r) {
+			words = append(words, action[start:i])
+			start = i
+		}
+	}
+	words = append(words, action[start:])
+	for i, word := range words {
+		switch {
+		case word == "Cd":
+			words[i] = "CD"
+		case i > 0:
+			words[i] = strings.ToLower(word)
+		}
+	}
+	if value, ok := command.Value.(string); ok && value != "" {
+		words = append(words, value)
+	}
+	return strings.Join(words, " ")
+}
+
+// describeError keeps the status bar short, the log has the details
+func describeError(err error) string {
+	var speakerErrors musiccast.SpeakerErrors
+	var apiError *musiccast.ApiError
+	var upnpError *musiccast.UpnpError
+	var netError net.Error
+	switch {
+	case errors.As(err, &speakerErrors):
+		names := make([]string, 0, len(speakerErrors))
+		for name := range speakerErrors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		failures := make([]string, 0, len(names))
+		for _, name := range names {
+			failures = append(failures, name+" "+describeError(speakerErrors[name]))
+		}
+		return strings.Join(failures, ", ")
+	case musiccast.IsUpdating(err):
+		return "updating firmware"
+	case errors.As(err, &apiError):
+		return "rejected, " + apiError.Reason()
+	case errors.As(err, &upnpError):
+		return "rejected, " + upnpError.Description
+	case errors.As(err, &netError) && netError.Timeout():
+		return "no response"
+	case errors.As(err, &netError):
+		return "unreachable"
+	}
+	return err.Error()
+}
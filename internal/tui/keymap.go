@@ -0,0 +1,394 @@
+package tui
+
+import (
+	"fmt"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Actions the TUI handles itself, they are bound to keys but never sent to the CommandChan
+const (
+	PowerToggle    Action = "PowerToggle"
+	VolumeUpFine   Action = "VolumeUpFine"
+	VolumeDownFine Action = "VolumeDownFine"
+	CursorUp       Action = "CursorUp"
+	CursorDown     Action = "CursorDown"
+	ShowSound      Action = "ShowSound"
+	ShowTone       Action = "ShowTone"
+	ShowSleepTimer Action = "ShowSleepTimer"
+	ShowAlarm      Action = "ShowAlarm"
+	ShowSettings   Action = "ShowSettings"
+	ShowBluetooth  Action = "ShowBluetooth"
+	ShowRename     Action = "ShowRename"
+	ShowScenes     Action = "ShowScenes"
+	ShowLog        Action = "ShowLog"
+	ShowHelp       Action = "ShowHelp"
+	Quit           Action = "Quit"
+)
+
+// Keymap binds keys to actions. Keys are characters like "m" or "Z", or tcell key names with
+// modifiers like "Enter", "Shift+Right" or "Ctrl+L".
+type Keymap map[string]Action
+
+var defaultKeymap = Keymap{
+	"Enter":       PowerToggle,
+	"Right":       VolumeUp,
+	"Left":        VolumeDown,
+	"Shift+Right": VolumeUpFine,
+	"Shift+Left":  VolumeDownFine,
+	"m":           MuteToggle,
+	"a":           ShowSound,
+	"t":           ShowTone,
+	"z":           SleepCycle,
+	"Z":           ShowSleepTimer,
+	"c":           ShowAlarm,
+	"S":           ShowSettings,
+	"b":           ShowBluetooth,
+	"n":           ShowRename,
+	"e":           ShowScenes,
+	"p":           CdPlayPause,
+	"s":           CdStop,
+	"<":           CdPrevious,
+	">":           CdNext,
+	"o":           CdToggleTray,
+	"r":           CdRepeat,
+	"x":           CdShuffle,
+	"v":           ShowLog,
+	"?":           ShowHelp,
+	"q":           Quit,
+}
+
+// Keymaps are the keymaps the config can start from
+var Keymaps = map[string]Keymap{
+	"default": defaultKeymap,
+	"vi": defaultKeymap.with(Keymap{
+		"h": VolumeDown,
+		"l": VolumeUp,
+		"H": VolumeDownFine,
+		"L": VolumeUpFine,
+		"j": CursorDown,
+		"k": CursorUp,
+	}),
+}
+
+type keyAction struct {
+	action Action
+	help   string
+}
+
+// keyActions are the actions which can be bound to keys, in the order of the help dialog. Empty
+// actions are the headings of the sections.
+var keyActions = []keyAction{
+	{PowerToggle, "Turn on/off"},
+	{VolumeUp, "Volume up"},
+	{VolumeDown, "Volume down"},
+	{VolumeUpFine, "Small step up"},
+	{VolumeDownFine, "Small step down"},
+	{MuteToggle, "Toggle mute"},
+	{ShowSound, "Sound settings"},
+	{ShowTone, "Tone/EQ levels"},
+	{SleepCycle, "Cycle sleep"},
+	{ShowSleepTimer, "Sleep timer"},
+	{ShowAlarm, "Alarms"},
+	{ShowSettings, "Device settings"},
+	{ShowBluetooth, "Bluetooth"},
+	{ShowRename, "Rename"},
+	{ShowScenes, "Scenes"},
+	{CursorUp, "Previous speaker"},
+	{CursorDown, "Next speaker"},
+	{"", ""},
+	{"", "CD input:"},
+	{CdPlayPause, "Play/pause"},
+	{CdStop, "Stop"},
+	{CdPrevious, "Previous track"},
+	{CdNext, "Next track"},
+	{CdToggleTray, "Open/close"},
+	{CdRepeat, "Repeat"},
+	{CdShuffle, "Shuffle"},
+	{"", ""},
+	{ShowLog, "Show log"},
+	{ShowHelp, "Show help"},
+	{Quit, "Quit"},
+}
+
+// cdActions are only active while the selected speaker is on the CD input
+var cdActions = map[Action]bool{
+	CdPlayPause:  true,
+	CdStop:       true,
+	CdPrevious:   true,
+	CdNext:       true,
+	CdToggleTray: true,
+	CdRepeat:     true,
+	CdShuffle:    true,
+}
+
+var keymap = defaultKeymap
+
+// SetKeymap starts from one of the Keymaps, default if the name is empty, and binds the keys to the
+// actions, an empty action unbinds the key
+func SetKeymap(name string, keys map[string]string) error {
+	km, err := newKeymap(name, keys)
+	if err != nil {
+		return err
+	}
+	queueUpdateDraw(func() {
+		keymap = km
+		applyKeymap()
+	})
+	return nil
+}
+
+func newKeymap(name string, keys map[string]string) (Keymap, error) {
+	if name == "" {
+		name = "default"
+	}
+	base, ok := Keymaps[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown keymap %q, expected default or vi", name)
+	}
+	bindings := Keymap{}
+	for key, action := range keys {
+		key, err := parseKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if action != "" && !bindable(Action(action)) {
+			return nil, fmt.Errorf("unknown action %q for key %q", action, key)
+		}
+		bindings[key] = Action(action)
+	}
+	return base.with(bindings), nil
+}
+
+// with returns a copy of the keymap with the bindings added, empty actions remove the key
+func (k Keymap) with(bindings Keymap) Keymap {
+	km := make(Keymap, len(k)+len(bindings))
+	for key, action := range k {
+		km[key] = action
+	}
+	for key, action := range bindings {
+		if action == "" {
+			delete(km, key)
+		} else {
+			km[key] = action
+		}
+	}
+	return km
+}
+
+// keys returns the sorted keys bound to the action
+func (k Keymap) keys(action Action) []string {
+	keys := make([]string, 0)
+	for key, a := range k {
+		if a == action {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func bindable(action Action) bool {
+	if action == "" {
+		return false
+	}
+	for _, a := range keyActions {
+		if a.action == action {
+			return true
+		}
+	}
+	return false
+}
+
+// parseKey turns a key of the config into the name eventKey returns for it
+func parseKey(key string) (string, error) {
+	if strings.EqualFold(key, "Space") {
+		return " ", nil
+	}
+	if utf8.RuneCountInString(key) == 1 {
+		return key, nil
+	}
+	parts := strings.Split(key, "+")
+	name := parts[len(parts)-1]
+	var mods tcell.ModMask
+	for _, mod := range parts[:len(parts)-1] {
+		switch strings.ToLower(mod) {
+		case "ctrl":
+			mods |= tcell.ModCtrl
+		case "alt":
+			mods |= tcell.ModAlt
+		case "shift":
+			mods |= tcell.ModShift
+		default:
+			return "", fmt.Errorf("unknown modifier %q in key %q", mod, key)
+		}
+	}
+	if utf8.RuneCountInString(name) == 1 {
+		if mods&tcell.ModCtrl == 0 {
+			// the shifted character is its own rune
+			if mods&tcell.ModShift != 0 {
+				name = strings.ToUpper(name)
+			}
+			return keyString(mods&^tcell.ModShift, name), nil
+		}
+		name = "Ctrl-" + strings.ToUpper(name)
+	}
+	for _, known := range tcell.KeyNames {
+		if strings.EqualFold(known, name) {
+			if after, ok := strings.CutPrefix(known, "Ctrl-"); ok {
+				return keyString(mods|tcell.ModCtrl, after), nil
+			}
+			return keyString(mods, known), nil
+		}
+	}
+	return "", fmt.Errorf("unknown key %q", key)
+}
+
+// eventKey names the pressed key like parseKey
+func eventKey(event *tcell.EventKey) string {
+	mods := event.Modifiers()
+	if event.Key() == tcell.KeyRune {
+		return keyString(mods&^tcell.ModShift, string(event.Rune()))
+	}
+	name, ok := tcell.KeyNames[event.Key()]
+	if !ok {
+		return event.Name()
+	}
+	if after, ok := strings.CutPrefix(name, "Ctrl-"); ok {
+		return keyString(mods|tcell.ModCtrl, after)
+	}
+	return keyString(mods, name)
+}
+
+func keyString(mods tcell.ModMask, name string) string {
+	if mods&tcell.ModShift != 0 {
+		name = "Shift+" + name
+	}
+	if mods&tcell.ModAlt != 0 {
+		name = "Alt+" + name
+	}
+	if mods&tcell.ModCtrl != 0 {
+		name = "Ctrl+" + name
+	}
+	return name
+}
+
+var keyLabels = map[string]string{
+	"Enter": "RET",
+	"Esc":   "ESC",
+	"Left":  "←",
+	"Right": "→",
+	"Up":    "↑",
+	"Down":  "↓",
+	" ":     "SPC",
+}
+
+// keyLabel is the short form of the key for the help, like S-→ for Shift+Right
+func keyLabel(key string) string {
+	parts := strings.Split(key, "+")
+	name := parts[len(parts)-1]
+	if len(parts) > 1 && name == "" {
+		// Ctrl++
+		name = "+"
+		parts = parts[:len(parts)-1]
+	}
+	if label, ok := keyLabels[name]; ok {
+		name = label
+	}
+	prefix := ""
+	for _, mod := range parts[:len(parts)-1] {
+		switch mod {
+		case "Ctrl":
+			prefix += "C-"
+		case "Alt":
+			prefix += "M-"
+		case "Shift":
+			prefix += "S-"
+		}
+	}
+	return prefix + name
+}
+
+// helpWidth is the width of a line of the help without keys which don't fit
+const helpWidth = 19
+
+// helpText lists the bound actions with their keys, unbound actions are left out
+func helpText(km Keymap) string {
+	lines := make([]string, 0, len(keyActions))
+	for _, a := range keyActions {
+		if a.action == "" {
+			lines = append(lines, a.help)
+			continue
+		}
+		keys := km.keys(a.action)
+		if len(keys) == 0 {
+			continue
+		}
+		labels := make([]string, 0, len(keys))
+		for _, key := range keys {
+			labels = append(labels, keyLabel(key))
+		}
+		label := strings.Join(labels, " ")
+		gap := helpWidth - utf8.RuneCountInString(label) - utf8.RuneCountInString(a.help)
+		if gap < 1 {
+			gap = 1
+		}
+		lines = append(lines, label+strings.Repeat(" ", gap)+a.help)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// adjustKeys shows the keys which move a slider, like ←/→
+func adjustKeys() string {
+	labels := make([]string, 0, 2)
+	for _, action := range []Action{VolumeDown, VolumeUp} {
+		if keys := keymap.keys(action); len(keys) > 0 {
+			labels = append(labels, keyLabel(keys[0]))
+		}
+	}
+	return strings.Join(labels, "/")
+}
+
+// adjustStep turns the keys bound to the volume into steps of a slider, 0 for other keys
+func adjustStep(event *tcell.EventKey) int {
+	switch keymap[eventKey(event)] {
+	case VolumeUp, VolumeUpFine:
+		return 1
+	case VolumeDown, VolumeDownFine:
+		return -1
+	}
+	return 0
+}
+
+// applyKeymap updates the parts of the UI which show keys
+func applyKeymap() {
+	mainLayout.AddPage("help", createHelpDialog(), true, false)
+	toneList.SetTitle("  Tone " + adjustKeys() + "  ")
+	settingsList.SetTitle("  Settings " + adjustKeys() + "  ")
+}
+
+// globalKeys handles the keys which work everywhere but in input fields
+func globalKeys(event *tcell.EventKey) *tcell.EventKey {
+	if _, ok := App.GetFocus().(*tview.InputField); ok {
+		return event
+	}
+	switch keymap[eventKey(event)] {
+	case Quit:
+		return tcell.NewEventKey(tcell.KeyESC, ' ', tcell.ModNone)
+	case ShowLog:
+		showLog()
+		return nil
+	case ShowHelp:
+		mainLayout.ShowPage("help")
+		mainLayout.SendToFront("help")
+		return nil
+	case CursorUp:
+		return tcell.NewEventKey(tcell.KeyUp, ' ', tcell.ModNone)
+	case CursorDown:
+		return tcell.NewEventKey(tcell.KeyDown, ' ', tcell.ModNone)
+	}
+	return event
+}
@@ -0,0 +1,193 @@
+package tui
+
+import (
+	"fmt"
+	"github.com/gdamore/tcell/v2"
+	"sort"
+	"strings"
+)
+
+// Theme is the palette of the UI. A Selected of tcell.ColorDefault highlights the selection with
+// reverse video instead of colors.
+type Theme struct {
+	Background tcell.Color
+	// Frame is the border of the main frame, Border the one of panels and popups
+	Frame  tcell.Color
+	Border tcell.Color
+	Title  tcell.Color
+	Text   tcell.Color
+	// Secondary is the speaker status and the second line of list items
+	Secondary tcell.Color
+	// Selected is the background of the selected list item and of buttons
+	Selected     tcell.Color
+	SelectedText tcell.Color
+	Field        tcell.Color
+	FieldText    tcell.Color
+	// On and Updating are the names of speakers which are on or update their firmware, On is also
+	// the style of commands which succeeded
+	On       tcell.Style
+	Updating tcell.Style
+	// Error is the style of failed commands
+	Error tcell.Style
+}
+
+// Themes are the themes the config and the -theme flag can choose
+var Themes = map[string]Theme{
+	"default": {
+		Background:   tcell.ColorDefault,
+		Frame:        tcell.ColorBlack,
+		Border:       tcell.ColorLightGray,
+		Title:        tcell.ColorHotPink,
+		Text:         tcell.ColorGray,
+		Secondary:    tcell.ColorLightGray,
+		Selected:     tcell.ColorHotPink,
+		SelectedText: tcell.ColorBlack,
+		Field:        tcell.ColorGray,
+		FieldText:    tcell.ColorBlack,
+		On:           tcell.StyleDefault.Foreground(tcell.ColorGreen),
+		Updating:     tcell.StyleDefault.Foreground(tcell.ColorYellow),
+		Error:        tcell.StyleDefault.Foreground(tcell.ColorRed),
+	},
+	"light-terminal": {
+		Background:   tcell.ColorDefault,
+		Frame:        tcell.ColorGray,
+		Border:       tcell.ColorDarkGray,
+		Title:        tcell.ColorMediumVioletRed,
+		Text:         tcell.ColorBlack,
+		Secondary:    tcell.ColorDimGray,
+		Selected:     tcell.ColorMediumVioletRed,
+		SelectedText: tcell.ColorWhite,
+		Field:        tcell.ColorLightGray,
+		FieldText:    tcell.ColorBlack,
+		On:           tcell.StyleDefault.Foreground(tcell.ColorDarkGreen),
+		Updating:     tcell.StyleDefault.Foreground(tcell.ColorDarkOrange),
+		Error:        tcell.StyleDefault.Foreground(tcell.ColorDarkRed),
+	},
+	"high-contrast": {
+		Background:   tcell.ColorBlack,
+		Frame:        tcell.ColorWhite,
+		Border:       tcell.ColorWhite,
+		Title:        tcell.ColorYellow,
+		Text:         tcell.ColorWhite,
+		Secondary:    tcell.ColorWhite,
+		Selected:     tcell.ColorYellow,
+		SelectedText: tcell.ColorBlack,
+		Field:        tcell.ColorWhite,
+		FieldText:    tcell.ColorBlack,
+		On:           tcell.StyleDefault.Foreground(tcell.ColorLime).Bold(true),
+		Updating:     tcell.StyleDefault.Foreground(tcell.ColorYellow).Bold(true),
+		Error:        tcell.StyleDefault.Foreground(tcell.ColorRed).Bold(true),
+	},
+	"monochrome": {
+		Background:   tcell.ColorDefault,
+		Frame:        tcell.ColorDefault,
+		Border:       tcell.ColorDefault,
+		Title:        tcell.ColorDefault,
+		Text:         tcell.ColorDefault,
+		Secondary:    tcell.ColorDefault,
+		Selected:     tcell.ColorDefault,
+		SelectedText: tcell.ColorDefault,
+		Field:        tcell.ColorDefault,
+		FieldText:    tcell.ColorDefault,
+		On:           tcell.StyleDefault.Bold(true),
+		Updating:     tcell.StyleDefault.Underline(true),
+		Error:        tcell.StyleDefault.Reverse(true),
+	},
+}
+
+var theme = Themes["default"]
+
+// styled are the primitives style has set up, applyTheme styles them again
+var styled = make([]any, 0)
+
+// ThemeNames returns the names of the Themes in alphabetical order
+func ThemeNames() []string {
+	names := make([]string, 0, len(Themes))
+	for name := range Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetTheme switches the UI to one of the Themes, default if the name is empty
+func SetTheme(name string) error {
+	if name == "" {
+		name = "default"
+	}
+	t, ok := Themes[name]
+	if !ok {
+		return fmt.Errorf("unknown theme %q, expected one of %s", name, strings.Join(ThemeNames(), ", "))
+	}
+	queueUpdateDraw(func() {
+		theme = t
+		applyTheme()
+	})
+	return nil
+}
+
+// applyTheme styles the whole UI with the current theme
+func applyTheme() {
+	for _, layout := range styled {
+		applyStyle(layout)
+	}
+	styleFrameText()
+	stylePlayPanel()
+	styleStatusBar()
+	mainLayout.SetBackgroundColor(theme.Background)
+	for i, spkr := range knownSpeakers {
+		if i < speakerList.GetItemCount() {
+			speakerList.SetItemText(i, coloredFriendlyName(spkr), statusString(spkr))
+		}
+	}
+}
+
+// selectedStyle is how lists and buttons highlight the selection
+func selectedStyle() tcell.Style {
+	if theme.Selected == tcell.ColorDefault {
+		return tcell.StyleDefault.Reverse(true)
+	}
+	return tcell.StyleDefault.Background(theme.Selected).Foreground(theme.SelectedText)
+}
+
+// styleTag turns the foreground and attributes of the style into a tview color tag
+func styleTag(style tcell.Style) string {
+	fg, _, attrs := style.Decompose()
+	flags := ""
+	for _, attr := range []struct {
+		mask tcell.AttrMask
+		flag string
+	}{{tcell.AttrBold, "b"}, {tcell.AttrUnderline, "u"}, {tcell.AttrReverse, "r"}, {tcell.AttrDim, "d"}} {
+		if attrs&attr.mask != 0 {
+			flags += attr.flag
+		}
+	}
+	if flags == "" && fg == tcell.ColorDefault {
+		return ""
+	}
+	if flags == "" {
+		return "[" + colorName(fg) + "]"
+	}
+	return "[" + colorName(fg) + "::" + flags + "]"
+}
+
+// colorName is the name of the color for tags, empty for the default color
+func colorName(c tcell.Color) string {
+	if c == tcell.ColorDefault {
+		return ""
+	}
+	// some colors have several names, like gray and grey
+	name := ""
+	for n, color := range tcell.ColorNames {
+		if color == c && (name == "" || n < name) {
+			name = n
+		}
+	}
+	if name == "" {
+		return fmt.Sprintf("#%06x", c.Hex())
+	}
+	return name
+}
+
+// the tag which resets what styleTag set
+const resetTag = "[-::-]"
@@ -4,11 +4,12 @@ import (
 	"fmt"
 	"github.com/atamanroman/ymc/internal/logging"
 	"github.com/atamanroman/ymc/musiccast"
-	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type Action string
@@ -19,6 +20,40 @@ const (
 	VolumeUp   Action = "VolumeUp"
 	VolumeDown Action = "VolumeDown"
 	MuteToggle Action = "MuteToggle"
+
+	CdPlayPause  Action = "CdPlayPause"
+	CdStop       Action = "CdStop"
+	CdPrevious   Action = "CdPrevious"
+	CdNext       Action = "CdNext"
+	CdToggleTray Action = "CdToggleTray"
+	CdRepeat     Action = "CdRepeat"
+	CdShuffle    Action = "CdShuffle"
+
+	SelectSoundProgram    Action = "SelectSoundProgram"
+	SelectSurroundDecoder Action = "SelectSurroundDecoder"
+	SoundToggle           Action = "SoundToggle"
+
+	ToneAdjust          Action = "ToneAdjust"
+	SelectEqualizerMode Action = "SelectEqualizerMode"
+
+	SleepCycle Action = "SleepCycle"
+	SleepTimer Action = "SleepTimer"
+
+	AlarmSet Action = "AlarmSet"
+
+	SettingToggle Action = "SettingToggle"
+	SettingAdjust Action = "SettingAdjust"
+
+	Rename Action = "Rename"
+
+	BluetoothStandbyToggle     Action = "BluetoothStandbyToggle"
+	BluetoothTransmitterToggle Action = "BluetoothTransmitterToggle"
+	BluetoothSearch            Action = "BluetoothSearch"
+	BluetoothConnect           Action = "BluetoothConnect"
+	BluetoothDisconnect        Action = "BluetoothDisconnect"
+
+	// SceneApply applies the scene named by the value to all speakers, its Id is empty
+	SceneApply Action = "SceneApply"
 )
 
 type SpeakerCommand struct {
@@ -27,25 +62,95 @@ type SpeakerCommand struct {
 	Value  any
 }
 
+// ToneValue is the value of a ToneAdjust command
+type ToneValue struct {
+	Level musiccast.ToneLevel
+	Value int
+}
+
+// SettingValue is the value of a SettingAdjust command
+type SettingValue struct {
+	Function musiccast.SystemFunction
+	Value    int
+}
+
+// RenameValue is the value of a Rename command, Id is the input to rename or empty for the speaker
+type RenameValue struct {
+	Id   string
+	Name string
+}
+
+// SleepValue is the value of a SleepTimer command, a zero Duration cancels the timer
+type SleepValue struct {
+	Duration time.Duration
+	Fade     time.Duration
+}
+
 var App *tview.Application
+var running atomic.Bool
 var CommandChan = make(chan SpeakerCommand)
 
 var log = logging.Instance
 var speakerList *tview.List
+var playPanel *tview.Flex
+var playText *tview.TextView
+var albumArtView *albumArt
+var mainFlex *tview.Flex
+var mainFrame *tview.Frame
+var soundList *tview.List
+var picker *tview.List
+
+var toneList *tview.List
+var alarmList *tview.List
+var settingsList *tview.List
+var bluetoothList *tview.List
+var form *tview.Form
+
+// popups showing the state of a single speaker, refilled on every update while open
+var speakerPopups = make(map[string]func(speaker *musiccast.Speaker))
+var openPopup string
+var popupSpeakerId string
 var mainLayout *tview.Pages
 var knownSpeakers = make([]*musiccast.Speaker, 0)
+var sceneNames = make([]string, 0)
 
 func init() {
 	speakerList = createSpeakerList()
-	mainFrame := createFrame()
+	playPanel = createPlayPanel()
+	mainFlex = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(speakerList, 0, 1, true).
+		AddItem(playPanel, 0, 0, false).
+		AddItem(createStatusBar(), 0, 0, false)
+	createFrame()
 	helpDialog := createHelpDialog()
+	soundPopup := createSoundPopup()
+	tonePopup := createTonePopup()
+	alarmPopup := createAlarmPopup()
+	settingsPopup := createSettingsPopup()
+	bluetoothPopup := createBluetoothPopup()
+	formPopup := createFormPopup()
+	pickerPopup := createPicker()
+	logPage := createLogView()
+	speakerPopups["sound"] = fillSoundList
+	speakerPopups["tone"] = fillToneList
+	speakerPopups["alarm"] = fillAlarmList
+	speakerPopups["settings"] = fillSettingsList
+	speakerPopups["bluetooth"] = fillBluetoothList
 
 	mainLayout = tview.NewPages()
-	mainLayout.AddPage("main", mainFrame, true, true).AddPage("help", helpDialog, true, false)
-	mainLayout.SetBackgroundColor(tcell.ColorDefault)
+	mainLayout.AddPage("main", mainFrame, true, true).AddPage("help", helpDialog, true, false).
+		AddPage("sound", soundPopup, true, false).
+		AddPage("tone", tonePopup, true, false).
+		AddPage("alarm", alarmPopup, true, false).
+		AddPage("settings", settingsPopup, true, false).
+		AddPage("bluetooth", bluetoothPopup, true, false).
+		AddPage("form", formPopup, true, false).
+		AddPage("picker", pickerPopup, true, false).
+		AddPage("log", logPage, true, false)
+	mainLayout.SetBackgroundColor(theme.Background)
 
 	App = tview.NewApplication().SetRoot(mainLayout, true)
-	App.SetInputCapture(defaultKeys)
+	App.SetInputCapture(globalKeys)
 }
 
 func UpdateUi(updated map[string]*musiccast.Speaker) {
@@ -56,29 +161,489 @@ func UpdateUi(updated map[string]*musiccast.Speaker) {
 	sort.Slice(sorted, func(a int, b int) bool {
 		return sorted[a].FriendlyName > sorted[b].FriendlyName
 	})
-	knownSpeakers = sorted
 
 	App.QueueUpdateDraw(func() {
+		// renames re-sort the list, the selection stays on the speaker
+		selected := selectedSpeaker()
+		knownSpeakers = sorted
 		for i, spkr := range sorted {
-			count := speakerList.GetItemCount()
-			if i < count {
-				friendlyName, _ := speakerList.GetItemText(i)
-				if withoutColor(friendlyName) == withoutColor(spkr.FriendlyName) {
-					speakerList.SetItemText(i, coloredFriendlyName(spkr), statusString(spkr))
-				} else {
-					speakerList.InsertItem(i, coloredFriendlyName(spkr), statusString(spkr), 0, nil)
-				}
+			if i < speakerList.GetItemCount() {
+				// speakers are sorted by name, so renames and new speakers can shift items
+				speakerList.SetItemText(i, coloredFriendlyName(spkr), statusString(spkr))
 			} else {
 				// new item
 				speakerList.AddItem(coloredFriendlyName(spkr), statusString(spkr), 0, nil)
 			}
 		}
+		if selected != nil {
+			if index := speakerIndex(selected.ID); index >= 0 {
+				speakerList.SetCurrentItem(index)
+			}
+		}
+		updatePlayPanel()
+		if popupSpeakerId != "" {
+			for _, spkr := range sorted {
+				if spkr.ID == popupSpeakerId {
+					speakerPopups[openPopup](spkr)
+				}
+			}
+		}
+	})
+}
+
+// Run runs the App until it stops, the setters like SetScenes queue their changes from then on
+func Run() error {
+	running.Store(true)
+	defer running.Store(false)
+	return App.Run()
+}
+
+// queueUpdateDraw changes the UI in its goroutine. QueueUpdate waits for the App, so before Run
+// the change is made at once.
+func queueUpdateDraw(f func()) {
+	if !running.Load() {
+		f()
+		return
+	}
+	App.QueueUpdateDraw(f)
+}
+
+// SetScenes sets the scene names for the scene picker
+func SetScenes(names []string) {
+	queueUpdateDraw(func() {
+		sceneNames = names
+	})
+}
+
+// showScenePicker lets the user apply one of the saved scenes
+func showScenePicker() {
+	if len(sceneNames) == 0 {
+		showPicker("No scenes, see ymc scene", []string{"OK"}, "", func(string) {})
+		return
+	}
+	showPicker("Scenes", sceneNames, "", func(name string) {
+		CommandChan <- SpeakerCommand{Action: SceneApply, Value: name}
+	})
+}
+
+func closePopup(page string) {
+	if page == openPopup {
+		openPopup = ""
+		popupSpeakerId = ""
+	}
+	mainLayout.HidePage(page)
+}
+
+// showSpeakerPopup opens one of the speakerPopups for the speaker
+func showSpeakerPopup(page string, speaker *musiccast.Speaker) {
+	openPopup = page
+	popupSpeakerId = speaker.ID
+	speakerPopups[page](speaker)
+	mainLayout.ShowPage(page)
+	mainLayout.SendToFront(page)
+}
+
+// showPicker lets the user choose one of the options and calls selected with the choice
+func showPicker(title string, options []string, current string, selected func(option string)) {
+	picker.Clear()
+	picker.SetTitle("  " + title + "  ")
+	for i, option := range options {
+		picker.AddItem(option, "", 0, nil)
+		if option == current {
+			picker.SetCurrentItem(i)
+		}
+	}
+	picker.SetSelectedFunc(func(index int, _ string, _ string, _ rune) {
+		closePopup("picker")
+		selected(options[index])
 	})
+	mainLayout.ShowPage("picker")
+	mainLayout.SendToFront("picker")
+}
+
+// fillSoundList lists only the sound functions the speaker's main zone supports
+func fillSoundList(speaker *musiccast.Speaker) {
+	current := soundList.GetCurrentItem()
+	soundList.Clear()
+
+	settings := musiccast.SoundSettings{}
+	if speaker.Sound != nil {
+		settings = *speaker.Sound
+	}
+	var zone musiccast.ZoneFeatures
+	if speaker.Features != nil && speaker.Features.MainZone() != nil {
+		zone = *speaker.Features.MainZone()
+	}
+
+	if zone.Supports(string(musiccast.SoundProgram)) && len(zone.SoundProgramList) > 0 {
+		label := musiccast.SoundProgram.Label()
+		soundList.AddItem(label, settings.SoundProgram, 0, func() {
+			showPicker(label, zone.SoundProgramList, settings.SoundProgram, func(program string) {
+				CommandChan <- SpeakerCommand{speaker.ID, SelectSoundProgram, program}
+			})
+		})
+	}
+	if zone.Supports(string(musiccast.SurroundDecoderType)) && len(zone.SurroundDecoderTypeList) > 0 {
+		label := musiccast.SurroundDecoderType.Label()
+		soundList.AddItem(label, settings.SurroundDecoderType, 0, func() {
+			showPicker(label, zone.SurroundDecoderTypeList, settings.SurroundDecoderType, func(decoder string) {
+				CommandChan <- SpeakerCommand{speaker.ID, SelectSurroundDecoder, decoder}
+			})
+		})
+	}
+	for _, function := range musiccast.SoundToggles {
+		if !zone.Supports(string(function)) {
+			continue
+		}
+		function := function
+		soundList.AddItem(function.Label(), onOff(settings.Enabled(function)), 0, func() {
+			CommandChan <- SpeakerCommand{speaker.ID, SoundToggle, function}
+		})
+	}
+
+	if soundList.GetItemCount() == 0 {
+		soundList.AddItem("Nothing to configure", "", 0, nil)
+	}
+	soundList.SetCurrentItem(current)
+}
+
+// fillToneList shows a slider for every tone level the speaker's main zone supports
+func fillToneList(speaker *musiccast.Speaker) {
+	current := toneList.GetCurrentItem()
+	toneList.Clear()
+
+	settings := musiccast.ToneSettings{}
+	if speaker.Tone != nil {
+		settings = *speaker.Tone
+	}
+	var zone musiccast.ZoneFeatures
+	if speaker.Features != nil && speaker.Features.MainZone() != nil {
+		zone = *speaker.Features.MainZone()
+	}
+
+	if zone.Supports(musiccast.EqualizerLow.Function()) && len(zone.EqualizerModeList) > 0 {
+		toneList.AddItem("EQ mode", settings.Equalizer.Mode, 0, func() {
+			showPicker("EQ mode", zone.EqualizerModeList, settings.Equalizer.Mode, func(mode string) {
+				CommandChan <- SpeakerCommand{speaker.ID, SelectEqualizerMode, mode}
+			})
+		})
+	}
+	for _, level := range musiccast.ToneLevels {
+		r, ok := speaker.ToneRange(level)
+		if !ok || !zone.Supports(level.Function()) {
+			continue
+		}
+		toneList.AddItem(level.Label(), slider(settings.Value(level), r), 0, nil)
+	}
+
+	if toneList.GetItemCount() == 0 {
+		toneList.AddItem("Nothing to configure", "", 0, nil)
+	}
+	toneList.SetCurrentItem(current)
+}
+
+// adjustTone moves the slider under the cursor by steps
+func adjustTone(steps int) {
+	speaker := popupSpeaker()
+	if speaker == nil {
+		return
+	}
+	label, _ := toneList.GetItemText(toneList.GetCurrentItem())
+	for _, level := range musiccast.ToneLevels {
+		if level.Label() != label {
+			continue
+		}
+		r, ok := speaker.ToneRange(level)
+		if !ok {
+			return
+		}
+		value := 0
+		if speaker.Tone != nil {
+			value = speaker.Tone.Value(level)
+		}
+		step := r.Step
+		if step < 1 {
+			step = 1
+		}
+		CommandChan <- SpeakerCommand{speaker.ID, ToneAdjust, ToneValue{level, r.Clamp(value + steps*step)}}
+		return
+	}
+}
+
+func popupSpeaker() *musiccast.Speaker {
+	for _, spkr := range knownSpeakers {
+		if spkr.ID == popupSpeakerId {
+			return spkr
+		}
+	}
+	return nil
+}
+
+// fillSettingsList lists the device settings the speaker supports
+func fillSettingsList(speaker *musiccast.Speaker) {
+	current := settingsList.GetCurrentItem()
+	settingsList.Clear()
+
+	status := musiccast.FuncStatus{}
+	if speaker.FuncStatus != nil {
+		status = *speaker.FuncStatus
+	}
+	for _, function := range musiccast.SystemToggles {
+		if !speaker.SupportsSystemFunc(function) {
+			continue
+		}
+		function := function
+		settingsList.AddItem(function.Label(), onOff(status.Enabled(function)), 0, func() {
+			CommandChan <- SpeakerCommand{speaker.ID, SettingToggle, function}
+		})
+	}
+	for _, function := range musiccast.SystemLevels {
+		r, ok := speaker.SystemRange(function)
+		if !ok || !speaker.SupportsSystemFunc(function) {
+			continue
+		}
+		settingsList.AddItem(function.Label(), slider(status.Value(function), r), 0, nil)
+	}
+
+	if settingsList.GetItemCount() == 0 {
+		settingsList.AddItem("Nothing to configure", "", 0, nil)
+	}
+	settingsList.SetCurrentItem(current)
+}
+
+// fillBluetoothList shows Bluetooth standby and the transmitter with the devices it can pair with
+func fillBluetoothList(speaker *musiccast.Speaker) {
+	current := bluetoothList.GetCurrentItem()
+	bluetoothList.Clear()
+
+	info := musiccast.BluetoothInfo{}
+	if speaker.Bluetooth != nil {
+		info = *speaker.Bluetooth
+	}
+	if speaker.SupportsSystemFunc(musiccast.BluetoothStandby) {
+		bluetoothList.AddItem("Bluetooth standby", onOff(info.BluetoothStandby), 0, func() {
+			CommandChan <- SpeakerCommand{speaker.ID, BluetoothStandbyToggle, nil}
+		})
+	}
+	if speaker.SupportsSystemFunc(musiccast.BluetoothTxSetting) {
+		bluetoothList.AddItem("Transmitter", onOff(info.BluetoothTxSetting), 0, func() {
+			CommandChan <- SpeakerCommand{speaker.ID, BluetoothTransmitterToggle, nil}
+		})
+		if info.BluetoothTxSetting {
+			fillBluetoothDevices(speaker, info)
+		}
+	}
+
+	if bluetoothList.GetItemCount() == 0 {
+		bluetoothList.AddItem("No Bluetooth settings", "", 0, nil)
+	}
+	bluetoothList.SetCurrentItem(current)
+}
+
+func fillBluetoothDevices(speaker *musiccast.Speaker, info musiccast.BluetoothInfo) {
+	connected := info.BluetoothDevice
+	if connected.Connected {
+		bluetoothList.AddItem("Connected: "+bluetoothName(connected.BluetoothDevice), "select to disconnect", 0, func() {
+			CommandChan <- SpeakerCommand{speaker.ID, BluetoothDisconnect, nil}
+		})
+	}
+
+	devices := speaker.BluetoothDevices
+	if devices != nil && devices.Updating {
+		bluetoothList.AddItem("Searching...", "", 0, nil)
+	} else {
+		bluetoothList.AddItem("Search for devices", "", 0, func() {
+			CommandChan <- SpeakerCommand{speaker.ID, BluetoothSearch, nil}
+		})
+	}
+	if devices == nil {
+		return
+	}
+	for _, device := range devices.DeviceList {
+		if connected.Connected && device.Address == connected.Address {
+			continue
+		}
+		address := device.Address
+		bluetoothList.AddItem("  "+bluetoothName(device), "  select to pair", 0, func() {
+			CommandChan <- SpeakerCommand{speaker.ID, BluetoothConnect, address}
+		})
+	}
+}
+
+func bluetoothName(device musiccast.BluetoothDevice) string {
+	if device.Name != "" {
+		return device.Name
+	}
+	return device.Address
+}
+
+// adjustSetting moves the numeric setting under the cursor by steps
+func adjustSetting(steps int) {
+	speaker := popupSpeaker()
+	if speaker == nil || speaker.FuncStatus == nil {
+		return
+	}
+	label, _ := settingsList.GetItemText(settingsList.GetCurrentItem())
+	for _, function := range musiccast.SystemLevels {
+		if function.Label() != label {
+			continue
+		}
+		r, ok := speaker.SystemRange(function)
+		if !ok {
+			return
+		}
+		step := r.Step
+		if step < 1 {
+			step = 1
+		}
+		value := r.Clamp(speaker.FuncStatus.Value(function) + steps*step)
+		CommandChan <- SpeakerCommand{speaker.ID, SettingAdjust, SettingValue{function, value}}
+		return
+	}
+}
+
+// slider renders the value as ├────●────┤ with its number
+func slider(value int, r musiccast.RangeStep) string {
+	const width = 15
+	pos := 0
+	if r.Max > r.Min {
+		pos = (value - r.Min) * (width - 1) / (r.Max - r.Min)
+	}
+	if pos < 0 {
+		pos = 0
+	} else if pos > width-1 {
+		pos = width - 1
+	}
+	return fmt.Sprintf("├%s●%s┤ %+d", strings.Repeat("─", pos), strings.Repeat("─", width-1-pos), value)
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
+
+// selectedSpeaker returns the speaker under the cursor or nil if there is none
+func selectedSpeaker() *musiccast.Speaker {
+	index := speakerList.GetCurrentItem()
+	if index < 0 || index >= len(knownSpeakers) {
+		return nil
+	}
+	return knownSpeakers[index]
+}
+
+// speakerIndex is the list index of the speaker with the ID, -1 if it's not listed
+func speakerIndex(id string) int {
+	for i, spkr := range knownSpeakers {
+		if spkr.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// updatePlayPanel shows what the selected speaker plays on the CD or a netusb input and hides the panel otherwise
+func updatePlayPanel() {
+	speaker := selectedSpeaker()
+	if speaker == nil || speaker.Power != musiccast.On {
+		mainFlex.ResizeItem(playPanel, 0, 0)
+		return
+	}
+	switch {
+	case speaker.Input == musiccast.CdInput:
+		playPanel.SetTitle("  CD  ")
+		playText.SetText(cdStatusString(speaker))
+		albumArtView.show(nil)
+	case speaker.PlayInfo != nil && speaker.IsNetusbInput(speaker.Input):
+		playPanel.SetTitle("  " + speaker.InputText + "  ")
+		playText.SetText(playStatusString(speaker.PlayInfo))
+		albumArtView.show(speaker)
+	default:
+		mainFlex.ResizeItem(playPanel, 0, 0)
+		return
+	}
+	if albumArtView.key != "" {
+		// 5 rows of half blocks are a square of 10x10 pixels, plus the gap
+		playPanel.ResizeItem(albumArtView, 11, 0)
+	} else {
+		playPanel.ResizeItem(albumArtView, 0, 0)
+	}
+	mainFlex.ResizeItem(playPanel, 7, 0)
+}
+
+func cdStatusString(speaker *musiccast.Speaker) string {
+	cd := speaker.Cd
+	if cd == nil {
+		return "No CD info"
+	}
+
+	switch cd.DeviceStatus {
+	case "open":
+		return "Tray open"
+	case "not_ready":
+		return "Reading disc..."
+	}
+	if cd.TotalTracks == 0 {
+		return "No disc"
+	}
+
+	playTime := cd.PlayTime
+	if speaker.PlayTime != nil {
+		playTime = *speaker.PlayTime
+	}
+
+	title := cd.Track
+	if title == "" {
+		title = fmt.Sprintf("Track %d", cd.TrackNumber)
+	}
+	var artist string
+	if cd.Artist != "" || cd.Album != "" {
+		artist = fmt.Sprintf("%s - %s", cd.Artist, cd.Album)
+	}
+
+	return fmt.Sprintf("%s %s\n%s\n%d/%d  %s / %s  repeat %s  shuffle %s",
+		playbackSymbol(cd.Playback), title, artist, cd.TrackNumber, cd.TotalTracks,
+		formatSeconds(playTime), formatSeconds(cd.TotalTime), cd.Repeat, cd.Shuffle)
+}
+
+func playStatusString(info *musiccast.PlayInfo) string {
+	var artist string
+	if info.Artist != "" || info.Album != "" {
+		artist = fmt.Sprintf("%s - %s", info.Artist, info.Album)
+	}
+	// streams have no total time
+	playTime := formatSeconds(info.PlayTime)
+	if info.TotalTime > 0 {
+		playTime += " / " + formatSeconds(info.TotalTime)
+	}
+	return fmt.Sprintf("%s %s\n%s\n%s  repeat %s  shuffle %s",
+		playbackSymbol(info.Playback), info.Track, artist, playTime, info.Repeat, info.Shuffle)
+}
+
+func playbackSymbol(playback musiccast.Playback) string {
+	switch playback {
+	case musiccast.Play:
+		return "⏵"
+	case musiccast.Pause:
+		return "⏸"
+	}
+	return "⏹"
+}
+
+func formatSeconds(seconds int) string {
+	if seconds < 0 {
+		return "--:--"
+	}
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
 }
 
 func statusString(speaker *musiccast.Speaker) string {
+	if speaker.IsUpdating() {
+		return "  Updating firmware..."
+	}
 	if speaker.Power == musiccast.Standby {
-		return "  Standby"
+		return "  Standby" + signalString(speaker)
 	}
 
 	var volume string
@@ -100,35 +665,240 @@ func statusString(speaker *musiccast.Speaker) string {
 	}
 
 	// TODO play pause check
-	return fmt.Sprintf("  ⏵⏸ %s %s", input, volume)
+	return fmt.Sprintf("  ⏵⏸ %s %s%s%s", input, volume, sleepString(speaker), signalString(speaker))
 }
 
-func coloredFriendlyName(speaker *musiccast.Speaker) string {
-	if speaker.Power == musiccast.Standby {
-		return speaker.FriendlyName
+func signalString(speaker *musiccast.Speaker) string {
+	if speaker.Network == nil || !speaker.Network.IsWireless() {
+		return ""
 	}
-	return "[green]" + speaker.FriendlyName + "[default]"
+	return "  " + speaker.Network.SignalBars()
 }
 
-func withoutColor(label string) string {
-	if strings.Count(label, "[") == 2 && strings.Count(label, "]") == 2 {
-		start := strings.IndexByte(label, ']') + 1
-		end := strings.LastIndexByte(label, '[')
-		return label[start:end]
+// sleepString shows the remaining time of the client-side or device sleep timer, whichever fires first
+func sleepString(speaker *musiccast.Speaker) string {
+	var remaining time.Duration
+	if speaker.Sleep != nil && *speaker.Sleep > 0 {
+		remaining = time.Until(speaker.SleepEnd)
+	}
+	if timer := musiccast.ActiveSleepTimer(speaker.ID); timer != nil {
+		if remaining <= 0 || timer.Remaining() < remaining {
+			remaining = timer.Remaining()
+		}
+	}
+	if remaining <= 0 {
+		return ""
 	}
-	return label
+	return fmt.Sprintf(" ☾ %dm", int(remaining.Round(time.Minute).Minutes()))
 }
 
-func defaultKeys(event *tcell.EventKey) *tcell.EventKey {
-	switch event.Key() {
-	case tcell.KeyRune:
-		switch event.Rune() {
-		case 'q':
-			return tcell.NewEventKey(tcell.KeyESC, ' ', tcell.ModNone)
-		case '?':
-			mainLayout.ShowPage("help")
-			return event
+// showSleepForm asks for a custom sleep timer, an empty or zero duration cancels a running one
+func showSleepForm(speaker *musiccast.Speaker) {
+	duration := ""
+	fade := ""
+	if timer := musiccast.ActiveSleepTimer(speaker.ID); timer != nil {
+		duration = timer.Remaining().Round(time.Minute).String()
+		fade = timer.Fade.String()
+	}
+	showForm("Sleep timer", func(form *tview.Form) {
+		form.AddInputField("Sleep in", duration, 10, nil, func(text string) {
+			duration = text
+		})
+		form.AddInputField("Fade out", fade, 10, nil, func(text string) {
+			fade = text
+		})
+		form.AddTextView("", "e.g. 45m or 1h30m", 20, 1, false, false)
+		form.AddButton("Start", func() {
+			d, err := parseMinutes(duration)
+			if err != nil {
+				form.SetTitle("  Invalid duration  ")
+				return
+			}
+			f, err := parseMinutes(fade)
+			if err != nil {
+				form.SetTitle("  Invalid fade  ")
+				return
+			}
+			closePopup("form")
+			CommandChan <- SpeakerCommand{speaker.ID, SleepTimer, SleepValue{d, f}}
+		})
+		form.AddButton("Cancel timer", func() {
+			closePopup("form")
+			CommandChan <- SpeakerCommand{speaker.ID, SleepTimer, SleepValue{}}
+		})
+	})
+}
+
+// parseMinutes accepts Go durations or plain numbers as minutes
+func parseMinutes(text string) (time.Duration, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, nil
+	}
+	if minutes, err := strconv.Atoi(text); err == nil {
+		return time.Duration(minutes) * time.Minute, nil
+	}
+	return time.ParseDuration(text)
+}
+
+var alarmDayLabels = map[string]string{
+	"oneday":    "One day",
+	"sunday":    "Sunday",
+	"monday":    "Monday",
+	"tuesday":   "Tuesday",
+	"wednesday": "Wednesday",
+	"thursday":  "Thursday",
+	"friday":    "Friday",
+	"saturday":  "Saturday",
+}
+
+// fillAlarmList shows the alarm settings, the day alarms open a form to edit them
+func fillAlarmList(speaker *musiccast.Speaker) {
+	current := alarmList.GetCurrentItem()
+	alarmList.Clear()
+
+	if !speaker.SupportsClock() || speaker.Clock == nil {
+		alarmList.AddItem("No alarm clock", "", 0, nil)
+		return
+	}
+	clock := *speaker.Clock
+	features := speaker.Features.Clock
+
+	alarmList.AddItem("Alarm", onOff(clock.AlarmOn), 0, func() {
+		on := !clock.AlarmOn
+		CommandChan <- SpeakerCommand{speaker.ID, AlarmSet, musiccast.AlarmSettings{AlarmOn: &on}}
+	})
+	if len(features.AlarmModeList) > 0 {
+		alarmList.AddItem("Mode", clock.Mode, 0, func() {
+			showPicker("Alarm mode", features.AlarmModeList, clock.Mode, func(mode string) {
+				CommandChan <- SpeakerCommand{speaker.ID, AlarmSet, musiccast.AlarmSettings{Mode: mode}}
+			})
+		})
+	}
+	alarmList.AddItem("Volume", strconv.Itoa(clock.Volume), 0, nil)
+	for _, day := range musiccast.AlarmDays {
+		alarm := clock.Day(day)
+		if alarm == nil {
+			continue
 		}
+		day := day
+		status := fmt.Sprintf("%s %s %s", onOff(alarm.Enable), alarm.FormattedTime(), alarm.Source())
+		alarmList.AddItem(alarmDayLabels[day], status, 0, func() {
+			showAlarmDayForm(speaker, day, *alarm)
+		})
+	}
+	alarmList.SetCurrentItem(current)
+}
+
+// showAlarmDayForm edits a single day of the alarm
+func showAlarmDayForm(speaker *musiccast.Speaker, day string, alarm musiccast.AlarmDay) {
+	features := speaker.Features.Clock
+	sources := make([]string, 0)
+	for _, input := range features.AlarmInputList {
+		sources = append(sources, musiccast.AlarmResume+": "+input)
+	}
+	for _, preset := range features.AlarmPresetList {
+		sources = append(sources, musiccast.AlarmPreset+": "+preset)
+	}
+	selectedSource := 0
+	for i, source := range sources {
+		if source == musiccast.AlarmResume+": "+alarm.Resume.Input && alarm.PlaybackType == musiccast.AlarmResume ||
+			source == musiccast.AlarmPreset+": "+alarm.Preset.Type && alarm.PlaybackType == musiccast.AlarmPreset {
+			selectedSource = i
+		}
+	}
+
+	alarmTime := alarm.FormattedTime()
+	presetNum := strconv.Itoa(alarm.Preset.Num)
+	showForm(alarmDayLabels[day]+" alarm", func(form *tview.Form) {
+		form.AddCheckbox("Enabled", alarm.Enable, func(checked bool) {
+			alarm.Enable = checked
+		})
+		form.AddInputField("Time", alarmTime, 6, nil, func(text string) {
+			alarmTime = text
+		})
+		form.AddCheckbox("Beep", alarm.Beep, func(checked bool) {
+			alarm.Beep = checked
+		})
+		if len(sources) > 0 {
+			form.AddDropDown("Source", sources, selectedSource, func(option string, _ int) {
+				playbackType, value, _ := strings.Cut(option, ": ")
+				alarm.PlaybackType = playbackType
+				if playbackType == musiccast.AlarmPreset {
+					alarm.Preset.Type = value
+				} else {
+					alarm.Resume.Input = value
+				}
+			})
+		}
+		form.AddInputField("Preset no.", presetNum, 4, tview.InputFieldInteger, func(text string) {
+			presetNum = text
+		})
+		form.AddButton("Save", func() {
+			var err error
+			alarm.Time, err = musiccast.ParseAlarmTime(alarmTime)
+			if err != nil {
+				form.SetTitle("  Invalid time  ")
+				return
+			}
+			alarm.Preset.Num, _ = strconv.Atoi(presetNum)
+			closePopup("form")
+			CommandChan <- SpeakerCommand{speaker.ID, AlarmSet, musiccast.AlarmSettings{Detail: &musiccast.AlarmDetail{Day: day, AlarmDay: alarm}}}
+		})
+	})
+}
+
+// showRenameForm renames the speaker and its current input if the input allows it
+func showRenameForm(speaker *musiccast.Speaker) {
+	name := speaker.FriendlyName
+	inputName := speaker.InputText
+	canRenameInput := speaker.CanRenameInput(speaker.Input)
+	showForm("Rename", func(form *tview.Form) {
+		form.AddInputField("Speaker", name, 24, nil, func(text string) {
+			name = text
+		})
+		if canRenameInput {
+			form.AddInputField("Input "+speaker.Input, inputName, 24, nil, func(text string) {
+				inputName = text
+			})
+		}
+		form.AddButton("Save", func() {
+			name = strings.TrimSpace(name)
+			inputName = strings.TrimSpace(inputName)
+			if name == "" || (canRenameInput && inputName == "") {
+				form.SetTitle("  Name must not be empty  ")
+				return
+			}
+			closePopup("form")
+			if name != speaker.FriendlyName {
+				CommandChan <- SpeakerCommand{speaker.ID, Rename, RenameValue{"", name}}
+			}
+			if canRenameInput && inputName != speaker.InputText {
+				CommandChan <- SpeakerCommand{speaker.ID, Rename, RenameValue{speaker.Input, inputName}}
+			}
+		})
+	})
+}
+
+// showForm replaces the form items with the ones added by build and shows the form popup
+func showForm(title string, build func(form *tview.Form)) {
+	form.Clear(true)
+	form.SetTitle("  " + title + "  ")
+	build(form)
+	form.SetFocus(0)
+	mainLayout.ShowPage("form")
+	mainLayout.SendToFront("form")
+}
+
+func coloredFriendlyName(speaker *musiccast.Speaker) string {
+	nameStyle := theme.On
+	if speaker.IsUpdating() {
+		nameStyle = theme.Updating
+	} else if speaker.Power == musiccast.Standby {
+		return speaker.FriendlyName
+	}
+	if tag := styleTag(nameStyle); tag != "" {
+		return tag + speaker.FriendlyName + resetTag
 	}
-	return event
+	return speaker.FriendlyName
 }
@@ -1,11 +1,19 @@
 package tui
 
 import (
+	"errors"
+	"fmt"
 	"github.com/atamanroman/ymc/internal/testhelper"
 	"github.com/atamanroman/ymc/musiccast"
+	"github.com/gdamore/tcell/v2"
 	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"net"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestStatusString(t *testing.T) {
@@ -32,3 +40,229 @@ func TestStatusString(t *testing.T) {
 func trimmedStatus(speaker musiccast.Speaker) string {
 	return strings.TrimSpace(statusString(&speaker))
 }
+
+func TestCdStatusString(t *testing.T) {
+	speaker := musiccast.Speaker{}
+	assert.Equal(t, "No CD info", cdStatusString(&speaker))
+
+	speaker.Cd = &musiccast.CdPlayInfo{DeviceStatus: "open"}
+	assert.Equal(t, "Tray open", cdStatusString(&speaker))
+
+	speaker.Cd = &musiccast.CdPlayInfo{
+		DeviceStatus: "ready",
+		Playback:     musiccast.Play,
+		Repeat:       musiccast.RepeatAll,
+		Shuffle:      musiccast.ShuffleOff,
+		PlayTime:     5,
+		TotalTime:    200,
+		TrackNumber:  3,
+		TotalTracks:  12,
+	}
+	speaker.PlayTime = testhelper.Ptr(65)
+	assert.Equal(t, "⏵ Track 3\n\n3/12  01:05 / 03:20  repeat all  shuffle off", cdStatusString(&speaker))
+}
+
+func TestSlider(t *testing.T) {
+	r := musiccast.RangeStep{Min: -6, Max: 6, Step: 1}
+
+	assert.Equal(t, "├●──────────────┤ -6", slider(-6, r))
+	assert.Equal(t, "├───────●───────┤ +0", slider(0, r))
+	assert.Equal(t, "├──────────────●┤ +6", slider(6, r))
+}
+
+func TestSleepString(t *testing.T) {
+	speaker := musiccast.Speaker{ID: "1"}
+	assert.Equal(t, "", sleepString(&speaker))
+
+	speaker.Sleep = testhelper.Ptr(30)
+	speaker.SleepEnd = time.Now().Add(20*time.Minute + 10*time.Second)
+	assert.Equal(t, " ☾ 20m", sleepString(&speaker))
+}
+
+func TestParseMinutes(t *testing.T) {
+	d, err := parseMinutes("45")
+	assert.NoError(t, err)
+	assert.Equal(t, 45*time.Minute, d)
+
+	d, err = parseMinutes("1h30m")
+	assert.NoError(t, err)
+	assert.Equal(t, 90*time.Minute, d)
+
+	d, err = parseMinutes(" ")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), d)
+
+	_, err = parseMinutes("soon")
+	assert.Error(t, err)
+}
+
+func TestStatusStringUpdating(t *testing.T) {
+	speaker := musiccast.Speaker{Power: musiccast.On, Updating: testhelper.Ptr(true)}
+	assert.Equal(t, "Updating firmware...", trimmedStatus(speaker))
+	assert.Equal(t, "[yellow][-::-]", coloredFriendlyName(&speaker))
+}
+
+func TestSignalString(t *testing.T) {
+	speaker := musiccast.Speaker{Power: musiccast.Standby}
+	assert.Equal(t, "", signalString(&speaker))
+
+	speaker.Network = &musiccast.NetworkStatus{Connection: musiccast.ConnectionWired}
+	assert.Equal(t, "", signalString(&speaker))
+
+	speaker.Network.Connection = musiccast.ConnectionWirelessLan
+	speaker.Network.WirelessLan.Strength = 30
+	assert.Equal(t, "Standby  ▂▄__", trimmedStatus(speaker))
+}
+
+func TestPlayStatusString(t *testing.T) {
+	info := musiccast.PlayInfo{Playback: musiccast.Play, Track: "Song", Artist: "Band", Album: "Album",
+		PlayTime: 65, TotalTime: 200, Repeat: musiccast.RepeatOff, Shuffle: musiccast.ShuffleOff}
+	assert.Equal(t, "⏵ Song\nBand - Album\n01:05 / 03:20  repeat off  shuffle off", playStatusString(&info))
+
+	info.Playback = musiccast.Stop
+	info.TotalTime = -60000
+	info.Artist, info.Album = "", ""
+	assert.Equal(t, "⏹ Song\n\n01:05  repeat off  shuffle off", playStatusString(&info))
+}
+
+func TestScaleImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if x < 2 {
+				img.Set(x, y, color.RGBA{255, 0, 0, 255})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, 255, 255})
+			}
+		}
+	}
+	pixels := scaleImage(img, 2, 2)
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, pixels[0][0])
+	assert.Equal(t, color.RGBA{0, 0, 255, 255}, pixels[1][1])
+
+	// averages the pixels which fall into one cell
+	pixels = scaleImage(img, 1, 1)
+	assert.Equal(t, color.RGBA{127, 0, 127, 255}, pixels[0][0])
+
+	// upscaling repeats pixels
+	assert.Len(t, scaleImage(img, 8, 10), 10)
+}
+
+func TestColor256(t *testing.T) {
+	assert.Equal(t, tcell.PaletteColor(196), color256(color.RGBA{255, 0, 0, 255}))
+	assert.Equal(t, tcell.PaletteColor(21), color256(color.RGBA{0, 0, 255, 255}))
+	assert.Equal(t, tcell.PaletteColor(16), color256(color.RGBA{0, 0, 0, 255}))
+	assert.Equal(t, tcell.PaletteColor(244), color256(color.RGBA{128, 128, 128, 255}))
+}
+
+func TestParseKey(t *testing.T) {
+	for key, expected := range map[string]string{
+		"m":           "m",
+		"Space":       " ",
+		"enter":       "Enter",
+		"shift+right": "Shift+Right",
+		"Ctrl+l":      "Ctrl+L",
+		"Alt+x":       "Alt+x",
+		"Shift+z":     "Z",
+	} {
+		parsed, err := parseKey(key)
+		assert.NoError(t, err, key)
+		assert.Equal(t, expected, parsed, key)
+	}
+	_, err := parseKey("Hyper+x")
+	assert.EqualError(t, err, `unknown modifier "Hyper" in key "Hyper+x"`)
+	_, err = parseKey("Return")
+	assert.EqualError(t, err, `unknown key "Return"`)
+
+	assert.Equal(t, "Z", eventKey(tcell.NewEventKey(tcell.KeyRune, 'Z', tcell.ModShift)))
+	assert.Equal(t, "Shift+Right", eventKey(tcell.NewEventKey(tcell.KeyRight, 0, tcell.ModShift)))
+	assert.Equal(t, "Ctrl+L", eventKey(tcell.NewEventKey(tcell.KeyCtrlL, 0, tcell.ModCtrl)))
+	assert.Equal(t, "Ctrl+L", eventKey(tcell.NewEventKey(tcell.KeyCtrlL, 0, tcell.ModNone)))
+}
+
+func TestNewKeymap(t *testing.T) {
+	km, err := newKeymap("", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultKeymap, km)
+
+	km, err = newKeymap("vi", map[string]string{"+": "VolumeUp", "m": "", "Ctrl+L": "Quit"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"+", "Right", "l"}, km.keys(VolumeUp))
+	assert.Equal(t, CursorDown, km["j"])
+	assert.Empty(t, km.keys(MuteToggle))
+	assert.Equal(t, []string{"Ctrl+L", "q"}, km.keys(Quit))
+	// presets stay as they are
+	assert.Equal(t, MuteToggle, Keymaps["vi"]["m"])
+
+	_, err = newKeymap("emacs", nil)
+	assert.EqualError(t, err, `unknown keymap "emacs", expected default or vi`)
+	_, err = newKeymap("", map[string]string{"x": "Explode"})
+	assert.EqualError(t, err, `unknown action "Explode" for key "x"`)
+}
+
+func TestHelpText(t *testing.T) {
+	help := helpText(defaultKeymap)
+	lines := strings.Split(help, "\n")
+	assert.Equal(t, "RET     Turn on/off", lines[0])
+	assert.Equal(t, "S-→   Small step up", lines[3])
+	assert.Contains(t, lines, "CD input:")
+	assert.Equal(t, "q              Quit", lines[len(lines)-1])
+	assert.NotContains(t, help, "Next speaker")
+
+	vi, _ := newKeymap("vi", map[string]string{"m": ""})
+	help = helpText(vi)
+	assert.Contains(t, help, "→ l       Volume up")
+	assert.Contains(t, help, "k  Previous speaker")
+	assert.NotContains(t, help, "Toggle mute")
+}
+
+func TestThemes(t *testing.T) {
+	t.Cleanup(func() { theme = Themes["default"] })
+	speaker := musiccast.Speaker{FriendlyName: "Kitchen", Power: musiccast.On}
+
+	assert.Equal(t, "[green]Kitchen[-::-]", coloredFriendlyName(&speaker))
+	theme = Themes["high-contrast"]
+	assert.Equal(t, "[lime::b]Kitchen[-::-]", coloredFriendlyName(&speaker))
+	theme = Themes["monochrome"]
+	assert.Equal(t, "[::b]Kitchen[-::-]", coloredFriendlyName(&speaker))
+	assert.Equal(t, tcell.StyleDefault.Reverse(true), selectedStyle())
+	speaker.Power = musiccast.Standby
+	assert.Equal(t, "Kitchen", coloredFriendlyName(&speaker))
+
+	assert.Equal(t, "", styleTag(tcell.StyleDefault))
+	assert.Equal(t, "[#123456]", styleTag(tcell.StyleDefault.Foreground(tcell.NewHexColor(0x123456))))
+	assert.Equal(t, []string{"default", "high-contrast", "light-terminal", "monochrome"}, ThemeNames())
+	assert.EqualError(t, SetTheme("neon"), `unknown theme "neon", expected one of default, high-contrast, light-terminal, monochrome`)
+}
+
+func TestDescribeCommand(t *testing.T) {
+	assert.Equal(t, "Volume up", describeCommand(SpeakerCommand{"1", VolumeUp, 5}))
+	assert.Equal(t, "CD play pause", describeCommand(SpeakerCommand{"1", CdPlayPause, nil}))
+	assert.Equal(t, "Select sound program Hall in Munich", describeCommand(SpeakerCommand{"1", SelectSoundProgram, "Hall in Munich"}))
+}
+
+func TestDescribeError(t *testing.T) {
+	assert.Equal(t, "rejected, guarded", describeError(fmt.Errorf("wrapped: %w", &musiccast.ApiError{Code: 5})))
+	assert.Equal(t, "updating firmware", describeError(&musiccast.ApiError{Code: musiccast.ResponseCodeUpdating}))
+	assert.Equal(t, "rejected, Transition not available",
+		describeError(&musiccast.UpnpError{Action: "Play", Code: 701, Description: "Transition not available"}))
+	assert.Equal(t, "no response", describeError(&url.Error{Op: "Get", URL: "http://speaker", Err: timeoutError{}}))
+	assert.Equal(t, "unreachable", describeError(&url.Error{Op: "Get", URL: "http://speaker", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}))
+	assert.Equal(t, "Bedroom unreachable, Kitchen rejected, guarded", describeError(musiccast.SpeakerErrors{
+		"Kitchen": &musiccast.ApiError{Code: 5},
+		"Bedroom": &net.OpError{Op: "dial", Err: errors.New("no route to host")},
+	}))
+	assert.Equal(t, "in standby", describeError(errors.New("in standby")))
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestToastLine(t *testing.T) {
+	assert.Equal(t, " … Kitchen: Volume up", toastLine(&toast{"Kitchen", "Volume up", commandPending, time.Now()}))
+	assert.Equal(t, "[green] ✓ Kitchen: Mute toggle[-::-]", toastLine(&toast{"Kitchen", "Mute toggle", commandDone, time.Now()}))
+	assert.Equal(t, "[red] ✗ [x[]: Power on: unreachable[-::-]", toastLine(&toast{"[x]", "Power on: unreachable", commandFailed, time.Now()}))
+}
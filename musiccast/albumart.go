@@ -0,0 +1,76 @@
+package musiccast
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// how many album arts to keep, enough for a few speakers skipping back and forth
+const albumArtCacheSize = 16
+
+var albumArtCache = make(map[string]image.Image)
+var albumArtOrder []string
+var albumArtLock sync.Mutex
+
+// AlbumArt fetches the album art of the play info relative to the speaker's BaseUrl, cached by albumart_id.
+// Returns nil without error if there is no album art.
+func AlbumArt(speaker *Speaker, info PlayInfo) (image.Image, error) {
+	if info.AlbumartUrl == "" {
+		return nil, nil
+	}
+	key := fmt.Sprintf("%s/%d/%s", speaker.ID, info.AlbumartId, info.AlbumartUrl)
+	albumArtLock.Lock()
+	cached, ok := albumArtCache[key]
+	albumArtLock.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	artUrl, err := albumArtUrl(speaker.BaseUrl, info.AlbumartUrl)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Get(artUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("album art %s returned %s", artUrl, resp.Status)
+	}
+	art, _, err := image.Decode(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("album art %s: %w", artUrl, err)
+	}
+
+	albumArtLock.Lock()
+	defer albumArtLock.Unlock()
+	if _, ok := albumArtCache[key]; !ok {
+		albumArtOrder = append(albumArtOrder, key)
+	}
+	albumArtCache[key] = art
+	if len(albumArtOrder) > albumArtCacheSize {
+		delete(albumArtCache, albumArtOrder[0])
+		albumArtOrder = albumArtOrder[1:]
+	}
+	return art, nil
+}
+
+// albumArtUrl resolves the albumart_url, which is usually a path, against the speaker's BaseUrl
+func albumArtUrl(baseUrl string, albumartUrl string) (string, error) {
+	base, err := url.Parse(baseUrl)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(albumartUrl)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
@@ -9,11 +9,14 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 var log = logging.Instance
 
+var ErrNotSupported = errors.New("not supported by this device")
+
 const musicCastModel = "MusicCast"
 const musicCastManufacturer = "Yamaha Corporation"
 
@@ -37,13 +40,35 @@ type Speaker struct {
 	BaseUrl            string
 	ControlUrl         string
 	ExtendedControlUrl string
-	FriendlyName       string
-	DeviceType         string
-	Volume             *int8
-	MaxVolume          int8
-	InputText          string
-	Input              string
-	Mute               *bool
+	DescriptionUrl     string
+	// UpnpServices of the DLNA renderer by name like AVTransport, empty if the speaker has none
+	UpnpServices map[string]UpnpService
+	FriendlyName string
+	DeviceType   string
+	Volume       *int8
+	MaxVolume    int8
+	InputText    string
+	Input        string
+	Mute         *bool
+	PlayTime     *int
+	Cd           *CdPlayInfo
+	PlayInfo     *PlayInfo
+	Sound        *SoundSettings
+	Tone         *ToneSettings
+	// Sleep is the device sleep timer in minutes, SleepEnd an estimate when it fires
+	Sleep      *int
+	SleepEnd   time.Time
+	Clock      *ClockSettings
+	FuncStatus *FuncStatus
+	Network    *NetworkStatus
+	Bluetooth  *BluetoothInfo
+	// BluetoothDevices is only known after SearchBluetoothDevices
+	BluetoothDevices *BluetoothDeviceList
+	// Updating is true while the speaker updates its firmware and rejects commands
+	Updating *bool
+	// Online is false if the speaker stopped answering the presence checks
+	Online   *bool
+	Features *GetFeaturesResponse
 
 	PartialUpdate bool
 }
@@ -52,6 +77,15 @@ func (o Speaker) String() string {
 	return jsonStringer(o)
 }
 
+func (o Speaker) IsUpdating() bool {
+	return o.Updating != nil && *o.Updating
+}
+
+// IsOnline is true unless the speaker stopped answering, see keepSubscribed
+func (o Speaker) IsOnline() bool {
+	return o.Online == nil || *o.Online
+}
+
 // UpdateValues copies non-empty values onto target
 func (o Speaker) UpdateValues(target *Speaker) {
 	if o.ID == "" {
@@ -66,6 +100,10 @@ func (o Speaker) UpdateValues(target *Speaker) {
 		target.Volume = o.Volume
 	}
 
+	if o.FriendlyName != "" {
+		target.FriendlyName = o.FriendlyName
+	}
+
 	if o.InputText != "" {
 		target.InputText = o.InputText
 	}
@@ -78,6 +116,65 @@ func (o Speaker) UpdateValues(target *Speaker) {
 		target.Mute = o.Mute
 	}
 
+	if o.PlayTime != nil {
+		target.PlayTime = o.PlayTime
+	}
+
+	if o.Cd != nil {
+		target.Cd = o.Cd
+	}
+
+	if o.PlayInfo != nil {
+		target.PlayInfo = o.PlayInfo
+	}
+
+	if o.Sound != nil {
+		target.Sound = o.Sound
+	}
+
+	if o.Tone != nil {
+		target.Tone = o.Tone
+	}
+
+	if o.Sleep != nil {
+		if target.Sleep == nil || *target.Sleep != *o.Sleep {
+			target.SleepEnd = sleepEnd(*o.Sleep)
+		}
+		target.Sleep = o.Sleep
+	}
+
+	if o.Clock != nil {
+		target.Clock = o.Clock
+	}
+
+	if o.FuncStatus != nil {
+		target.FuncStatus = o.FuncStatus
+	}
+
+	if o.Network != nil {
+		target.Network = o.Network
+	}
+
+	if o.Bluetooth != nil {
+		target.Bluetooth = o.Bluetooth
+	}
+
+	if o.BluetoothDevices != nil {
+		target.BluetoothDevices = o.BluetoothDevices
+	}
+
+	if o.Updating != nil {
+		target.Updating = o.Updating
+	}
+
+	if o.Online != nil {
+		target.Online = o.Online
+	}
+
+	if o.Features != nil {
+		target.Features = o.Features
+	}
+
 	// TODO
 }
 
@@ -85,20 +182,43 @@ type ZonedStatusEvent struct {
 	ID     string      `json:"device_id"`
 	Main   StatusEvent `json:"main"`
 	Netusb NetusbEvent `json:"netusb"`
+	Cd     CdEvent     `json:"cd"`
+	Clock  ClockEvent  `json:"clock"`
+	System SystemEvent `json:"system"`
 }
 type StatusEvent struct {
-	Power  Power `json:"power"`
-	Volume *int8 `json:"volume"`
-	Mute   *bool `json:"mute"`
+	Power         Power  `json:"power"`
+	Input         string `json:"input"`
+	Volume        *int8  `json:"volume"`
+	Mute          *bool  `json:"mute"`
+	Sleep         *int   `json:"sleep"`
+	StatusUpdated *bool  `json:"status_updated"`
 }
 type NetusbEvent struct {
-	PlayError       *int  `json:"play_error "`
+	PlayError       *int  `json:"play_error"`
 	AccountUpdated  *bool `json:"account_updated"`
 	PlayTime        *int  `json:"play_time"`
 	PlayInfoUpdated *bool `json:"play_info_updated"`
 	ListInfoUpdated *bool `json:"list_info_updated"`
 }
 
+type CdEvent struct {
+	DeviceStatus    string `json:"device_status"`
+	PlayTime        *int   `json:"play_time"`
+	PlayInfoUpdated *bool  `json:"play_info_updated"`
+}
+
+type ClockEvent struct {
+	SettingsUpdated *bool `json:"settings_updated"`
+}
+
+type SystemEvent struct {
+	FuncStatusUpdated *bool `json:"func_status_updated"`
+	NameTextUpdated   *bool `json:"name_text_updated"`
+	// also sent when a Bluetooth device connects or disconnects
+	BluetoothInfoUpdated *bool `json:"bluetooth_info_updated"`
+}
+
 func (o ZonedStatusEvent) String() string {
 	return jsonStringer(o)
 }
@@ -111,6 +231,18 @@ func (o NetusbEvent) String() string {
 	return jsonStringer(o)
 }
 
+func (o CdEvent) String() string {
+	return jsonStringer(o)
+}
+
+func (o ClockEvent) String() string {
+	return jsonStringer(o)
+}
+
+func (o SystemEvent) String() string {
+	return jsonStringer(o)
+}
+
 func jsonStringer(obj any) string {
 	str, err := json.Marshal(obj)
 	if err != nil {
@@ -125,6 +257,10 @@ var speakerChan = make(chan *Speaker)
 var eventConnection *net.UDPConn
 var eventListenerPort int
 
+// discovered speakers by ID, used to fetch details when an event asks for it
+var discovered = make(map[string]Speaker)
+var discoveredLock sync.RWMutex
+
 func init() {
 	log.Debug("Init MusicCast client")
 	var err error
@@ -166,36 +302,189 @@ func StartScan() <-chan *Speaker {
 				continue
 			}
 
+			received(event.ID)
+			seen(event.ID)
+
 			if event.Netusb.PlayTime != nil {
 				log.Debug("Discard play_time updates for now")
 				continue
 			}
 
-			spkr := Speaker{}
-			if event.ID != "" {
-				spkr.ID = event.ID
-			}
-			spkr.PartialUpdate = true
-			if event.Main.Power != "" {
-				spkr.Power = event.Main.Power
-			}
+			speakerChan <- eventToSpeaker(event)
+		}
+	}()
+	return speakerChan
+}
 
-			if event.Main.Power != "" {
-				spkr.Power = event.Main.Power
+// eventToSpeaker converts the event to a partial speaker update and fetches details the event only hints at
+func eventToSpeaker(event ZonedStatusEvent) *Speaker {
+	spkr := Speaker{}
+	spkr.ID = event.ID
+	spkr.PartialUpdate = true
+
+	if event.Main.StatusUpdated != nil && *event.Main.StatusUpdated {
+		if known, ok := lookup(event.ID); ok {
+			err := updateStatus(&known, 0)
+			if err != nil {
+				log.Warn("Failed to refresh status for device:", known.FriendlyName, err)
+			} else {
+				spkr.Power = known.Power
+				spkr.Volume = known.Volume
+				spkr.InputText = known.InputText
+				spkr.Input = known.Input
+				spkr.Mute = known.Mute
+				spkr.Sound = known.Sound
+				spkr.Tone = known.Tone
+				spkr.Sleep = known.Sleep
+				remember(known)
 			}
+		}
+	}
+
+	if event.Main.Power != "" {
+		spkr.Power = event.Main.Power
+	}
+
+	if event.Main.Input != "" {
+		spkr.Input = event.Main.Input
+	}
+
+	if event.Main.Volume != nil {
+		spkr.Volume = event.Main.Volume
+	}
+	if spkr.Volume != nil {
+		fadeVolumeEvent(spkr.ID, int(*spkr.Volume))
+	}
 
-			if event.Main.Volume != nil {
-				spkr.Volume = event.Main.Volume
+	if event.Main.Mute != nil {
+		spkr.Mute = event.Main.Mute
+	}
+
+	if event.Main.Sleep != nil {
+		spkr.Sleep = event.Main.Sleep
+	}
+
+	if event.Cd.PlayTime != nil {
+		spkr.PlayTime = event.Cd.PlayTime
+	}
+
+	cdChanged := event.Cd.DeviceStatus != "" || (event.Cd.PlayInfoUpdated != nil && *event.Cd.PlayInfoUpdated)
+	if cdChanged || spkr.Input == CdInput {
+		if known, ok := lookup(event.ID); ok {
+			if spkr.Input != "" {
+				known.Input = spkr.Input
+			}
+			err := updateCdPlayInfo(&known)
+			if err != nil {
+				log.Warn("Failed to get CD play info for device:", known.FriendlyName, err)
+			} else {
+				spkr.Cd = known.Cd
+				spkr.PlayTime = known.PlayTime
+				remember(known)
 			}
+		}
+	}
 
-			if event.Main.Mute != nil {
-				spkr.Mute = event.Main.Mute
+	if (event.Netusb.PlayInfoUpdated != nil && *event.Netusb.PlayInfoUpdated) || spkr.Input != "" {
+		if known, ok := lookup(event.ID); ok && known.IsNetusbInput(inputOr(spkr.Input, known.Input)) {
+			known.Input = inputOr(spkr.Input, known.Input)
+			err := updatePlayInfo(&known)
+			if err != nil {
+				log.Warn("Failed to get play info for device:", known.FriendlyName, err)
+			} else {
+				spkr.PlayInfo = known.PlayInfo
+				remember(known)
 			}
+		}
+	}
 
-			speakerChan <- &spkr
+	refreshOnEvent(&spkr, event.Clock.SettingsUpdated, "clock settings", func(known *Speaker) error {
+		if err := updateClockSettings(known); err != nil {
+			return err
 		}
-	}()
-	return speakerChan
+		spkr.Clock = known.Clock
+		return nil
+	})
+	refreshOnEvent(&spkr, event.System.FuncStatusUpdated, "func status", func(known *Speaker) error {
+		if err := updateFuncStatus(known); err != nil {
+			return err
+		}
+		spkr.FuncStatus = known.FuncStatus
+		return nil
+	})
+	refreshOnEvent(&spkr, event.System.NameTextUpdated, "name text", func(known *Speaker) error {
+		if err := updateNameText(known); err != nil {
+			return err
+		}
+		spkr.FriendlyName = known.FriendlyName
+		spkr.InputText = known.InputText
+		return nil
+	})
+	refreshOnEvent(&spkr, event.System.BluetoothInfoUpdated, "bluetooth info", func(known *Speaker) error {
+		if err := updateBluetoothInfo(known); err != nil {
+			return err
+		}
+		spkr.Bluetooth = known.Bluetooth
+		return nil
+	})
+
+	return &spkr
+}
+
+func inputOr(input string, fallback string) string {
+	if input != "" {
+		return input
+	}
+	return fallback
+}
+
+// refreshOnEvent fetches details with update if the event flag is set and the speaker is known
+func refreshOnEvent(spkr *Speaker, flag *bool, what string, update func(known *Speaker) error) {
+	if flag == nil || !*flag {
+		return
+	}
+	known, ok := lookup(spkr.ID)
+	if !ok {
+		return
+	}
+	if spkr.Input != "" {
+		known.Input = spkr.Input
+	}
+	err := update(&known)
+	if err != nil {
+		log.Warnf("Failed to get %s for device: %s %s", what, known.FriendlyName, err)
+		return
+	}
+	remember(known)
+}
+
+// SupportsZoneFunc checks if the main zone lists the function; false if the features are unknown
+func (o Speaker) SupportsZoneFunc(function string) bool {
+	if o.Features == nil || o.Features.MainZone() == nil {
+		return false
+	}
+	return o.Features.MainZone().Supports(function)
+}
+
+// requireZoneFunc fails with ErrNotSupported if the speaker's features are known and lack the function
+func requireZoneFunc(speaker *Speaker, function string) error {
+	if speaker.Features != nil && !speaker.SupportsZoneFunc(function) {
+		return fmt.Errorf("%s: %w", function, ErrNotSupported)
+	}
+	return nil
+}
+
+func remember(speaker Speaker) {
+	discoveredLock.Lock()
+	defer discoveredLock.Unlock()
+	discovered[speaker.ID] = speaker
+}
+
+func lookup(id string) (Speaker, bool) {
+	discoveredLock.RLock()
+	defer discoveredLock.RUnlock()
+	speaker, ok := discovered[id]
+	return speaker, ok
 }
 
 func mediaRendererToMusicCast(mediaRendererChan <-chan *ssdp2.Service, speakerChan chan<- *Speaker, musicCastEventPort int) {
@@ -206,21 +495,33 @@ func mediaRendererToMusicCast(mediaRendererChan <-chan *ssdp2.Service, speakerCh
 			log.Infof("Found SSDP Service: %v\n", service)
 			mediaRenderer, _ := ssdp2.GetMediaRenderer(service)
 			if isYamahaMusicCast(mediaRenderer) {
-				var spkr = Speaker{mediaRenderer.Device.UDN, Standby, mediaRenderer.XDevice.UrlBase, "?", "?", mediaRenderer.Device.FriendlyName, mediaRenderer.Device.ModelName, nil, 100, "", "", nil, false}
-				err := updateStatus(&spkr, musicCastEventPort)
+				// no ID until updateDeviceInfo, metrics don't count the calls before it per speaker
+				var spkr = Speaker{Power: Standby, BaseUrl: mediaRenderer.XDevice.UrlBase, ControlUrl: "?", ExtendedControlUrl: "?", DescriptionUrl: service.Location, FriendlyName: mediaRenderer.Device.FriendlyName, DeviceType: mediaRenderer.Device.ModelName, MaxVolume: 100}
+				spkr.UpnpServices = upnpServices(mediaRenderer)
+				err := loadSpeaker(&spkr, musicCastEventPort)
 				if err != nil {
-					log.Warn("Failed to get status for device:", spkr.FriendlyName, err)
+					log.Warn("Failed to load device:", spkr.FriendlyName, err)
+					countDiscovery(DiscoveryFailed)
 					continue
 				}
-				err = updateDeviceInfo(&spkr, musicCastEventPort)
-				if err != nil {
-					log.Warn("Failed to get deviceInfo for device:", spkr.FriendlyName, err)
+				countDiscovery(DiscoveryMusicCast)
+				if spkr.ID == "" {
+					// it doesn't even tell its ID during the update, the watcher publishes it when it's done
+					log.Info("Found MusicCast device which updates its firmware:", spkr.FriendlyName)
+					watchFirmwareUpdate(&spkr, musicCastEventPort)
 					continue
 				}
+				subscribed(spkr.ID)
+				keepSubscribed(spkr, musicCastEventPort)
+				remember(spkr)
 				log.Info("Found MusicCast device:", spkr.FriendlyName)
 				speakerChan <- &spkr
+				if spkr.IsUpdating() {
+					watchFirmwareUpdate(&spkr, musicCastEventPort)
+				}
 			} else {
 				log.Debug("Ignore non-MusicCast device:", mediaRenderer.Device.ModelName)
+				countDiscovery(DiscoveryIgnored)
 			}
 		default:
 			//case <-time.After(10 * time.Second):
@@ -230,6 +531,61 @@ func mediaRendererToMusicCast(mediaRendererChan <-chan *ssdp2.Service, speakerCh
 	}
 }
 
+// loadSpeaker fetches status, device info and details. A speaker which updates its firmware rejects
+// most calls until it's done, it gets Updating then and maybe no ID.
+func loadSpeaker(spkr *Speaker, appPort int) error {
+	err := updateStatus(spkr, appPort)
+	updating := IsUpdating(err)
+	if err != nil && !updating {
+		return fmt.Errorf("get status: %w", err)
+	}
+	err = updateDeviceInfo(spkr, appPort)
+	if IsUpdating(err) {
+		updating = true
+	} else if err != nil {
+		return fmt.Errorf("get device info: %w", err)
+	}
+	if updating {
+		spkr.Updating = &updating
+		return nil
+	}
+	updateDetails(spkr)
+	return nil
+}
+
+// updateDetails fetches everything beyond status and device info, failures only leave gaps
+func updateDetails(spkr *Speaker) {
+	var err error
+	spkr.Features, err = GetFeatures(spkr)
+	if err != nil {
+		log.Warn("Failed to get features for device:", spkr.FriendlyName, err)
+	}
+	err = updateCdPlayInfo(spkr)
+	if err != nil {
+		log.Warn("Failed to get CD play info for device:", spkr.FriendlyName, err)
+	}
+	err = updatePlayInfo(spkr)
+	if err != nil {
+		log.Warn("Failed to get play info for device:", spkr.FriendlyName, err)
+	}
+	err = updateClockSettings(spkr)
+	if err != nil {
+		log.Warn("Failed to get clock settings for device:", spkr.FriendlyName, err)
+	}
+	err = updateFuncStatus(spkr)
+	if err != nil {
+		log.Warn("Failed to get func status for device:", spkr.FriendlyName, err)
+	}
+	err = updateNetworkStatus(spkr)
+	if err != nil {
+		log.Warn("Failed to get network status for device:", spkr.FriendlyName, err)
+	}
+	err = updateBluetoothInfo(spkr)
+	if err != nil {
+		log.Warn("Failed to get Bluetooth info for device:", spkr.FriendlyName, err)
+	}
+}
+
 func isYamahaMusicCast(mediaRenderer *ssdp2.MediaRenderer) bool {
 	return mediaRenderer != nil &&
 		mediaRenderer.Device.Manufacturer == musicCastManufacturer &&
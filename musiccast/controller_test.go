@@ -1,9 +1,20 @@
 package musiccast
 
 import (
+	"encoding/json"
+	"fmt"
+	ssdp2 "github.com/atamanroman/ymc/internal/ssdp"
 	"github.com/atamanroman/ymc/internal/testhelper"
 	"github.com/stretchr/testify/assert"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestUpdateValues(t *testing.T) {
@@ -44,3 +55,611 @@ func TestUpdateValues(t *testing.T) {
 	assert.Equal(t, "Office", speaker.FriendlyName)
 	assert.Equal(t, "WX-021", speaker.DeviceType)
 }
+
+func TestEventToSpeaker(t *testing.T) {
+	event := ZonedStatusEvent{}
+	err := json.Unmarshal([]byte(`{"device_id":"1","main":{"power":"on","input":"cd","volume":12},"cd":{"play_time":42}}`), &event)
+	assert.NoError(t, err)
+
+	speaker := eventToSpeaker(event)
+
+	assert.Equal(t, "1", speaker.ID)
+	assert.True(t, speaker.PartialUpdate)
+	assert.Equal(t, On, speaker.Power)
+	assert.Equal(t, CdInput, speaker.Input)
+	assert.Equal(t, testhelper.Ptr(int8(12)), speaker.Volume)
+	assert.Nil(t, speaker.Mute)
+	assert.Equal(t, testhelper.Ptr(42), speaker.PlayTime)
+	// unknown speaker, so nothing to fetch
+	assert.Nil(t, speaker.Cd)
+}
+
+func TestRequireZoneFunc(t *testing.T) {
+	features := GetFeaturesResponse{}
+	err := json.Unmarshal([]byte(`{"zone":[{"id":"main","func_list":["power","sound_program","clear_voice"]}]}`), &features)
+	assert.NoError(t, err)
+
+	speaker := Speaker{}
+	assert.NoError(t, requireZoneFunc(&speaker, string(Enhancer)), "unknown features must not block calls")
+
+	speaker.Features = &features
+	assert.True(t, speaker.SupportsZoneFunc(string(ClearVoice)))
+	assert.NoError(t, requireZoneFunc(&speaker, string(SoundProgram)))
+	assert.ErrorIs(t, requireZoneFunc(&speaker, string(Enhancer)), ErrNotSupported)
+}
+
+func TestRangeStepClamp(t *testing.T) {
+	r := RangeStep{Id: "tone_control", Min: -12, Max: 12, Step: 2}
+
+	assert.Equal(t, -12, r.Clamp(-20))
+	assert.Equal(t, 12, r.Clamp(13))
+	assert.Equal(t, 0, r.Clamp(0))
+	assert.Equal(t, 4, r.Clamp(5))
+	assert.Equal(t, -6, r.Clamp(-5))
+}
+
+func TestNextSleep(t *testing.T) {
+	assert.Equal(t, 30, NextSleep(0))
+	assert.Equal(t, 60, NextSleep(30))
+	assert.Equal(t, 120, NextSleep(90))
+	assert.Equal(t, 0, NextSleep(120))
+	assert.Equal(t, 60, NextSleep(45))
+}
+
+func TestUpdateValuesSleep(t *testing.T) {
+	speaker := Speaker{ID: "1", Sleep: testhelper.Ptr(0)}
+
+	Speaker{ID: "1", Sleep: testhelper.Ptr(60)}.UpdateValues(&speaker)
+	assert.Equal(t, 60, *speaker.Sleep)
+	assert.WithinDuration(t, time.Now().Add(60*time.Minute), speaker.SleepEnd, time.Second)
+
+	end := speaker.SleepEnd
+	Speaker{ID: "1", Sleep: testhelper.Ptr(60)}.UpdateValues(&speaker)
+	assert.Equal(t, end, speaker.SleepEnd, "unchanged value must not restart the countdown")
+}
+
+func TestParseAlarmTime(t *testing.T) {
+	for input, expected := range map[string]string{"07:30": "0730", "0730": "0730", "730": "0730", "23:59": "2359"} {
+		actual, err := ParseAlarmTime(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected, actual, input)
+	}
+	for _, input := range []string{"24:00", "7:3", "07:60", "noon"} {
+		_, err := ParseAlarmTime(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestValidateAlarm(t *testing.T) {
+	features := GetFeaturesResponse{}
+	err := json.Unmarshal([]byte(`{"clock":{"func_list":["alarm"],"range_step":[{"id":"alarm_volume","min":0,"max":60,"step":1}],
+		"alarm_fade_type_num":2,"alarm_mode_list":["oneday","weekly"],"alarm_input_list":["net_radio","cd"]}}`), &features)
+	assert.NoError(t, err)
+	speaker := Speaker{Features: &features}
+
+	assert.NoError(t, validateAlarm(&speaker, AlarmSettings{Mode: AlarmModeWeekly, Volume: testhelper.Ptr(30)}))
+	assert.Error(t, validateAlarm(&speaker, AlarmSettings{Mode: "daily"}))
+	assert.Error(t, validateAlarm(&speaker, AlarmSettings{Volume: testhelper.Ptr(61)}))
+	assert.Error(t, validateAlarm(&speaker, AlarmSettings{FadeType: testhelper.Ptr(3)}))
+
+	detail := AlarmDetail{Day: "monday"}
+	detail.PlaybackType = AlarmResume
+	detail.Resume.Input = "cd"
+	assert.NoError(t, validateAlarm(&speaker, AlarmSettings{Detail: &detail}))
+	detail.Resume.Input = "tuner"
+	assert.Error(t, validateAlarm(&speaker, AlarmSettings{Detail: &detail}))
+	detail.Day = "someday"
+	assert.Error(t, validateAlarm(&speaker, AlarmSettings{Detail: &detail}))
+
+	speaker.Features = &GetFeaturesResponse{}
+	assert.ErrorIs(t, validateAlarm(&speaker, AlarmSettings{}), ErrNotSupported)
+}
+
+func TestFuncStatus(t *testing.T) {
+	response := GetFuncStatusResponse{}
+	err := json.Unmarshal([]byte(`{"response_code":0,"auto_power_standby":true,"speaker_a":true,"speaker_b":false,"dimmer":-1}`), &response)
+	assert.NoError(t, err)
+
+	assert.True(t, response.Enabled(AutoPowerStandby))
+	assert.True(t, response.Enabled(SpeakerA))
+	assert.False(t, response.Enabled(SpeakerB))
+	assert.Equal(t, -1, response.Value(Dimmer))
+
+	features := GetFeaturesResponse{}
+	features.System.FuncList = []string{"dimmer", "speaker_a"}
+	speaker := Speaker{Features: &features}
+	assert.NoError(t, requireSystemFunc(&speaker, SpeakerA))
+	assert.ErrorIs(t, requireSystemFunc(&speaker, PartyMode), ErrNotSupported)
+}
+
+func TestNameText(t *testing.T) {
+	names := GetNameTextResponse{}
+	err := json.Unmarshal([]byte(`{"response_code":0,"zone_list":[{"id":"main","text":"Kitchen"}],"input_list":[{"id":"net_radio","text":"Radio"}]}`), &names)
+	assert.NoError(t, err)
+
+	name, ok := names.Name("main")
+	assert.True(t, ok)
+	assert.Equal(t, "Kitchen", name)
+	name, _ = names.Name("net_radio")
+	assert.Equal(t, "Radio", name)
+	_, ok = names.Name("cd")
+	assert.False(t, ok)
+
+	speaker := Speaker{Features: &GetFeaturesResponse{}}
+	assert.Error(t, SetNameText(&speaker, "main", ""))
+	assert.ErrorIs(t, SetNameText(&speaker, "net_radio", "Radio"), ErrNotSupported)
+}
+
+func TestEventToSpeakerUnknownRefresh(t *testing.T) {
+	event := ZonedStatusEvent{}
+	err := json.Unmarshal([]byte(`{"device_id":"unknown","system":{"func_status_updated":true,"name_text_updated":true},"clock":{"settings_updated":true}}`), &event)
+	assert.NoError(t, err)
+
+	spkr := eventToSpeaker(event)
+	assert.Equal(t, "unknown", spkr.ID)
+	assert.Nil(t, spkr.FuncStatus)
+	assert.Nil(t, spkr.Clock)
+	assert.Equal(t, "", spkr.FriendlyName)
+}
+
+func TestApiError(t *testing.T) {
+	var err error = &ApiError{ResponseCodeUpdating}
+	assert.Equal(t, "API response returned 99 (firmware updating)", err.Error())
+	assert.True(t, IsUpdating(fmt.Errorf("wrapped: %w", err)))
+	assert.False(t, IsUpdating(&ApiError{3}))
+	assert.Equal(t, "API response returned 42", (&ApiError{42}).Error())
+	assert.Equal(t, "guarded", (&ApiError{5}).Reason())
+	assert.Equal(t, "response code 42", (&ApiError{42}).Reason())
+}
+
+func TestUpdatingInDiscovery(t *testing.T) {
+	server, _ := fakeYxc(t, map[string]string{
+		"main/getStatus":       `{"response_code":99}`,
+		"system/getDeviceInfo": `{"response_code":99}`,
+	})
+	// no ID in discovery
+	spkr := Speaker{BaseUrl: server.URL + "/"}
+
+	assert.NoError(t, loadSpeaker(&spkr, 0))
+	assert.True(t, spkr.IsUpdating())
+	assert.Equal(t, "", spkr.ID)
+	assert.NotContains(t, GetMetrics().Errors, ErrorKey{"", ResponseCodeUpdating})
+}
+
+func TestWatchFirmwareUpdate(t *testing.T) {
+	pollInterval, updateTimeout := firmwarePollInterval, firmwareUpdateTimeout
+	t.Cleanup(func() {
+		firmwarePollInterval, firmwareUpdateTimeout = pollInterval, updateTimeout
+	})
+	firmwarePollInterval = time.Millisecond
+	// next waits for the first update of the speaker which matches, the publishes race each other
+	next := func(id string, matches func(*Speaker) bool) *Speaker {
+		for {
+			select {
+			case update := <-speakerChan:
+				if update.ID == id && matches(update) {
+					return update
+				}
+			case <-time.After(time.Second):
+				t.Fatal("no update for", id)
+				return nil
+			}
+		}
+	}
+
+	// found during the update without an ID, the update is done at the first poll
+	done, _ := fakeYxc(t, map[string]string{
+		"main/getStatus":       `{"response_code":0,"power":"on","volume":10,"max_volume":60,"mute":false}`,
+		"system/getDeviceInfo": `{"response_code":0,"device_id":"updated"}`,
+	})
+	t.Cleanup(func() {
+		discoveredLock.Lock()
+		defer discoveredLock.Unlock()
+		delete(discovered, "updated")
+	})
+	isUpdating := true
+	watchFirmwareUpdate(&Speaker{FriendlyName: "Kitchen", BaseUrl: done.URL + "/", Updating: &isUpdating}, 0)
+	update := next("updated", func(update *Speaker) bool { return !update.PartialUpdate })
+	assert.False(t, update.IsUpdating())
+	assert.Equal(t, On, update.Power)
+	assert.NotNil(t, update.Mute)
+	assert.NotNil(t, update.Features)
+	_, known := lookup("updated")
+	assert.True(t, known)
+
+	// still updating when the time is up
+	firmwareUpdateTimeout = 5 * time.Millisecond
+	stuck, _ := fakeYxc(t, map[string]string{
+		"main/getStatus": `{"response_code":99}`,
+	})
+	watchFirmwareUpdate(&Speaker{ID: "stuck", FriendlyName: "Bath", BaseUrl: stuck.URL + "/"}, 0)
+	update = next("stuck", func(update *Speaker) bool { return update.Online != nil })
+	assert.True(t, update.PartialUpdate)
+	assert.False(t, update.IsUpdating())
+	assert.False(t, update.IsOnline())
+}
+
+func TestNetworkStatus(t *testing.T) {
+	status := GetNetworkStatusResponse{}
+	err := json.Unmarshal([]byte(`{"response_code":0,"connection":"wireless_lan","wireless_lan":{"ssid":"Home","ch":6,"strength":60},"mac_address":{"wired":"00A0DE000001","wireless_lan":"00A0DE000002"}}`), &status)
+	assert.NoError(t, err)
+	assert.True(t, status.IsWireless())
+	assert.Equal(t, "00A0DE000002", status.MacAddressInUse())
+	assert.Equal(t, "▂▄▆_", status.SignalBars())
+	assert.Nil(t, status.Vlan)
+
+	status.WirelessLan.Strength = 100
+	assert.Equal(t, "▂▄▆█", status.SignalBars())
+	status.WirelessLan.Strength = 0
+	assert.Equal(t, "▂___", status.SignalBars())
+
+	status.Connection = ConnectionWired
+	assert.Equal(t, "", status.SignalBars())
+	assert.Equal(t, "00A0DE000001", status.MacAddressInUse())
+}
+
+func TestEventStats(t *testing.T) {
+	assert.True(t, GetEventStats("unknown").Expired())
+	assert.Equal(t, time.Duration(0), GetEventStats("unknown").SubscriptionAge())
+
+	delete(eventStats, "stats")
+	subscribed("stats")
+	received("stats")
+	received("stats")
+	stats := GetEventStats("stats")
+	assert.False(t, stats.Expired())
+	assert.Equal(t, 2, stats.Count)
+	assert.False(t, stats.LastEvent.IsZero())
+
+	stats.Subscribed = time.Now().Add(-EventSubscriptionTimeout - time.Second)
+	assert.True(t, stats.Expired())
+}
+
+func TestBluetooth(t *testing.T) {
+	info := GetBluetoothInfoResponse{}
+	err := json.Unmarshal([]byte(`{"response_code":0,"bluetooth_standby":true,"bluetooth_tx_setting":true,"bluetooth_device":{"connected":true,"name":"Headphones","address":"00:11:22:33:44:55"}}`), &info)
+	assert.NoError(t, err)
+	assert.True(t, info.BluetoothTxSetting)
+	assert.True(t, info.BluetoothDevice.Connected)
+	assert.Equal(t, "Headphones", info.BluetoothDevice.Name)
+	assert.Equal(t, "00:11:22:33:44:55", info.BluetoothDevice.Address)
+
+	features := GetFeaturesResponse{}
+	features.System.FuncList = []string{"bluetooth_standby"}
+	speaker := Speaker{Features: &features}
+	assert.True(t, speaker.SupportsBluetooth())
+	assert.ErrorIs(t, SetBluetoothTxSetting(&speaker, true), ErrNotSupported)
+	assert.ErrorIs(t, DisconnectBluetoothDevice(&speaker), ErrNotSupported)
+	assert.Error(t, ConnectBluetoothDevice(&speaker, ""))
+	assert.False(t, Speaker{}.SupportsBluetooth())
+}
+
+func TestAlbumArt(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/YamahaRemoteControl/AllArtworks/art_1.png", r.URL.Path)
+		_ = png.Encode(w, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	}))
+	defer server.Close()
+
+	info := GetPlayInfoResponse{}
+	err := json.Unmarshal([]byte(`{"response_code":0,"input":"server","albumart_url":"/YamahaRemoteControl/AllArtworks/art_1.png","albumart_id":1}`), &info)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, info.AlbumartId)
+
+	// the server's port is random, so the cache has no entry yet
+	speaker := Speaker{ID: server.URL, BaseUrl: server.URL + "/"}
+	art, err := AlbumArt(&speaker, info.PlayInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, art.Bounds().Dx())
+	_, err = AlbumArt(&speaker, info.PlayInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, requests)
+
+	art, err = AlbumArt(&speaker, PlayInfo{})
+	assert.NoError(t, err)
+	assert.Nil(t, art)
+}
+
+func TestMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"response_code":4}`))
+	}))
+	// the server's port is random, so there are no metrics for it yet
+	speaker := Speaker{ID: server.URL, BaseUrl: server.URL + "/"}
+	latency := GetMetrics().Latency["main/setMute"]
+
+	assert.Error(t, SetMute(&speaker, true))
+	server.Close()
+	assert.Error(t, SetMute(&speaker, true))
+
+	metrics := GetMetrics()
+	assert.Equal(t, uint64(1), metrics.Errors[ErrorKey{speaker.ID, 4}])
+	assert.Equal(t, uint64(1), metrics.Failures[speaker.ID])
+	assert.WithinDuration(t, time.Now(), metrics.LastSeen[speaker.ID], time.Minute)
+	assert.Equal(t, latency.Count+2, metrics.Latency["main/setMute"].Count)
+	assert.Len(t, metrics.Latency["main/setMute"].Buckets, len(LatencyBuckets))
+
+	histogram := Histogram{}
+	histogram.observe(0.03)
+	histogram.observe(20)
+	assert.Equal(t, []uint64{0, 0, 1, 1, 1, 1, 1, 1, 1, 1}, histogram.Buckets)
+	assert.Equal(t, uint64(2), histogram.Count)
+	assert.Equal(t, 20.03, histogram.Sum)
+}
+
+// fakeYxc answers the YXC paths with the responses, other paths with response_code 0, and records
+// the requests with their bodies
+func fakeYxc(t *testing.T, responses map[string]string) (*httptest.Server, *[]string) {
+	requests := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/YamahaExtendedControl/v1/")
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, strings.TrimSpace(strings.TrimPrefix(r.URL.RequestURI(), "/YamahaExtendedControl/v1/")+" "+string(body)))
+		if response, ok := responses[path]; ok {
+			_, _ = w.Write([]byte(response))
+			return
+		}
+		_, _ = w.Write([]byte(`{"response_code":0}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestCaptureScene(t *testing.T) {
+	kitchenServer, _ := fakeYxc(t, map[string]string{
+		"netusb/getPresetInfo":     `{"response_code":0,"preset_info":[{"input":"net_radio","text":"Jazz"},{"input":"net_radio","text":"News"}]}`,
+		"dist/getDistributionInfo": `{"response_code":0,"role":"server","client_list":[{"ip_address":"localhost","data_type":"base"}]}`,
+	})
+	livingServer, _ := fakeYxc(t, map[string]string{
+		"dist/getDistributionInfo": `{"response_code":0,"role":"client"}`,
+	})
+	features := &GetFeaturesResponse{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"system":{"input_list":[{"id":"net_radio","play_info_type":"netusb"}]}}`), features))
+	kitchen := &Speaker{ID: "k", FriendlyName: "Kitchen", BaseUrl: kitchenServer.URL + "/", Power: On, Input: "net_radio",
+		Volume: testhelper.Ptr(int8(30)), Mute: testhelper.Ptr(false), Features: features,
+		PlayInfo: &PlayInfo{Input: "net_radio", Artist: "News", Track: "Headlines"}}
+	living := &Speaker{ID: "l", FriendlyName: "Living", BaseUrl: strings.Replace(livingServer.URL, "127.0.0.1", "localhost", 1) + "/",
+		Power: On, Input: "mc_link", Volume: testhelper.Ptr(int8(20)), Mute: testhelper.Ptr(true)}
+	bedroom := &Speaker{ID: "b", FriendlyName: "Bedroom", BaseUrl: "http://192.0.2.1/", Power: Standby, Input: "cd"}
+
+	scene, err := CaptureScene([]*Speaker{kitchen, living, bedroom})
+	assert.NoError(t, err)
+	assert.Equal(t, []SpeakerState{
+		{ID: "k", Name: "Kitchen", Power: On, Input: "net_radio", Preset: 2, Volume: testhelper.Ptr(30), Mute: testhelper.Ptr(false)},
+		{ID: "l", Name: "Living", Power: On, Volume: testhelper.Ptr(20), Mute: testhelper.Ptr(true), LinkServer: "k"},
+		{ID: "b", Name: "Bedroom", Power: Standby},
+	}, scene.Speakers)
+}
+
+func TestApplyScene(t *testing.T) {
+	kitchenServer, kitchenRequests := fakeYxc(t, map[string]string{
+		"dist/getDistributionInfo": `{"response_code":0,"role":"none"}`,
+	})
+	livingServer, livingRequests := fakeYxc(t, map[string]string{
+		"dist/getDistributionInfo": `{"response_code":0,"role":"client"}`,
+	})
+	bedroomServer, bedroomRequests := fakeYxc(t, map[string]string{
+		"dist/getDistributionInfo": `{"response_code":0,"role":"none"}`,
+		"main/setVolume":           `{"response_code":4}`,
+	})
+	kitchen := &Speaker{ID: "k", FriendlyName: "Kitchen", BaseUrl: kitchenServer.URL + "/", Power: Standby, MaxVolume: 60}
+	living := &Speaker{ID: "l", FriendlyName: "Living", BaseUrl: strings.Replace(livingServer.URL, "127.0.0.1", "localhost", 1) + "/", Power: On, MaxVolume: 60}
+	bedroom := &Speaker{ID: "new id", FriendlyName: "Bedroom", BaseUrl: bedroomServer.URL + "/", Power: On, MaxVolume: 60}
+
+	scene := Scene{Speakers: []SpeakerState{
+		{ID: "k", Name: "Kitchen", Power: On, Input: "net_radio", Preset: 3, Volume: testhelper.Ptr(30), Mute: testhelper.Ptr(false)},
+		{ID: "l", Name: "Living", Power: On, Volume: testhelper.Ptr(25), LinkServer: "k"},
+		{ID: "b", Name: "bedroom", Power: On, Input: "cd", Volume: testhelper.Ptr(10)},
+		{ID: "g", Name: "Garage", Power: Standby},
+	}}
+	limit := func(speaker *Speaker, volume int) int {
+		if speaker == kitchen && volume > 28 {
+			return 28
+		}
+		return volume
+	}
+	err := ApplyScene(scene, []*Speaker{kitchen, living, bedroom}, limit)
+
+	var speakerErrors SpeakerErrors
+	assert.ErrorAs(t, err, &speakerErrors)
+	assert.Len(t, speakerErrors, 2)
+	assert.ErrorContains(t, speakerErrors["Garage"], "not found")
+	assert.ErrorContains(t, speakerErrors["bedroom"], "set volume: API response returned 4")
+
+	assert.Equal(t, "main/setPower?power=on", (*kitchenRequests)[0])
+	assert.Equal(t, "netusb/recallPreset?zone=main&num=3", (*kitchenRequests)[2])
+	assert.Contains(t, (*kitchenRequests)[3], `dist/setServerInfo {"client_list":["localhost"],`)
+	assert.Equal(t, []string{"dist/startDistribution?num=0", "main/setVolume?volume=28", "main/setMute?enable=false"}, (*kitchenRequests)[4:])
+
+	assert.Equal(t, "dist/getDistributionInfo", (*livingRequests)[0])
+	assert.Equal(t, `dist/setClientInfo {"group_id":"","zone":["main"]}`, (*livingRequests)[1])
+	assert.Contains(t, (*livingRequests)[2], `dist/setClientInfo {"group_id":"`)
+	assert.Equal(t, "main/setVolume?volume=25", (*livingRequests)[3])
+
+	assert.Equal(t, []string{"dist/getDistributionInfo", "main/setInput?input=cd", "main/setVolume?volume=10"}, *bedroomRequests)
+}
+
+func TestSoapCall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch r.Header.Get("SOAPAction") {
+		case `"urn:schemas-upnp-org:service:AVTransport:1#SetAVTransportURI"`:
+			assert.Contains(t, string(body), "<InstanceID>0</InstanceID><CurrentURI>http://host/a&amp;b.mp3</CurrentURI><CurrentURIMetaData>&lt;DIDL-Lite")
+			_, _ = w.Write([]byte(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:SetAVTransportURIResponse xmlns:u="urn:schemas-upnp-org:service:AVTransport:1"/></s:Body></s:Envelope>`))
+		case `"urn:schemas-upnp-org:service:AVTransport:1#Seek"`:
+			assert.Contains(t, string(body), "<Unit>REL_TIME</Unit><Target>0:01:05</Target>")
+			_, _ = w.Write([]byte(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:SeekResponse xmlns:u="urn:schemas-upnp-org:service:AVTransport:1"/></s:Body></s:Envelope>`))
+		case `"urn:schemas-upnp-org:service:AVTransport:1#GetPositionInfo"`:
+			_, _ = w.Write([]byte(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:GetPositionInfoResponse xmlns:u="urn:schemas-upnp-org:service:AVTransport:1">` +
+				`<Track>1</Track><TrackDuration>0:03:20</TrackDuration><TrackURI>http://host/a.mp3</TrackURI><RelTime>0:01:05.500</RelTime><AbsTime>NOT_IMPLEMENTED</AbsTime></u:GetPositionInfoResponse></s:Body></s:Envelope>`))
+		case `"urn:schemas-upnp-org:service:RenderingControl:1#GetVolume"`:
+			assert.Equal(t, "/RenderingControl/ctrl", r.URL.Path)
+			_, _ = w.Write([]byte(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:GetVolumeResponse xmlns:u="urn:schemas-upnp-org:service:RenderingControl:1">` +
+				`<CurrentVolume>35</CurrentVolume></u:GetVolumeResponse></s:Body></s:Envelope>`))
+		case `"urn:schemas-upnp-org:service:AVTransport:1#GetTransportInfo"`:
+			_, _ = w.Write([]byte(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:GetTransportInfoResponse xmlns:u="urn:schemas-upnp-org:service:AVTransport:1">` +
+				`<CurrentTransportState>PLAYING</CurrentTransportState><CurrentTransportStatus>OK</CurrentTransportStatus><CurrentSpeed>1</CurrentSpeed></u:GetTransportInfoResponse></s:Body></s:Envelope>`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring>` +
+				`<detail><UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>701</errorCode><errorDescription>Transition not available</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>`))
+		}
+	}))
+	defer server.Close()
+	speaker := Speaker{FriendlyName: "Kitchen", UpnpServices: map[string]UpnpService{
+		AVTransport:      {Type: "urn:schemas-upnp-org:service:AVTransport:1", ControlUrl: server.URL + "/AVTransport/ctrl"},
+		RenderingControl: {Type: "urn:schemas-upnp-org:service:RenderingControl:1", ControlUrl: server.URL + "/RenderingControl/ctrl"},
+	}}
+
+	assert.NoError(t, SetAVTransportURI(&speaker, "http://host/a&b.mp3", DidlLite("http://host/a&b.mp3", DidlItem{Title: "A&B", MimeType: "audio/mpeg"})))
+	assert.Contains(t, DidlLite("http://host/a.mp3", DidlItem{Title: "A", Artist: "B&C"}), `<upnp:artist>B&amp;C</upnp:artist><upnp:class>object.item.audioItem.musicTrack</upnp:class><res protocolInfo="http-get:*:*:*">`)
+	info, err := GetTransportInfo(&speaker)
+	assert.NoError(t, err)
+	assert.Equal(t, TransportPlaying, info.CurrentTransportState)
+	assert.EqualError(t, AVTransportStop(&speaker), "UPnP Stop failed with 701 (Transition not available)")
+	assert.ErrorIs(t, AVTransportPlay(&Speaker{}), ErrNotSupported)
+
+	assert.NoError(t, Seek(&speaker, 65*time.Second))
+	position, err := GetPositionInfo(&speaker)
+	assert.NoError(t, err)
+	assert.Equal(t, 65500*time.Millisecond, position.Position())
+	assert.Equal(t, 200*time.Second, position.Duration())
+	assert.Equal(t, time.Duration(0), ParseUpnpDuration(position.AbsTime))
+	assert.Equal(t, "1:00:00", FormatUpnpDuration(time.Hour))
+
+	volume, err := GetUpnpVolume(&speaker)
+	assert.NoError(t, err)
+	assert.Equal(t, 35, volume)
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	kitchenServer, kitchenRequests := fakeYxc(t, map[string]string{
+		"netusb/getPresetInfo":     `{"response_code":0,"preset_info":[]}`,
+		"dist/getDistributionInfo": `{"response_code":0,"role":"none"}`,
+		"netusb/getPlayInfo":       `{"response_code":0,"input":"usb","playback":"play","play_time":42,"total_time":200}`,
+		"main/getStatus":           `{"response_code":0,"power":"on","input":"server","volume":40,"mute":false}`,
+	})
+	features := &GetFeaturesResponse{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"system":{"input_list":[{"id":"usb","play_info_type":"netusb"}]}}`), features))
+	kitchen := &Speaker{ID: "k", FriendlyName: "Kitchen", BaseUrl: kitchenServer.URL + "/", Power: On, Input: "usb",
+		Volume: testhelper.Ptr(int8(30)), Mute: testhelper.Ptr(false), MaxVolume: 60, Features: features}
+
+	snapshot, err := Snapshot([]*Speaker{kitchen})
+	assert.NoError(t, err)
+	assert.Equal(t, PlaybackPosition{Input: "usb", Playback: Play, PlayTime: 42, Seekable: true}, snapshot.Playback["k"])
+
+	*kitchenRequests = (*kitchenRequests)[:0]
+	assert.NoError(t, Restore(snapshot, nil))
+	assert.Equal(t, []string{
+		"main/getStatus",
+		"dist/getDistributionInfo",
+		"main/setInput?input=usb",
+		"main/setVolume?volume=30",
+		"main/setMute?enable=false",
+		"netusb/setPlayback?playback=play",
+		"netusb/setPlayPosition?position=42",
+	}, *kitchenRequests)
+}
+
+func TestUpnpServices(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/MediaRenderer/desc.xml":
+			_, _ = w.Write([]byte(`<root xmlns="urn:schemas-upnp-org:device-1-0"><device><friendlyName>Kitchen</friendlyName><serviceList>` +
+				`<service><serviceType>urn:schemas-upnp-org:service:AVTransport:1</serviceType><serviceId>urn:upnp-org:serviceId:AVTransport</serviceId>` +
+				`<SCPDURL>/AVTransport/desc.xml</SCPDURL><controlURL>AVTransport/ctrl</controlURL><eventSubURL>/AVTransport/event</eventSubURL></service>` +
+				`<service><serviceType>urn:schemas-upnp-org:service:RenderingControl:1</serviceType><serviceId>urn:upnp-org:serviceId:RenderingControl</serviceId>` +
+				`<SCPDURL>/RenderingControl/desc.xml</SCPDURL><controlURL>/RenderingControl/ctrl</controlURL><eventSubURL>/RenderingControl/event</eventSubURL></service>` +
+				`</serviceList></device></root>`))
+		case "/AVTransport/desc.xml":
+			_, _ = w.Write([]byte(`<scpd xmlns="urn:schemas-upnp-org:service-1-0"><actionList>` +
+				`<action><name>Play</name><argumentList><argument><name>InstanceID</name><direction>in</direction></argument></argumentList></action>` +
+				`<action><name>Stop</name></action></actionList></scpd>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	renderer, err := ssdp2.GetMediaRenderer(&ssdp2.Service{Location: server.URL + "/MediaRenderer/desc.xml"})
+	assert.NoError(t, err)
+	speaker := Speaker{FriendlyName: "Kitchen", UpnpServices: upnpServices(renderer)}
+	assert.Equal(t, UpnpService{
+		Type:       "urn:schemas-upnp-org:service:AVTransport:1",
+		ControlUrl: server.URL + "/AVTransport/ctrl",
+		ScpdUrl:    server.URL + "/AVTransport/desc.xml",
+	}, speaker.UpnpServices[AVTransport])
+	assert.True(t, speaker.SupportsUpnp(RenderingControl))
+	assert.False(t, speaker.SupportsUpnp(ConnectionManager))
+
+	actions, err := GetUpnpActions(&speaker, AVTransport)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Play", "Stop"}, actions)
+	_, err = GetUpnpActions(&speaker, ConnectionManager)
+	assert.ErrorIs(t, err, ErrNotSupported)
+}
+
+func TestFadeVolume(t *testing.T) {
+	server, requests := fakeYxc(t, map[string]string{
+		"main/getStatus": `{"response_code":0,"volume":10,"max_volume":60}`,
+	})
+	speaker := &Speaker{ID: server.URL, FriendlyName: "Kitchen", BaseUrl: server.URL + "/"}
+
+	assert.NoError(t, FadeVolume(speaker, 0, 50*time.Millisecond, FadeLog))
+	assert.Equal(t, "main/getStatus", (*requests)[0])
+	last := 10
+	for _, request := range (*requests)[1:] {
+		volume, err := strconv.Atoi(strings.TrimPrefix(request, "main/setVolume?volume="))
+		assert.NoError(t, err, request)
+		assert.Less(t, volume, last)
+		last = volume
+	}
+	assert.Equal(t, 0, last)
+	assert.Greater(t, FadeLog.progress(0.2), FadeLinear.progress(0.2))
+
+	// shorter than a tick, the volume is set at once
+	*requests = (*requests)[:0]
+	assert.NoError(t, FadeVolume(speaker, 40, time.Nanosecond, FadeLinear))
+	assert.Equal(t, []string{"main/getStatus", "main/setVolume?volume=40"}, *requests)
+	// more steps than ticks, the steps get bigger
+	*requests = (*requests)[:0]
+	assert.NoError(t, FadeVolume(speaker, 40, 20*time.Millisecond, FadeLinear))
+	assert.Equal(t, "main/setVolume?volume=40", (*requests)[len(*requests)-1])
+	assert.Equal(t, 1.0, FadeLog.progress(1))
+
+	done := make(chan error)
+	go func() {
+		done <- FadeVolume(speaker, 40, time.Minute, FadeLinear)
+	}()
+	assert.Eventually(t, func() bool {
+		fadesLock.Lock()
+		defer fadesLock.Unlock()
+		return fades[speaker.ID] != nil
+	}, time.Second, time.Millisecond)
+	// the echo of the start volume is no change
+	fadeVolumeEvent(speaker.ID, 10)
+	select {
+	case err := <-done:
+		t.Fatal("fade stopped early:", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	fadeVolumeEvent(speaker.ID, 25)
+	assert.ErrorIs(t, <-done, ErrFadeCancelled)
+
+	// only the last and the in-flight volume are the fade's own, going back to an earlier one isn't
+	f := &fade{last: 10, inFlight: 10}
+	f.setting(11)
+	f.done(11)
+	f.setting(12)
+	assert.True(t, f.own(11))
+	assert.True(t, f.own(12))
+	assert.False(t, f.own(10))
+
+	curve, err := ParseFadeCurve("")
+	assert.NoError(t, err)
+	assert.Equal(t, FadeLinear, curve)
+	_, err = ParseFadeCurve("exp")
+	assert.EqualError(t, err, `unknown fade curve "exp", expected linear or log`)
+}
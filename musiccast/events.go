@@ -0,0 +1,126 @@
+package musiccast
+
+import (
+	"sync"
+	"time"
+)
+
+// speakers drop the event subscription if there was no request with X-AppPort for this long
+const EventSubscriptionTimeout = 10 * time.Minute
+
+// renew well before the speaker drops the subscription
+const eventRenewInterval = EventSubscriptionTimeout / 2
+
+// check this often whether the speakers still answer, a speaker is offline after presenceMisses checks
+// without an answer
+const presenceInterval = 30 * time.Second
+const presenceMisses = 2
+
+// EventStats tell how healthy the event subscription of a speaker is
+type EventStats struct {
+	Subscribed time.Time
+	LastEvent  time.Time
+	Count      int
+}
+
+// SubscriptionAge is the time since the last subscription, 0 if never subscribed
+func (o EventStats) SubscriptionAge() time.Duration {
+	if o.Subscribed.IsZero() {
+		return 0
+	}
+	return time.Since(o.Subscribed)
+}
+
+// Expired checks if the speaker has likely dropped the subscription
+func (o EventStats) Expired() bool {
+	return o.Subscribed.IsZero() || o.SubscriptionAge() > EventSubscriptionTimeout
+}
+
+var eventStats = make(map[string]EventStats)
+var eventStatsLock sync.Mutex
+
+func GetEventStats(speakerId string) EventStats {
+	eventStatsLock.Lock()
+	defer eventStatsLock.Unlock()
+	return eventStats[speakerId]
+}
+
+func subscribed(speakerId string) {
+	eventStatsLock.Lock()
+	defer eventStatsLock.Unlock()
+	stats := eventStats[speakerId]
+	stats.Subscribed = time.Now()
+	eventStats[speakerId] = stats
+}
+
+func received(speakerId string) {
+	eventStatsLock.Lock()
+	defer eventStatsLock.Unlock()
+	stats := eventStats[speakerId]
+	stats.LastEvent = time.Now()
+	stats.Count++
+	eventStats[speakerId] = stats
+}
+
+var renewing = make(map[string]bool)
+var renewingLock sync.Mutex
+
+// keepSubscribed renews the event subscription of the speaker until the process exits and publishes
+// whether the speaker is still Online
+func keepSubscribed(speaker Speaker, appPort int) {
+	renewingLock.Lock()
+	defer renewingLock.Unlock()
+	if renewing[speaker.ID] || appPort == 0 {
+		return
+	}
+	renewing[speaker.ID] = true
+
+	target := Speaker{ID: speaker.ID, BaseUrl: speaker.BaseUrl, FriendlyName: speaker.FriendlyName}
+	go func() {
+		renewed := time.Now()
+		misses := 0
+		for {
+			time.Sleep(presenceInterval)
+			// a rediscovered speaker may have a new address
+			if known, ok := lookup(target.ID); ok {
+				target.BaseUrl = known.BaseUrl
+				target.FriendlyName = known.FriendlyName
+			}
+			// a speaker which was gone may have dropped the subscription
+			renew := misses >= presenceMisses || time.Since(renewed) >= eventRenewInterval
+			port := 0
+			if renew {
+				port = appPort
+			}
+			_, err := GetStatus(&target, port)
+			if err != nil {
+				misses++
+				if misses == presenceMisses {
+					// keep trying, the speaker might just be unplugged for now
+					log.Warn("Speaker stopped answering:", target.FriendlyName, err)
+					publishOnline(target.ID, false, nil)
+				}
+				continue
+			}
+			misses = 0
+			if !renew {
+				continue
+			}
+			renewed = time.Now()
+			subscribed(target.ID)
+			// the signal changes without events, so refresh it along with the subscription
+			if err = updateNetworkStatus(&target); err != nil {
+				log.Warn("Failed to refresh network status for device:", target.FriendlyName, err)
+			}
+			publishOnline(target.ID, true, target.Network)
+		}
+	}()
+}
+
+// publishOnline sends the online state and the network status if known
+func publishOnline(id string, online bool, network *NetworkStatus) {
+	update := Speaker{ID: id, Online: &online, Network: network, PartialUpdate: true}
+	go func() {
+		speakerChan <- &update
+	}()
+}
@@ -0,0 +1,234 @@
+package musiccast
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// FadeCurve shapes the volume over the time of a fade
+type FadeCurve string
+
+const (
+	// FadeLinear changes the volume by the same steps over the whole fade. The speaker's volume
+	// steps are about the same in dB, so this sounds even.
+	FadeLinear FadeCurve = "linear"
+	// FadeLog changes the volume fast at the beginning and slowly towards the target
+	FadeLog FadeCurve = "log"
+)
+
+// ErrFadeCancelled is returned by FadeVolume when someone else changed the volume or CancelFade
+// was called
+var ErrFadeCancelled = errors.New("volume fade cancelled")
+
+// check this often at most so the log curve gets its fast steps in, and at least this rarely so
+// short fades don't flood the speaker
+const (
+	fadeMaxTick = 250 * time.Millisecond
+	fadeMinTick = 10 * time.Millisecond
+)
+
+// progress maps the elapsed part of the fade (0 to 1) to the part of the volume change
+func (c FadeCurve) progress(elapsed float64) float64 {
+	if c == FadeLog {
+		return math.Log10(1 + 9*elapsed)
+	}
+	return elapsed
+}
+
+// ParseFadeCurve accepts linear and log, empty is linear
+func ParseFadeCurve(text string) (FadeCurve, error) {
+	switch FadeCurve(text) {
+	case "", FadeLinear:
+		return FadeLinear, nil
+	case FadeLog:
+		return FadeLog, nil
+	}
+	return "", fmt.Errorf("unknown fade curve %q, expected linear or log", text)
+}
+
+type fade struct {
+	cancel chan struct{}
+	once   sync.Once
+	// the volume the fade set last and the one it's setting, their events are no reason to cancel
+	lock     sync.Mutex
+	last     int
+	inFlight int
+}
+
+func (f *fade) stop() {
+	f.once.Do(func() {
+		close(f.cancel)
+	})
+}
+
+func (f *fade) setting(volume int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.inFlight = volume
+}
+
+func (f *fade) done(volume int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.last = volume
+}
+
+func (f *fade) own(volume int) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return volume == f.last || volume == f.inFlight
+}
+
+var fades = make(map[string]*fade)
+var fadesLock sync.Mutex
+
+// FadeVolume changes the volume from the current one to the target over the duration with absolute
+// volume calls and returns when it's done. It replaces a running fade of the speaker and stops with
+// ErrFadeCancelled if a volume event reports another volume than the one the fade set last or is
+// setting, like when someone uses the remote. Events are only seen while the speakers are scanned,
+// see StartScan.
+func FadeVolume(speaker *Speaker, target int, duration time.Duration, curve FadeCurve) error {
+	return fadeVolume(speaker, target, duration, curve, nil)
+}
+
+// fadeVolume is FadeVolume which also stops when cancel is closed
+func fadeVolume(speaker *Speaker, target int, duration time.Duration, curve FadeCurve, cancel <-chan struct{}) error {
+	status, err := GetStatus(speaker, 0)
+	if err != nil {
+		return err
+	}
+	from := int(status.Volume)
+	if target < 0 {
+		target = 0
+	}
+	if status.MaxVolume > 0 && target > int(status.MaxVolume) {
+		target = int(status.MaxVolume)
+	}
+	steps := target - from
+	if steps < 0 {
+		steps = -steps
+	}
+	if steps == 0 {
+		return nil
+	}
+	if duration < fadeMinTick {
+		return SetVolumeTo(speaker, target)
+	}
+
+	f := &fade{cancel: make(chan struct{}), last: from, inFlight: from}
+	fadesLock.Lock()
+	if running, ok := fades[speaker.ID]; ok {
+		running.stop()
+	}
+	fades[speaker.ID] = f
+	fadesLock.Unlock()
+	defer func() {
+		fadesLock.Lock()
+		if fades[speaker.ID] == f {
+			delete(fades, speaker.ID)
+		}
+		fadesLock.Unlock()
+	}()
+
+	tick := duration / time.Duration(4*steps)
+	if tick > fadeMaxTick {
+		tick = fadeMaxTick
+	}
+	if tick < fadeMinTick {
+		tick = fadeMinTick
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	start := time.Now()
+	volume := from
+	for volume != target {
+		select {
+		case <-ticker.C:
+		case <-f.cancel:
+			return ErrFadeCancelled
+		case <-cancel:
+			return ErrFadeCancelled
+		}
+		elapsed := math.Min(1, float64(time.Since(start))/float64(duration))
+		next := from + int(math.Round(float64(target-from)*curve.progress(elapsed)))
+		if next == volume {
+			continue
+		}
+		f.setting(next)
+		if err = SetVolumeTo(speaker, next); err != nil {
+			return err
+		}
+		f.done(next)
+		volume = next
+	}
+	return nil
+}
+
+// CancelFade stops the running fade of the speaker, the volume stays where it is
+func CancelFade(speakerId string) {
+	fadesLock.Lock()
+	defer fadesLock.Unlock()
+	if f, ok := fades[speakerId]; ok {
+		f.stop()
+		delete(fades, speakerId)
+	}
+}
+
+// fadeVolumeEvent cancels the running fade of the speaker if someone else changed the volume
+func fadeVolumeEvent(speakerId string, volume int) {
+	fadesLock.Lock()
+	f, ok := fades[speakerId]
+	fadesLock.Unlock()
+	if !ok {
+		return
+	}
+	if !f.own(volume) {
+		log.Infof("Volume of %s changed to %d during fade - cancel", speakerId, volume)
+		f.stop()
+	}
+}
+
+// PowerOnFaded powers the speaker on and fades in from 0 to the volume, the volume it had before
+// if volume is negative
+func PowerOnFaded(speaker *Speaker, volume int, duration time.Duration, curve FadeCurve) error {
+	if volume < 0 {
+		status, err := GetStatus(speaker, 0)
+		if err != nil {
+			return err
+		}
+		volume = int(status.Volume)
+	}
+	if err := SetPower(speaker, On); err != nil {
+		return err
+	}
+	if err := SetVolumeTo(speaker, 0); err != nil {
+		return err
+	}
+	return FadeVolume(speaker, volume, duration, curve)
+}
+
+// StandbyFaded fades the volume out, puts the speaker to standby and restores the volume so it
+// doesn't come back silent. If the fade is cancelled the speaker keeps playing.
+func StandbyFaded(speaker *Speaker, duration time.Duration, curve FadeCurve) error {
+	return standbyFaded(speaker, duration, curve, nil)
+}
+
+func standbyFaded(speaker *Speaker, duration time.Duration, curve FadeCurve, cancel <-chan struct{}) error {
+	status, err := GetStatus(speaker, 0)
+	if err != nil {
+		return err
+	}
+	if err = fadeVolume(speaker, 0, duration, curve, cancel); err != nil {
+		return err
+	}
+	if err = SetPower(speaker, Standby); err != nil {
+		return err
+	}
+	if err = SetVolumeTo(speaker, int(status.Volume)); err != nil {
+		log.Debug("Failed to restore volume after fade:", speaker.FriendlyName, err)
+	}
+	return nil
+}
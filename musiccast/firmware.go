@@ -0,0 +1,144 @@
+package musiccast
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const firmwareType = "network"
+
+// how often and how long to poll a speaker which is updating its firmware, vars for the tests
+var firmwarePollInterval = 15 * time.Second
+var firmwareUpdateTimeout = 30 * time.Minute
+
+type IsNewFirmwareAvailableResponse struct {
+	ApiResponse
+	Available bool `json:"available"`
+}
+
+func (r IsNewFirmwareAvailableResponse) ErrorCode() int {
+	return r.ResponseCode
+}
+
+func IsNewFirmwareAvailable(speaker *Speaker) (bool, error) {
+	target := IsNewFirmwareAvailableResponse{}
+	err := callApi(speaker, "system/isNewFirmwareAvailable?type="+firmwareType, &target)
+	if err != nil {
+		return false, err
+	}
+	return target.Available, nil
+}
+
+// UpdateFirmware starts the network firmware update, the speaker is unusable until it's done
+func UpdateFirmware(speaker *Speaker) error {
+	err := callApi(speaker, "system/updateFirmware?type="+firmwareType, &ApiResponse{})
+	if err != nil {
+		return err
+	}
+	watchFirmwareUpdate(speaker, eventListenerPort)
+	return nil
+}
+
+// the speakers being watched by base URL, speakers found during the update may not know their ID
+var updating = make(map[string]bool)
+var updatingLock sync.Mutex
+
+// watchFirmwareUpdate publishes Updating for the speaker and polls until the update is done. Then it
+// loads the speaker again and publishes all of it, since a speaker found during the update has no
+// details and maybe not even an ID.
+func watchFirmwareUpdate(speaker *Speaker, appPort int) {
+	updatingLock.Lock()
+	defer updatingLock.Unlock()
+	if updating[speaker.BaseUrl] {
+		return
+	}
+	updating[speaker.BaseUrl] = true
+	log.Info("Firmware update in progress:", speaker.FriendlyName)
+	if speaker.ID != "" {
+		publishUpdating(speaker.ID, true)
+	}
+
+	// the discovered speaker has the UPnP services and the URLs a full update needs
+	target := *speaker
+	if known, ok := lookup(speaker.ID); ok {
+		target = known
+	}
+	go func() {
+		finished := awaitFirmwareUpdate(&target)
+		updatingLock.Lock()
+		delete(updating, target.BaseUrl)
+		updatingLock.Unlock()
+		if !finished {
+			log.Warn("Firmware update didn't finish in time:", target.FriendlyName, firmwareUpdateTimeout)
+			if target.ID != "" {
+				publishUpdateTimeout(target.ID)
+			}
+			return
+		}
+		log.Info("Firmware update finished:", target.FriendlyName)
+		reloadAfterUpdate(target, appPort)
+	}()
+}
+
+// awaitFirmwareUpdate polls the status until the speaker accepts calls again, false if that takes
+// longer than firmwareUpdateTimeout
+func awaitFirmwareUpdate(speaker *Speaker) bool {
+	deadline := time.Now().Add(firmwareUpdateTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(firmwarePollInterval)
+		_, err := GetStatus(speaker, 0)
+		if err == nil {
+			return true
+		}
+		// the speaker answers with ResponseCodeUpdating or reboots, so network errors are expected too
+		log.Debug("Firmware update still running:", speaker.FriendlyName, err)
+	}
+	return false
+}
+
+// reloadAfterUpdate loads the speaker like the discovery does and publishes it as a full update
+func reloadAfterUpdate(spkr Speaker, appPort int) {
+	spkr.Updating = nil
+	err := loadSpeaker(&spkr, appPort)
+	if err == nil && spkr.IsUpdating() {
+		// it rebooted into the next part of the update
+		watchFirmwareUpdate(&spkr, appPort)
+		return
+	}
+	if err == nil && spkr.ID == "" {
+		err = errors.New("no device ID")
+	}
+	if err != nil {
+		log.Warn("Failed to load speaker after firmware update:", spkr.FriendlyName, err)
+		if spkr.ID != "" {
+			publishUpdating(spkr.ID, false)
+		}
+		return
+	}
+	isUpdating := false
+	spkr.Updating = &isUpdating
+	subscribed(spkr.ID)
+	keepSubscribed(spkr, appPort)
+	remember(spkr)
+	go func() {
+		speakerChan <- &spkr
+	}()
+}
+
+func publishUpdating(id string, isUpdating bool) {
+	update := Speaker{ID: id, Updating: &isUpdating, PartialUpdate: true}
+	go func() {
+		speakerChan <- &update
+	}()
+}
+
+// publishUpdateTimeout stops showing the update, the speaker is offline until it answers the
+// presence checks again
+func publishUpdateTimeout(id string) {
+	isUpdating, online := false, false
+	update := Speaker{ID: id, Updating: &isUpdating, Online: &online, PartialUpdate: true}
+	go func() {
+		speakerChan <- &update
+	}()
+}
@@ -0,0 +1,140 @@
+package musiccast
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds in seconds of the YXC call latency histograms
+var LatencyBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram counts observations by LatencyBuckets
+type Histogram struct {
+	// Buckets are cumulative: Buckets[i] counts the observations <= LatencyBuckets[i]
+	Buckets []uint64
+	Count   uint64
+	// Sum of all observations in seconds
+	Sum float64
+}
+
+func (h *Histogram) observe(seconds float64) {
+	if h.Buckets == nil {
+		h.Buckets = make([]uint64, len(LatencyBuckets))
+	}
+	for i, bound := range LatencyBuckets {
+		if seconds <= bound {
+			h.Buckets[i]++
+		}
+	}
+	h.Count++
+	h.Sum += seconds
+}
+
+// ErrorKey identifies the YXC errors of a speaker
+type ErrorKey struct {
+	Speaker string
+	// Code is the YXC response_code
+	Code int
+}
+
+// Discovery results of SSDP services
+const (
+	DiscoveryMusicCast = "musiccast"
+	DiscoveryIgnored   = "ignored"
+	DiscoveryFailed    = "failed"
+)
+
+// Metrics are counters of the YXC calls and the discovery since the start of the process
+type Metrics struct {
+	// Latency of the YXC calls by endpoint like main/getStatus
+	Latency map[string]Histogram
+	// Errors counts responses with a response_code other than 0
+	Errors map[ErrorKey]uint64
+	// Failures counts calls by speaker ID which got no valid response at all
+	Failures map[string]uint64
+	// LastSeen is the time of the last response or event by speaker ID
+	LastSeen map[string]time.Time
+	// Discovery counts the SSDP services by result, see DiscoveryMusicCast
+	Discovery map[string]uint64
+}
+
+var metrics = Metrics{
+	Latency:   make(map[string]Histogram),
+	Errors:    make(map[ErrorKey]uint64),
+	Failures:  make(map[string]uint64),
+	LastSeen:  make(map[string]time.Time),
+	Discovery: make(map[string]uint64),
+}
+var metricsLock sync.Mutex
+
+// GetMetrics returns a copy of the current metrics
+func GetMetrics() Metrics {
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	copied := Metrics{
+		Latency:   make(map[string]Histogram, len(metrics.Latency)),
+		Errors:    make(map[ErrorKey]uint64, len(metrics.Errors)),
+		Failures:  make(map[string]uint64, len(metrics.Failures)),
+		LastSeen:  make(map[string]time.Time, len(metrics.LastSeen)),
+		Discovery: make(map[string]uint64, len(metrics.Discovery)),
+	}
+	for endpoint, histogram := range metrics.Latency {
+		histogram.Buckets = append([]uint64(nil), histogram.Buckets...)
+		copied.Latency[endpoint] = histogram
+	}
+	for key, count := range metrics.Errors {
+		copied.Errors[key] = count
+	}
+	for id, count := range metrics.Failures {
+		copied.Failures[id] = count
+	}
+	for id, seen := range metrics.LastSeen {
+		copied.LastSeen[id] = seen
+	}
+	for result, count := range metrics.Discovery {
+		copied.Discovery[result] = count
+	}
+	return copied
+}
+
+// observeCall records the latency and the outcome of a YXC call
+func observeCall(speakerId string, request *http.Request, start time.Time, err error) {
+	now := time.Now()
+	endpoint := strings.TrimPrefix(request.URL.Path, "/YamahaExtendedControl/v1/")
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	histogram := metrics.Latency[endpoint]
+	histogram.observe(now.Sub(start).Seconds())
+	metrics.Latency[endpoint] = histogram
+	if speakerId == "" {
+		// in discovery, before the device ID is known
+		return
+	}
+
+	var apiError *ApiError
+	switch {
+	case err == nil:
+		metrics.LastSeen[speakerId] = now
+	case errors.As(err, &apiError):
+		// the speaker answered, it just didn't like the request
+		metrics.LastSeen[speakerId] = now
+		metrics.Errors[ErrorKey{speakerId, apiError.Code}]++
+	default:
+		metrics.Failures[speakerId]++
+	}
+}
+
+func seen(speakerId string) {
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	metrics.LastSeen[speakerId] = time.Now()
+}
+
+func countDiscovery(result string) {
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	metrics.Discovery[result]++
+}
@@ -0,0 +1,276 @@
+package musiccast
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Scene is the state of several speakers which ApplyScene restores
+type Scene struct {
+	Speakers []SpeakerState `json:"speakers"`
+}
+
+// SpeakerState is what a Scene restores on a speaker. Standby speakers only have Power.
+type SpeakerState struct {
+	ID string `json:"id"`
+	// Name finds the speaker if the ID is unknown and helps when editing the config by hand
+	Name  string `json:"name"`
+	Power Power  `json:"power"`
+	// Input is empty for link clients, they play the input of their server
+	Input string `json:"input,omitempty"`
+	// Preset is the netusb preset to recall instead of just switching the input, 0 for none
+	Preset int   `json:"preset,omitempty"`
+	Volume *int  `json:"volume,omitempty"`
+	Mute   *bool `json:"mute,omitempty"`
+	// LinkServer is the ID of the speaker this one plays along with, empty if it's no link client
+	LinkServer string `json:"link_server,omitempty"`
+}
+
+// SpeakerErrors are the errors of an operation on several speakers by speaker name
+type SpeakerErrors map[string]error
+
+func (e SpeakerErrors) add(name string, err error) {
+	e[name] = errors.Join(e[name], err)
+}
+
+func (e SpeakerErrors) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	messages := make([]string, 0, len(names))
+	for _, name := range names {
+		messages = append(messages, name+": "+strings.ReplaceAll(e[name].Error(), "\n", ", "))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// orNil keeps callers from returning a typed nil
+func (e SpeakerErrors) orNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// CaptureScene reads the state of the speakers. If some speakers fail, the scene has what could be
+// read and the error is SpeakerErrors.
+func CaptureScene(speakers []*Speaker) (Scene, error) {
+	errs := SpeakerErrors{}
+	byAddress := make(map[string]*Speaker)
+	for _, spkr := range speakers {
+		if address, err := ipAddress(spkr); err == nil {
+			byAddress[address] = spkr
+		}
+	}
+
+	states := make([]SpeakerState, 0, len(speakers))
+	servers := make(map[string]string)
+	for _, spkr := range speakers {
+		state := SpeakerState{ID: spkr.ID, Name: spkr.FriendlyName, Power: spkr.Power}
+		if spkr.Power != On {
+			states = append(states, state)
+			continue
+		}
+		state.Input = spkr.Input
+		if spkr.Volume != nil {
+			volume := int(*spkr.Volume)
+			state.Volume = &volume
+		}
+		state.Mute = spkr.Mute
+		if spkr.IsNetusbInput(spkr.Input) {
+			presets, err := GetPresetInfo(spkr)
+			if err != nil {
+				errs.add(spkr.FriendlyName, fmt.Errorf("get presets: %w", err))
+			} else {
+				state.Preset = CurrentPreset(spkr, presets.PresetInfo)
+			}
+		}
+		dist, err := GetDistributionInfo(spkr)
+		if err != nil {
+			errs.add(spkr.FriendlyName, fmt.Errorf("get link group: %w", err))
+		} else if dist.Role == RoleServer {
+			for _, client := range dist.ClientList {
+				if clientSpeaker, ok := byAddress[client.IpAddress]; ok {
+					servers[clientSpeaker.ID] = spkr.ID
+				}
+			}
+		}
+		states = append(states, state)
+	}
+
+	for i, state := range states {
+		if server, ok := servers[state.ID]; ok && state.Power == On {
+			states[i].LinkServer = server
+			states[i].Input = ""
+			states[i].Preset = 0
+		}
+	}
+	return Scene{Speakers: states}, errs.orNil()
+}
+
+// VolumeLimiter caps the volume for the speaker, like the volume limits of the config file
+type VolumeLimiter func(speaker *Speaker, volume int) int
+
+// ApplyScene restores the scene on the speakers in dependency order: power on, dissolve link groups
+// which differ from the scene, select inputs, link, set volumes, standby. A speaker whose step fails
+// is skipped in the following steps, the error is SpeakerErrors. The limit caps the scene's volumes,
+// nil sets them as they are.
+func ApplyScene(scene Scene, speakers []*Speaker, limit VolumeLimiter) error {
+	errs := SpeakerErrors{}
+	type target struct {
+		state   SpeakerState
+		speaker *Speaker
+		role    Role
+	}
+	targets := make([]*target, 0, len(scene.Speakers))
+	byId := make(map[string]*target)
+	for _, state := range scene.Speakers {
+		spkr := findSpeaker(speakers, state)
+		if spkr == nil {
+			errs.add(state.Name, errors.New("speaker not found"))
+			continue
+		}
+		t := &target{state: state, speaker: spkr, role: RoleNone}
+		targets = append(targets, t)
+		byId[state.ID] = t
+	}
+	ok := func(t *target) bool {
+		return errs[t.state.Name] == nil
+	}
+	step := func(t *target, what string, err error) {
+		if err != nil {
+			errs.add(t.state.Name, fmt.Errorf("%s: %w", what, err))
+		}
+	}
+
+	for _, t := range targets {
+		if t.state.Power == On && t.speaker.Power != On {
+			step(t, "power on", SetPower(t.speaker, On))
+		}
+	}
+
+	// the groups the scene wants, by server
+	groups := make(map[*target][]*target)
+	for _, t := range targets {
+		if t.state.LinkServer == "" {
+			continue
+		}
+		server, found := byId[t.state.LinkServer]
+		if !found || server.state.Power != On || server.state.LinkServer != "" {
+			step(t, "link", fmt.Errorf("server %s is not powered on in the scene", t.state.LinkServer))
+			continue
+		}
+		groups[server] = append(groups[server], t)
+	}
+
+	// dissolve all groups of the scene's speakers unless they are exactly what the scene wants
+	kept := make(map[*target]bool)
+	for _, t := range targets {
+		dist, err := GetDistributionInfo(t.speaker)
+		if err != nil {
+			step(t, "get link group", err)
+			continue
+		}
+		t.role = dist.Role
+		clients := make([]*Speaker, 0, len(groups[t]))
+		for _, client := range groups[t] {
+			clients = append(clients, client.speaker)
+		}
+		if dist.Role == RoleServer && sameClients(dist.ClientList, clients) {
+			kept[t] = true
+			for _, client := range groups[t] {
+				kept[client] = true
+			}
+		}
+	}
+	for _, t := range targets {
+		if ok(t) && !kept[t] && t.role != RoleNone {
+			step(t, "unlink", Unlink(t.speaker, t.role))
+		}
+	}
+
+	for _, t := range targets {
+		if !ok(t) || t.state.Power != On || t.state.LinkServer != "" {
+			continue
+		}
+		if t.state.Preset > 0 {
+			step(t, "recall preset", RecallPreset(t.speaker, t.state.Preset))
+		} else if t.state.Input != "" && t.state.Input != t.speaker.Input {
+			step(t, "set input", SetInput(t.speaker, t.state.Input))
+		}
+	}
+
+	for _, server := range targets {
+		if len(groups[server]) == 0 || kept[server] || !ok(server) {
+			continue
+		}
+		linked := make([]*Speaker, 0, len(groups[server]))
+		for _, client := range groups[server] {
+			if ok(client) {
+				linked = append(linked, client.speaker)
+			}
+		}
+		if len(linked) > 0 {
+			step(server, "link", Link(server.speaker, linked))
+		}
+	}
+
+	for _, t := range targets {
+		if !ok(t) || t.state.Power != On {
+			continue
+		}
+		if t.state.Volume != nil {
+			volume := *t.state.Volume
+			if limit != nil {
+				volume = limit(t.speaker, volume)
+			}
+			step(t, "set volume", SetVolumeTo(t.speaker, volume))
+		}
+		if t.state.Mute != nil {
+			step(t, "set mute", SetMute(t.speaker, *t.state.Mute))
+		}
+	}
+
+	for _, t := range targets {
+		if ok(t) && t.state.Power == Standby && t.speaker.Power != Standby {
+			step(t, "standby", SetPower(t.speaker, Standby))
+		}
+	}
+	return errs.orNil()
+}
+
+// findSpeaker looks the speaker up by ID and falls back to the name
+func findSpeaker(speakers []*Speaker, state SpeakerState) *Speaker {
+	for _, spkr := range speakers {
+		if spkr.ID == state.ID {
+			return spkr
+		}
+	}
+	for _, spkr := range speakers {
+		if state.Name != "" && strings.EqualFold(spkr.FriendlyName, state.Name) {
+			return spkr
+		}
+	}
+	return nil
+}
+
+// sameClients checks if the server's current clients are the wanted speakers
+func sameClients(current []DistributionClient, wanted []*Speaker) bool {
+	if len(current) == 0 || len(current) != len(wanted) {
+		return false
+	}
+	addresses := make(map[string]bool)
+	for _, client := range current {
+		addresses[client.IpAddress] = true
+	}
+	for _, spkr := range wanted {
+		if address, err := ipAddress(spkr); err != nil || !addresses[address] {
+			return false
+		}
+	}
+	return true
+}
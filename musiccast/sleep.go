@@ -0,0 +1,117 @@
+package musiccast
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SleepSteps are the sleep timer values in minutes the devices accept
+var SleepSteps = []int{0, 30, 60, 90, 120}
+
+// NextSleep cycles through the SleepSteps, starting over after the largest one
+func NextSleep(minutes int) int {
+	for _, step := range SleepSteps {
+		if step > minutes {
+			return step
+		}
+	}
+	return 0
+}
+
+func SetSleep(speaker *Speaker, minutes int) error {
+	valid := false
+	for _, step := range SleepSteps {
+		valid = valid || step == minutes
+	}
+	if !valid {
+		return fmt.Errorf("invalid sleep value %d, allowed are %v", minutes, SleepSteps)
+	}
+	return callApi(speaker, fmt.Sprintf("%s/setSleep?sleep=%d", mainZone, minutes), &ApiResponse{})
+}
+
+// the device only reports the configured value, so the countdown starts when ymc notices it
+func sleepEnd(minutes int) time.Time {
+	if minutes <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(minutes) * time.Minute)
+}
+
+// SleepTimer is a client-side sleep timer for durations the device timer does not support
+type SleepTimer struct {
+	SpeakerId string
+	End       time.Time
+	Fade      time.Duration
+	cancel    chan struct{}
+}
+
+func (t *SleepTimer) Remaining() time.Duration {
+	return time.Until(t.End)
+}
+
+var sleepTimers = make(map[string]*SleepTimer)
+var sleepTimersLock sync.Mutex
+
+// StartSleepTimer puts the speaker to standby after the duration and replaces any running timer.
+// With fade > 0 the volume goes down to 0 during the last part of the duration and is restored after standby,
+// changing the volume during the fade keeps the speaker playing.
+func StartSleepTimer(speaker *Speaker, duration time.Duration, fade time.Duration) *SleepTimer {
+	CancelSleepTimer(speaker.ID)
+	if fade > duration {
+		fade = duration
+	}
+	timer := &SleepTimer{speaker.ID, time.Now().Add(duration), fade, make(chan struct{})}
+
+	sleepTimersLock.Lock()
+	sleepTimers[speaker.ID] = timer
+	sleepTimersLock.Unlock()
+
+	// the caller keeps updating its speaker, the timer works on a copy of the state it was started with
+	started := *speaker
+	speaker = &started
+	go func() {
+		defer func() {
+			sleepTimersLock.Lock()
+			if sleepTimers[speaker.ID] == timer {
+				delete(sleepTimers, speaker.ID)
+			}
+			sleepTimersLock.Unlock()
+		}()
+
+		select {
+		case <-time.After(duration - fade):
+		case <-timer.cancel:
+			return
+		}
+
+		log.Infof("Sleep timer for %s expired", speaker.FriendlyName)
+		var err error
+		if fade > 0 {
+			err = standbyFaded(speaker, fade, FadeLinear, timer.cancel)
+		} else {
+			err = SetPower(speaker, Standby)
+		}
+		if err != nil && !errors.Is(err, ErrFadeCancelled) {
+			log.Warn("Sleep timer failed to power off:", speaker.FriendlyName, err)
+		}
+	}()
+	return timer
+}
+
+// ActiveSleepTimer returns the running client-side timer for the speaker or nil
+func ActiveSleepTimer(speakerId string) *SleepTimer {
+	sleepTimersLock.Lock()
+	defer sleepTimersLock.Unlock()
+	return sleepTimers[speakerId]
+}
+
+func CancelSleepTimer(speakerId string) {
+	sleepTimersLock.Lock()
+	defer sleepTimersLock.Unlock()
+	if timer, ok := sleepTimers[speakerId]; ok {
+		close(timer.cancel)
+		delete(sleepTimers, speakerId)
+	}
+}
@@ -0,0 +1,114 @@
+package musiccast
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SpeakersSnapshot is what Snapshot saved for Restore
+type SpeakersSnapshot struct {
+	Scene Scene
+	// Playback of the speakers which were on the CD or a netusb input, by speaker ID
+	Playback map[string]PlaybackPosition
+
+	speakers []*Speaker
+}
+
+// PlaybackPosition is where a speaker was in its track
+type PlaybackPosition struct {
+	Input    string
+	Playback Playback
+	// PlayTime is the position in seconds, only restored if Seekable
+	PlayTime int
+	// Seekable is true for netusb tracks with a known total time, not for radio streams
+	Seekable bool
+	// CdTrack is the CD track number, CD tracks restart from their beginning
+	CdTrack int
+}
+
+// Snapshot saves the state of the speakers before they are taken over, like for an announcement.
+// Unlike scenes it includes the playback position. If some speakers fail, the snapshot has what
+// could be read and the error is SpeakerErrors.
+func Snapshot(speakers []*Speaker) (*SpeakersSnapshot, error) {
+	scene, err := CaptureScene(speakers)
+	errs := SpeakerErrors{}
+	errors.As(err, &errs)
+	snapshot := &SpeakersSnapshot{Scene: scene, Playback: make(map[string]PlaybackPosition), speakers: speakers}
+
+	for _, spkr := range speakers {
+		if spkr.Power != On {
+			continue
+		}
+		switch {
+		case spkr.Input == CdInput:
+			info, err := GetCdPlayInfo(spkr)
+			if err != nil {
+				errs.add(spkr.FriendlyName, fmt.Errorf("get CD play info: %w", err))
+				continue
+			}
+			snapshot.Playback[spkr.ID] = PlaybackPosition{Input: CdInput, Playback: info.Playback, PlayTime: info.PlayTime, CdTrack: info.TrackNumber}
+		case spkr.IsNetusbInput(spkr.Input):
+			info, err := GetPlayInfo(spkr)
+			if err != nil {
+				errs.add(spkr.FriendlyName, fmt.Errorf("get play info: %w", err))
+				continue
+			}
+			snapshot.Playback[spkr.ID] = PlaybackPosition{Input: info.Input, Playback: info.Playback, PlayTime: info.PlayTime, Seekable: info.TotalTime > 0}
+		}
+	}
+
+	// recalling a preset starts playing it, only do that if it played before
+	for i, state := range snapshot.Scene.Speakers {
+		if snapshot.Playback[state.ID].Playback != Play {
+			snapshot.Scene.Speakers[i].Preset = 0
+		}
+	}
+	return snapshot, errs.orNil()
+}
+
+// Restore puts the speakers back into the state of the snapshot and resumes what they played, the
+// limit caps the volumes like in ApplyScene. Errors are SpeakerErrors.
+func Restore(snapshot *SpeakersSnapshot, limit VolumeLimiter) error {
+	// the scene compares with the current state, which isn't the state of the snapshot anymore
+	current := make([]*Speaker, 0, len(snapshot.speakers))
+	for _, spkr := range snapshot.speakers {
+		refreshed := *spkr
+		if err := updateStatus(&refreshed, 0); err != nil {
+			log.Warn("Failed to refresh status before restore:", spkr.FriendlyName, err)
+			current = append(current, spkr)
+			continue
+		}
+		current = append(current, &refreshed)
+	}
+
+	err := ApplyScene(snapshot.Scene, current, limit)
+	errs := SpeakerErrors{}
+	errors.As(err, &errs)
+	for _, state := range snapshot.Scene.Speakers {
+		position, ok := snapshot.Playback[state.ID]
+		spkr := findSpeaker(current, state)
+		if !ok || spkr == nil || errs[state.Name] != nil || position.Playback != Play || state.Preset > 0 {
+			continue
+		}
+		if err := resume(spkr, position); err != nil {
+			errs.add(state.Name, fmt.Errorf("resume playback: %w", err))
+		}
+	}
+	return errs.orNil()
+}
+
+func resume(speaker *Speaker, position PlaybackPosition) error {
+	if position.Input == CdInput {
+		if position.CdTrack > 0 {
+			return SelectCdTrack(speaker, position.CdTrack)
+		}
+		return SetCdPlayback(speaker, Play)
+	}
+	if err := SetNetusbPlayback(speaker, Play); err != nil {
+		return err
+	}
+	if position.Seekable && position.PlayTime > 0 {
+		return SetPlayPosition(speaker, position.PlayTime)
+	}
+	return nil
+}
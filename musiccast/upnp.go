@@ -0,0 +1,318 @@
+package musiccast
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	ssdp2 "github.com/atamanroman/ymc/internal/ssdp"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The speakers are DLNA renderers too, which play any URL they get with AVTransport and have their
+// own volume with RenderingControl.
+const (
+	AVTransport       = "AVTransport"
+	RenderingControl  = "RenderingControl"
+	ConnectionManager = "ConnectionManager"
+)
+
+// UpnpService is a UPnP service of the speaker's DLNA renderer
+type UpnpService struct {
+	// Type is the full type like urn:schemas-upnp-org:service:AVTransport:1
+	Type       string
+	ControlUrl string
+	// ScpdUrl is the service description, see GetUpnpActions
+	ScpdUrl string
+}
+
+// upnpServices picks the renderer services from the device description
+func upnpServices(renderer *ssdp2.MediaRenderer) map[string]UpnpService {
+	services := make(map[string]UpnpService)
+	for _, name := range []string{AVTransport, RenderingControl, ConnectionManager} {
+		if service, ok := renderer.Service("urn:schemas-upnp-org:service:" + name + ":"); ok {
+			services[name] = UpnpService{Type: service.ServiceType, ControlUrl: service.ControlUrl, ScpdUrl: service.ScpdUrl}
+		}
+	}
+	return services
+}
+
+// SupportsUpnp checks if the speaker's renderer has the service like AVTransport
+func (o Speaker) SupportsUpnp(service string) bool {
+	_, ok := o.UpnpServices[service]
+	return ok
+}
+
+// GetUpnpActions reads the names of the actions of the service from its description
+func GetUpnpActions(speaker *Speaker, service string) ([]string, error) {
+	upnpService, ok := speaker.UpnpServices[service]
+	if !ok {
+		return nil, fmt.Errorf("%s has no %s: %w", speaker.FriendlyName, service, ErrNotSupported)
+	}
+	description, err := ssdp2.GetServiceDescription(ssdp2.UpnpService{ServiceType: upnpService.Type, ScpdUrl: upnpService.ScpdUrl})
+	if err != nil {
+		return nil, err
+	}
+	return description.Actions(), nil
+}
+
+type TransportState string
+
+const (
+	TransportStopped       TransportState = "STOPPED"
+	TransportPlaying       TransportState = "PLAYING"
+	TransportPaused        TransportState = "PAUSED_PLAYBACK"
+	TransportTransitioning TransportState = "TRANSITIONING"
+	TransportNoMedia       TransportState = "NO_MEDIA_PRESENT"
+)
+
+// UpnpError is a SOAP fault of a UPnP action
+type UpnpError struct {
+	Action      string
+	Code        int
+	Description string
+}
+
+func (e *UpnpError) Error() string {
+	return fmt.Sprintf("UPnP %s failed with %d (%s)", e.Action, e.Code, e.Description)
+}
+
+type TransportInfo struct {
+	CurrentTransportState  TransportState
+	CurrentTransportStatus string
+	CurrentSpeed           string
+}
+
+// PositionInfo is the current track of the renderer, times are H:MM:SS, see ParseUpnpDuration
+type PositionInfo struct {
+	Track         int
+	TrackDuration string
+	TrackMetaData string
+	TrackURI      string
+	RelTime       string
+	AbsTime       string
+}
+
+// Position is RelTime as duration, 0 if unknown
+func (o PositionInfo) Position() time.Duration {
+	return ParseUpnpDuration(o.RelTime)
+}
+
+// Duration is TrackDuration as duration, 0 if unknown like for streams
+func (o PositionInfo) Duration() time.Duration {
+	return ParseUpnpDuration(o.TrackDuration)
+}
+
+// SetAVTransportURI tells the speaker what to play, metadata is DIDL-Lite or empty
+func SetAVTransportURI(speaker *Speaker, uri string, metadata string) error {
+	return avTransport(speaker, "SetAVTransportURI", nil,
+		"InstanceID", "0", "CurrentURI", uri, "CurrentURIMetaData", metadata)
+}
+
+func AVTransportPlay(speaker *Speaker) error {
+	return avTransport(speaker, "Play", nil, "InstanceID", "0", "Speed", "1")
+}
+
+func AVTransportStop(speaker *Speaker) error {
+	return avTransport(speaker, "Stop", nil, "InstanceID", "0")
+}
+
+func AVTransportPause(speaker *Speaker) error {
+	return avTransport(speaker, "Pause", nil, "InstanceID", "0")
+}
+
+// Seek jumps to the position in the current track
+func Seek(speaker *Speaker, position time.Duration) error {
+	return avTransport(speaker, "Seek", nil, "InstanceID", "0", "Unit", "REL_TIME", "Target", FormatUpnpDuration(position))
+}
+
+func GetPositionInfo(speaker *Speaker) (*PositionInfo, error) {
+	info := PositionInfo{}
+	err := avTransport(speaker, "GetPositionInfo", &info, "InstanceID", "0")
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func GetTransportInfo(speaker *Speaker) (*TransportInfo, error) {
+	info := TransportInfo{}
+	err := avTransport(speaker, "GetTransportInfo", &info, "InstanceID", "0")
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// PlayUrl plays the URL on the speaker's DLNA renderer, which switches the speaker to the server input
+func PlayUrl(speaker *Speaker, uri string, metadata string) error {
+	if err := SetAVTransportURI(speaker, uri, metadata); err != nil {
+		return err
+	}
+	return AVTransportPlay(speaker)
+}
+
+// GetUpnpVolume is the renderer's volume of the master channel from 0 to 100
+func GetUpnpVolume(speaker *Speaker) (int, error) {
+	result := struct{ CurrentVolume int }{}
+	err := renderingControl(speaker, "GetVolume", &result, "InstanceID", "0", "Channel", "Master")
+	return result.CurrentVolume, err
+}
+
+func SetUpnpVolume(speaker *Speaker, volume int) error {
+	return renderingControl(speaker, "SetVolume", nil, "InstanceID", "0", "Channel", "Master", "DesiredVolume", strconv.Itoa(volume))
+}
+
+func GetUpnpMute(speaker *Speaker) (bool, error) {
+	result := struct{ CurrentMute string }{}
+	err := renderingControl(speaker, "GetMute", &result, "InstanceID", "0", "Channel", "Master")
+	return result.CurrentMute == "1" || result.CurrentMute == "true", err
+}
+
+func SetUpnpMute(speaker *Speaker, mute bool) error {
+	desired := "0"
+	if mute {
+		desired = "1"
+	}
+	return renderingControl(speaker, "SetMute", nil, "InstanceID", "0", "Channel", "Master", "DesiredMute", desired)
+}
+
+// ParseUpnpDuration parses H:MM:SS with optional fractions, 0 for NOT_IMPLEMENTED and other invalid values
+func ParseUpnpDuration(text string) time.Duration {
+	parts := strings.Split(text, ":")
+	if len(parts) != 3 {
+		return 0
+	}
+	hours, errHours := strconv.Atoi(parts[0])
+	minutes, errMinutes := strconv.Atoi(parts[1])
+	seconds, errSeconds := strconv.ParseFloat(parts[2], 64)
+	if errHours != nil || errMinutes != nil || errSeconds != nil {
+		return 0
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds*float64(time.Second))
+}
+
+// FormatUpnpDuration formats H:MM:SS
+func FormatUpnpDuration(duration time.Duration) string {
+	seconds := int(duration.Round(time.Second).Seconds())
+	return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// DidlItem is the metadata of an audio item, empty fields are left out
+type DidlItem struct {
+	Title  string
+	Artist string
+	Album  string
+	// MimeType may be empty if it's unknown
+	MimeType string
+}
+
+// DidlLite describes a single audio item, some renderers refuse URLs without metadata
+func DidlLite(uri string, item DidlItem) string {
+	mimeType := item.MimeType
+	if mimeType == "" {
+		mimeType = "*"
+	}
+	didl := strings.Builder{}
+	didl.WriteString(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">` +
+		`<item id="0" parentID="-1" restricted="1">` +
+		`<dc:title>` + escapeXml(item.Title) + `</dc:title>`)
+	if item.Artist != "" {
+		didl.WriteString(`<dc:creator>` + escapeXml(item.Artist) + `</dc:creator><upnp:artist>` + escapeXml(item.Artist) + `</upnp:artist>`)
+	}
+	if item.Album != "" {
+		didl.WriteString(`<upnp:album>` + escapeXml(item.Album) + `</upnp:album>`)
+	}
+	didl.WriteString(`<upnp:class>object.item.audioItem.musicTrack</upnp:class>` +
+		`<res protocolInfo="http-get:*:` + escapeXml(mimeType) + `:*">` + escapeXml(uri) + `</res>` +
+		`</item></DIDL-Lite>`)
+	return didl.String()
+}
+
+func avTransport(speaker *Speaker, action string, result any, args ...string) error {
+	return upnpCall(speaker, AVTransport, action, result, args...)
+}
+
+func renderingControl(speaker *Speaker, action string, result any, args ...string) error {
+	return upnpCall(speaker, RenderingControl, action, result, args...)
+}
+
+func upnpCall(speaker *Speaker, service string, action string, result any, args ...string) error {
+	upnpService, ok := speaker.UpnpServices[service]
+	if !ok {
+		return fmt.Errorf("%s has no %s: %w", speaker.FriendlyName, service, ErrNotSupported)
+	}
+	return soapCall(upnpService.ControlUrl, upnpService.Type, action, result, args...)
+}
+
+// soapCall invokes the UPnP action with the arguments as name value pairs, in the order the service
+// expects them, and decodes the response arguments into result
+func soapCall(controlUrl string, serviceType string, action string, result any, args ...string) error {
+	body := strings.Builder{}
+	body.WriteString(`<?xml version="1.0" encoding="utf-8"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:` + action + ` xmlns:u="` + serviceType + `">`)
+	for i := 0; i+1 < len(args); i += 2 {
+		body.WriteString("<" + args[i] + ">" + escapeXml(args[i+1]) + "</" + args[i] + ">")
+	}
+	body.WriteString(`</u:` + action + `></s:Body></s:Envelope>`)
+
+	request, err := http.NewRequest(http.MethodPost, controlUrl, strings.NewReader(body.String()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	request.Header.Set("SOAPAction", `"`+serviceType+"#"+action+`"`)
+	resp, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	all, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	envelope := soapEnvelope{}
+	if err = xml.Unmarshal(all, &envelope); err != nil {
+		return fmt.Errorf("UPnP %s: invalid response with status %d: %w", action, resp.StatusCode, err)
+	}
+	if envelope.Body.Fault != nil {
+		fault := envelope.Body.Fault.Detail.UpnpError
+		return &UpnpError{action, fault.ErrorCode, fault.ErrorDescription}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("UPnP %s failed with status %d", action, resp.StatusCode)
+	}
+	if result != nil {
+		// the arguments are the children of the response element
+		return xml.Unmarshal(append(append([]byte("<response>"), envelope.Body.Response.Inner...), "</response>"...), result)
+	}
+	return nil
+}
+
+type soapEnvelope struct {
+	Body struct {
+		Fault *struct {
+			Detail struct {
+				UpnpError struct {
+					ErrorCode        int    `xml:"errorCode"`
+					ErrorDescription string `xml:"errorDescription"`
+				} `xml:"UPnPError"`
+			} `xml:"detail"`
+		} `xml:"Fault"`
+		// the action's response element, whatever its name
+		Response struct {
+			Inner []byte `xml:",innerxml"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+func escapeXml(text string) string {
+	escaped := bytes.Buffer{}
+	_ = xml.EscapeText(&escaped, []byte(text))
+	return escaped.String()
+}
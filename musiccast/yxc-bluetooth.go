@@ -0,0 +1,175 @@
+package musiccast
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	BluetoothStandby   SystemFunction = "bluetooth_standby"
+	BluetoothTxSetting SystemFunction = "bluetooth_tx_setting"
+)
+
+// how often and how long to poll the device list while the speaker searches for Bluetooth devices
+const bluetoothSearchInterval = 2 * time.Second
+const bluetoothSearchTimeout = 30 * time.Second
+
+type BluetoothDevice struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// BluetoothInfo is the state of Bluetooth standby and the transmitter which sends audio to headphones or speakers
+type BluetoothInfo struct {
+	BluetoothStandby   bool `json:"bluetooth_standby"`
+	BluetoothTxSetting bool `json:"bluetooth_tx_setting"`
+	// the device the transmitter is paired with
+	BluetoothDevice struct {
+		Connected bool `json:"connected"`
+		BluetoothDevice
+	} `json:"bluetooth_device"`
+}
+
+func (o BluetoothInfo) String() string {
+	return jsonStringer(o)
+}
+
+type GetBluetoothInfoResponse struct {
+	ApiResponse
+	BluetoothInfo
+}
+
+func (r GetBluetoothInfoResponse) ErrorCode() int {
+	return r.ResponseCode
+}
+
+// BluetoothDeviceList are the devices the transmitter found, Updating is true while the search runs
+type BluetoothDeviceList struct {
+	Updating   bool              `json:"updating"`
+	DeviceList []BluetoothDevice `json:"device_list"`
+}
+
+type GetBluetoothDeviceListResponse struct {
+	ApiResponse
+	BluetoothDeviceList
+}
+
+func (r GetBluetoothDeviceListResponse) ErrorCode() int {
+	return r.ResponseCode
+}
+
+// SupportsBluetooth checks if the speaker has Bluetooth standby or a transmitter; false if the features are unknown
+func (o Speaker) SupportsBluetooth() bool {
+	return o.SupportsSystemFunc(BluetoothStandby) || o.SupportsSystemFunc(BluetoothTxSetting)
+}
+
+func GetBluetoothInfo(speaker *Speaker) (*GetBluetoothInfoResponse, error) {
+	target := GetBluetoothInfoResponse{}
+	err := callApi(speaker, "system/getBluetoothInfo", &target)
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// fetch the Bluetooth state if the speaker supports it
+func updateBluetoothInfo(speaker *Speaker) error {
+	if !speaker.SupportsBluetooth() {
+		return nil
+	}
+	info, err := GetBluetoothInfo(speaker)
+	if err != nil {
+		return err
+	}
+	speaker.Bluetooth = &info.BluetoothInfo
+	return nil
+}
+
+// SetBluetoothStandby lets Bluetooth devices turn the speaker on
+func SetBluetoothStandby(speaker *Speaker, enable bool) error {
+	if err := requireSystemFunc(speaker, BluetoothStandby); err != nil {
+		return err
+	}
+	return callApi(speaker, "system/setBluetoothStandby?enable="+strconv.FormatBool(enable), &ApiResponse{})
+}
+
+// SetBluetoothTxSetting switches the transmitter on or off
+func SetBluetoothTxSetting(speaker *Speaker, enable bool) error {
+	if err := requireSystemFunc(speaker, BluetoothTxSetting); err != nil {
+		return err
+	}
+	return callApi(speaker, "system/setBluetoothTxSetting?enable="+strconv.FormatBool(enable), &ApiResponse{})
+}
+
+func GetBluetoothDeviceList(speaker *Speaker) (*GetBluetoothDeviceListResponse, error) {
+	target := GetBluetoothDeviceListResponse{}
+	err := callApi(speaker, "system/getBluetoothDeviceList", &target)
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// UpdateBluetoothDeviceList starts a search for Bluetooth devices, see SearchBluetoothDevices
+func UpdateBluetoothDeviceList(speaker *Speaker) error {
+	if err := requireSystemFunc(speaker, BluetoothTxSetting); err != nil {
+		return err
+	}
+	return callApi(speaker, "system/updateBluetoothDeviceList", &ApiResponse{})
+}
+
+func ConnectBluetoothDevice(speaker *Speaker, address string) error {
+	if address == "" {
+		return fmt.Errorf("bluetooth device address must not be empty")
+	}
+	if err := requireSystemFunc(speaker, BluetoothTxSetting); err != nil {
+		return err
+	}
+	return callApi(speaker, "system/connectBluetoothDevice?address="+url.QueryEscape(address), &ApiResponse{})
+}
+
+func DisconnectBluetoothDevice(speaker *Speaker) error {
+	if err := requireSystemFunc(speaker, BluetoothTxSetting); err != nil {
+		return err
+	}
+	return callApi(speaker, "system/disconnectBluetoothDevice", &ApiResponse{})
+}
+
+// SearchBluetoothDevices starts a search and publishes the device list until the speaker is done
+func SearchBluetoothDevices(speaker *Speaker) error {
+	err := UpdateBluetoothDeviceList(speaker)
+	if err != nil {
+		return err
+	}
+	publishBluetoothDevices(speaker.ID, BluetoothDeviceList{Updating: true})
+
+	target := Speaker{ID: speaker.ID, BaseUrl: speaker.BaseUrl, FriendlyName: speaker.FriendlyName}
+	go func() {
+		deadline := time.Now().Add(bluetoothSearchTimeout)
+		for {
+			time.Sleep(bluetoothSearchInterval)
+			list, err := GetBluetoothDeviceList(&target)
+			if err != nil {
+				log.Warn("Failed to get Bluetooth devices for device:", target.FriendlyName, err)
+				publishBluetoothDevices(target.ID, BluetoothDeviceList{})
+				return
+			}
+			if !list.Updating || time.Now().After(deadline) {
+				list.Updating = false
+				publishBluetoothDevices(target.ID, list.BluetoothDeviceList)
+				return
+			}
+			publishBluetoothDevices(target.ID, list.BluetoothDeviceList)
+		}
+	}()
+	return nil
+}
+
+func publishBluetoothDevices(id string, list BluetoothDeviceList) {
+	update := Speaker{ID: id, BluetoothDevices: &list, PartialUpdate: true}
+	go func() {
+		speakerChan <- &update
+	}()
+}
@@ -0,0 +1,117 @@
+package musiccast
+
+import (
+	"strconv"
+)
+
+const CdInput = "cd"
+
+type Playback string
+
+const (
+	Play     Playback = "play"
+	Stop     Playback = "stop"
+	Pause    Playback = "pause"
+	Previous Playback = "previous"
+	Next     Playback = "next"
+)
+
+type Repeat string
+
+const (
+	RepeatOff Repeat = "off"
+	RepeatOne Repeat = "one"
+	RepeatAll Repeat = "all"
+)
+
+type Shuffle string
+
+const (
+	ShuffleOff Shuffle = "off"
+	ShuffleOn  Shuffle = "on"
+)
+
+// Next cycles through off -> one -> all -> off
+func (r Repeat) Next() Repeat {
+	switch r {
+	case RepeatOff:
+		return RepeatOne
+	case RepeatOne:
+		return RepeatAll
+	default:
+		return RepeatOff
+	}
+}
+
+type CdPlayInfo struct {
+	// open, close, ready or not_ready
+	DeviceStatus string   `json:"device_status"`
+	Playback     Playback `json:"playback"`
+	Repeat       Repeat   `json:"repeat"`
+	Shuffle      Shuffle  `json:"shuffle"`
+	PlayTime     int      `json:"play_time"`
+	TotalTime    int      `json:"total_time"`
+	DiscTime     int      `json:"disc_time"`
+	TrackNumber  int      `json:"track_number"`
+	TotalTracks  int      `json:"total_tracks"`
+	Artist       string   `json:"artist"`
+	Album        string   `json:"album"`
+	Track        string   `json:"track"`
+}
+
+func (o CdPlayInfo) String() string {
+	return jsonStringer(o)
+}
+
+type GetCdPlayInfoResponse struct {
+	ApiResponse
+	CdPlayInfo
+}
+
+func (r GetCdPlayInfoResponse) ErrorCode() int {
+	return r.ResponseCode
+}
+
+func GetCdPlayInfo(speaker *Speaker) (*GetCdPlayInfoResponse, error) {
+	target := GetCdPlayInfoResponse{}
+	err := callApi(speaker, "cd/getPlayInfo", &target)
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// fetch the CD play info if the speaker is currently on the CD input
+func updateCdPlayInfo(speaker *Speaker) error {
+	if speaker.Input != CdInput {
+		return nil
+	}
+	info, err := GetCdPlayInfo(speaker)
+	if err != nil {
+		return err
+	}
+	speaker.Cd = &info.CdPlayInfo
+	speaker.PlayTime = &info.PlayTime
+	return nil
+}
+
+func SetCdPlayback(speaker *Speaker, playback Playback) error {
+	return callApi(speaker, "cd/setPlayback?playback="+string(playback), &ApiResponse{})
+}
+
+// SelectCdTrack jumps to the given track number (starting at 1)
+func SelectCdTrack(speaker *Speaker, track int) error {
+	return callApi(speaker, "cd/setPlayback?playback=track_select&num="+strconv.Itoa(track), &ApiResponse{})
+}
+
+func ToggleCdTray(speaker *Speaker) error {
+	return callApi(speaker, "cd/toggleTray", &ApiResponse{})
+}
+
+func SetCdRepeat(speaker *Speaker, repeat Repeat) error {
+	return callApi(speaker, "cd/setRepeat?mode="+string(repeat), &ApiResponse{})
+}
+
+func SetCdShuffle(speaker *Speaker, shuffle Shuffle) error {
+	return callApi(speaker, "cd/setShuffle?mode="+string(shuffle), &ApiResponse{})
+}
@@ -0,0 +1,226 @@
+package musiccast
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// AlarmDays are the keys for the alarm details: the one day alarm and the weekly ones
+var AlarmDays = []string{"oneday", "sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+const (
+	AlarmModeOneDay = "oneday"
+	AlarmModeWeekly = "weekly"
+
+	AlarmResume = "resume"
+	AlarmPreset = "preset"
+)
+
+type AlarmDay struct {
+	Enable bool `json:"enable"`
+	// hhmm
+	Time string `json:"time"`
+	Beep bool   `json:"beep"`
+	// resume or preset
+	PlaybackType string `json:"playback_type"`
+	Resume       struct {
+		Input string `json:"input"`
+	} `json:"resume"`
+	Preset struct {
+		Type string `json:"type"`
+		Num  int    `json:"num"`
+	} `json:"preset"`
+}
+
+// Source describes what the alarm plays
+func (o AlarmDay) Source() string {
+	if o.PlaybackType == AlarmPreset {
+		return fmt.Sprintf("%s preset %d", o.Preset.Type, o.Preset.Num)
+	}
+	if o.Resume.Input != "" {
+		return o.Resume.Input
+	}
+	return "beep"
+}
+
+// FormattedTime returns the alarm time as hh:mm
+func (o AlarmDay) FormattedTime() string {
+	if len(o.Time) != 4 {
+		return o.Time
+	}
+	return o.Time[:2] + ":" + o.Time[2:]
+}
+
+type ClockSettings struct {
+	AutoSync bool `json:"auto_sync"`
+	// 12h or 24h
+	Format       string `json:"format"`
+	AlarmOn      bool   `json:"alarm_on"`
+	Volume       int    `json:"volume"`
+	FadeInterval int    `json:"fade_interval"`
+	FadeType     int    `json:"fade_type"`
+	// oneday or weekly
+	Mode      string    `json:"mode"`
+	Repeat    bool      `json:"repeat"`
+	OneDay    *AlarmDay `json:"one_day"`
+	Sunday    *AlarmDay `json:"sunday"`
+	Monday    *AlarmDay `json:"monday"`
+	Tuesday   *AlarmDay `json:"tuesday"`
+	Wednesday *AlarmDay `json:"wednesday"`
+	Thursday  *AlarmDay `json:"thursday"`
+	Friday    *AlarmDay `json:"friday"`
+	Saturday  *AlarmDay `json:"saturday"`
+}
+
+func (o ClockSettings) String() string {
+	return jsonStringer(o)
+}
+
+// Day returns the alarm for one of the AlarmDays or nil if the device did not report it
+func (o ClockSettings) Day(day string) *AlarmDay {
+	switch day {
+	case "oneday":
+		return o.OneDay
+	case "sunday":
+		return o.Sunday
+	case "monday":
+		return o.Monday
+	case "tuesday":
+		return o.Tuesday
+	case "wednesday":
+		return o.Wednesday
+	case "thursday":
+		return o.Thursday
+	case "friday":
+		return o.Friday
+	case "saturday":
+		return o.Saturday
+	}
+	return nil
+}
+
+type GetClockSettingsResponse struct {
+	ApiResponse
+	ClockSettings
+}
+
+func (r GetClockSettingsResponse) ErrorCode() int {
+	return r.ResponseCode
+}
+
+// AlarmSettings is the setAlarmSettings payload, nil values are left unchanged
+type AlarmSettings struct {
+	AlarmOn      *bool        `json:"alarm_on,omitempty"`
+	Volume       *int         `json:"volume,omitempty"`
+	FadeInterval *int         `json:"fade_interval,omitempty"`
+	FadeType     *int         `json:"fade_type,omitempty"`
+	Mode         string       `json:"mode,omitempty"`
+	Repeat       *bool        `json:"repeat,omitempty"`
+	Detail       *AlarmDetail `json:"detail,omitempty"`
+}
+
+type AlarmDetail struct {
+	// one of the AlarmDays
+	Day string `json:"day"`
+	AlarmDay
+}
+
+// SupportsClock checks if the speaker has an alarm clock; false if the features are unknown
+func (o Speaker) SupportsClock() bool {
+	return o.Features != nil && o.Features.Clock.Supports("alarm")
+}
+
+func GetClockSettings(speaker *Speaker) (*GetClockSettingsResponse, error) {
+	target := GetClockSettingsResponse{}
+	err := callApi(speaker, "clock/getSettings", &target)
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// fetch the alarm settings if the speaker has a clock
+func updateClockSettings(speaker *Speaker) error {
+	if !speaker.SupportsClock() {
+		return nil
+	}
+	settings, err := GetClockSettings(speaker)
+	if err != nil {
+		return err
+	}
+	speaker.Clock = &settings.ClockSettings
+	return nil
+}
+
+var alarmTime = regexp.MustCompile(`^([01][0-9]|2[0-3])[0-5][0-9]$`)
+
+// ParseAlarmTime accepts hh:mm or hhmm and returns the hhmm format of the API
+func ParseAlarmTime(text string) (string, error) {
+	if len(text) == 5 && text[2] == ':' {
+		text = text[:2] + text[3:]
+	}
+	if len(text) == 3 {
+		text = "0" + text
+	}
+	if !alarmTime.MatchString(text) {
+		return "", fmt.Errorf("invalid alarm time %q, expected hh:mm", text)
+	}
+	return text, nil
+}
+
+// validateAlarm checks the settings against the clock features if they are known
+func validateAlarm(speaker *Speaker, settings AlarmSettings) error {
+	if speaker.Features == nil {
+		return nil
+	}
+	clock := speaker.Features.Clock
+	if !clock.Supports("alarm") {
+		return fmt.Errorf("alarm: %w", ErrNotSupported)
+	}
+	if settings.Mode != "" && len(clock.AlarmModeList) > 0 && !contains(clock.AlarmModeList, settings.Mode) {
+		return fmt.Errorf("alarm mode %q not in %v", settings.Mode, clock.AlarmModeList)
+	}
+	if settings.Volume != nil {
+		if r, ok := rangeById(clock.RangeStep, "alarm_volume"); ok && r.Clamp(*settings.Volume) != *settings.Volume {
+			return fmt.Errorf("alarm volume %d not in %d..%d", *settings.Volume, r.Min, r.Max)
+		}
+	}
+	if settings.FadeInterval != nil {
+		if r, ok := rangeById(clock.RangeStep, "alarm_fade"); ok && r.Clamp(*settings.FadeInterval) != *settings.FadeInterval {
+			return fmt.Errorf("alarm fade interval %d not in %d..%d", *settings.FadeInterval, r.Min, r.Max)
+		}
+	}
+	if settings.FadeType != nil && (*settings.FadeType < 1 || *settings.FadeType > clock.AlarmFadeTypeNum) {
+		return fmt.Errorf("alarm fade type %d not in 1..%d", *settings.FadeType, clock.AlarmFadeTypeNum)
+	}
+	if detail := settings.Detail; detail != nil {
+		if !contains(AlarmDays, detail.Day) {
+			return fmt.Errorf("invalid alarm day %q, expected one of %v", detail.Day, AlarmDays)
+		}
+		if detail.PlaybackType == AlarmResume && len(clock.AlarmInputList) > 0 && !contains(clock.AlarmInputList, detail.Resume.Input) {
+			return fmt.Errorf("alarm input %q not in %v", detail.Resume.Input, clock.AlarmInputList)
+		}
+		if detail.PlaybackType == AlarmPreset && len(clock.AlarmPresetList) > 0 && !contains(clock.AlarmPresetList, detail.Preset.Type) {
+			return fmt.Errorf("alarm preset type %q not in %v", detail.Preset.Type, clock.AlarmPresetList)
+		}
+	}
+	return nil
+}
+
+func SetAlarmSettings(speaker *Speaker, settings AlarmSettings) error {
+	if err := validateAlarm(speaker, settings); err != nil {
+		return err
+	}
+	return postApi(speaker, "clock/setAlarmSettings", settings, &ApiResponse{})
+}
+
+func SetAutoSync(speaker *Speaker, enable bool) error {
+	return callApi(speaker, "clock/setAutoSync?enable="+strconv.FormatBool(enable), &ApiResponse{})
+}
+
+// SetDateAndTime sets the device clock, only useful with auto sync disabled
+func SetDateAndTime(speaker *Speaker, dateTime time.Time) error {
+	return callApi(speaker, "clock/setDateAndTime?date_time="+dateTime.Format("060102150405"), &ApiResponse{})
+}
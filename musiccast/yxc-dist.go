@@ -0,0 +1,118 @@
+package musiccast
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+)
+
+// Role of a speaker in a link group, which plays the server's input on all speakers
+type Role string
+
+const (
+	RoleServer Role = "server"
+	RoleClient Role = "client"
+	RoleNone   Role = "none"
+)
+
+type DistributionClient struct {
+	IpAddress string `json:"ip_address"`
+	DataType  string `json:"data_type"`
+}
+
+type GetDistributionInfoResponse struct {
+	ApiResponse
+	GroupId    string               `json:"group_id"`
+	GroupName  string               `json:"group_name"`
+	Role       Role                 `json:"role"`
+	ServerZone string               `json:"server_zone"`
+	ClientList []DistributionClient `json:"client_list"`
+}
+
+func (r GetDistributionInfoResponse) ErrorCode() int {
+	return r.ResponseCode
+}
+
+func GetDistributionInfo(speaker *Speaker) (*GetDistributionInfoResponse, error) {
+	target := GetDistributionInfoResponse{}
+	err := callApi(speaker, "dist/getDistributionInfo", &target)
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// Link makes the server play its input on the clients as well
+func Link(server *Speaker, clients []*Speaker) error {
+	groupId, err := newGroupId()
+	if err != nil {
+		return err
+	}
+	addresses := make([]string, 0, len(clients))
+	for _, client := range clients {
+		address, err := ipAddress(client)
+		if err != nil {
+			return err
+		}
+		addresses = append(addresses, address)
+	}
+	serverAddress, err := ipAddress(server)
+	if err != nil {
+		return err
+	}
+
+	err = postApi(server, "dist/setServerInfo", map[string]any{
+		"group_id":    groupId,
+		"zone":        mainZone,
+		"type":        "add",
+		"client_list": addresses,
+	}, &ApiResponse{})
+	if err != nil {
+		return fmt.Errorf("set server info: %w", err)
+	}
+	for _, client := range clients {
+		err = postApi(client, "dist/setClientInfo", map[string]any{
+			"group_id":          groupId,
+			"zone":              []string{mainZone},
+			"server_ip_address": serverAddress,
+		}, &ApiResponse{})
+		if err != nil {
+			return fmt.Errorf("set client info of %s: %w", client.FriendlyName, err)
+		}
+	}
+	return callApi(server, "dist/startDistribution?num=0", &ApiResponse{})
+}
+
+// Unlink removes the speaker from its link group, servers dissolve their group
+func Unlink(speaker *Speaker, role Role) error {
+	switch role {
+	case RoleServer:
+		err := postApi(speaker, "dist/setServerInfo", map[string]any{"group_id": ""}, &ApiResponse{})
+		if err != nil {
+			return err
+		}
+		return callApi(speaker, "dist/stopDistribution", &ApiResponse{})
+	case RoleClient:
+		return postApi(speaker, "dist/setClientInfo", map[string]any{"group_id": "", "zone": []string{mainZone}}, &ApiResponse{})
+	}
+	return nil
+}
+
+// ipAddress is the host of the speaker's base URL, which link groups use to address the speakers
+func ipAddress(speaker *Speaker) (string, error) {
+	base, err := url.Parse(speaker.BaseUrl)
+	if err != nil || base.Hostname() == "" {
+		return "", fmt.Errorf("no address for %s in %q", speaker.FriendlyName, speaker.BaseUrl)
+	}
+	return base.Hostname(), nil
+}
+
+// group ids are 32 hex digits
+func newGroupId() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
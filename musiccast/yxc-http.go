@@ -1,16 +1,23 @@
 package musiccast
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var httpClient = &http.Client{}
 
+// TODO zones other than main
+const mainZone = "main"
+
 type ErrorCode interface {
 	ErrorCode() int
 }
@@ -23,6 +30,59 @@ func (r ApiResponse) ErrorCode() int {
 	return r.ResponseCode
 }
 
+const ResponseCodeUpdating = 99
+
+var responseCodeTexts = map[int]string{
+	1:                    "initializing",
+	2:                    "internal error",
+	3:                    "invalid request",
+	4:                    "invalid parameter",
+	5:                    "guarded",
+	6:                    "time out",
+	ResponseCodeUpdating: "firmware updating",
+	100:                  "access error",
+	101:                  "other errors",
+	102:                  "wrong user name",
+	103:                  "wrong password",
+	104:                  "account expired",
+	105:                  "account disconnected",
+	106:                  "account number limit reached",
+	107:                  "server maintenance",
+	108:                  "invalid account",
+	109:                  "license error",
+	110:                  "read only mode",
+	111:                  "max stations",
+	112:                  "access denied",
+	200:                  "linking in progress",
+	201:                  "unlinking in progress",
+}
+
+// ApiError is a YXC response with a response_code other than 0
+type ApiError struct {
+	Code int
+}
+
+func (e *ApiError) Error() string {
+	if text, ok := responseCodeTexts[e.Code]; ok {
+		return fmt.Sprintf("API response returned %d (%s)", e.Code, text)
+	}
+	return fmt.Sprintf("API response returned %d", e.Code)
+}
+
+// Reason is the text of the response code like "guarded" or the code if it has no text
+func (e *ApiError) Reason() string {
+	if text, ok := responseCodeTexts[e.Code]; ok {
+		return text
+	}
+	return "response code " + strconv.Itoa(e.Code)
+}
+
+// IsUpdating checks if the error says the device is updating its firmware
+func IsUpdating(err error) bool {
+	var apiError *ApiError
+	return errors.As(err, &apiError) && apiError.Code == ResponseCodeUpdating
+}
+
 type StatusResponse struct {
 	ApiResponse
 	Power     Power  `json:"power"`
@@ -32,6 +92,8 @@ type StatusResponse struct {
 	MaxVolume int8   `json:"max_volume"`
 	Input     string `json:"input"`
 	InputText string `json:"input_text"`
+	SoundSettings
+	ToneSettings
 }
 
 func (r StatusResponse) ErrorCode() int {
@@ -53,18 +115,18 @@ func updateStatus(speaker *Speaker, appPort int) error {
 	speaker.InputText = status.InputText
 	speaker.Input = status.Input
 	speaker.Mute = &status.Mute
+	speaker.Sound = &status.SoundSettings
+	speaker.Tone = &status.ToneSettings
+	speaker.Sleep = &status.Sleep
+	speaker.SleepEnd = sleepEnd(status.Sleep)
 	return nil
 }
 
 func GetStatus(speaker *Speaker, appPort int) (*StatusResponse, error) {
 	request, _ := http.NewRequest("GET", speaker.BaseUrl+"YamahaExtendedControl/v1/main/getStatus", nil)
 	subscribeEvents(appPort, request)
-	resp, err := httpClient.Do(request)
-	if err != nil {
-		return nil, err
-	}
 	target := StatusResponse{}
-	err = unmarshalApiResponse(resp, &target)
+	err := doApi(speaker, request, &target)
 	if err != nil {
 		return nil, err
 	}
@@ -107,12 +169,8 @@ func updateDeviceInfo(speaker *Speaker, appPort int) error {
 func GetDeviceInfo(speaker *Speaker, appPort int) (*DeviceInfoResponse, error) {
 	request, _ := http.NewRequest(http.MethodGet, speaker.BaseUrl+"YamahaExtendedControl/v1/system/getDeviceInfo", nil)
 	subscribeEvents(appPort, request)
-	resp, err := httpClient.Do(request)
-	if err != nil {
-		return nil, err
-	}
 	target := DeviceInfoResponse{}
-	err = unmarshalApiResponse(resp, &target)
+	err := doApi(speaker, request, &target)
 	if err != nil {
 		return nil, err
 	}
@@ -126,6 +184,57 @@ type RangeStep struct {
 	Step int    `json:"step"`
 }
 
+type ZoneFeatures struct {
+	Id                      string      `json:"id"`
+	FuncList                []string    `json:"func_list"`
+	InputList               []string    `json:"input_list"`
+	SoundProgramList        []string    `json:"sound_program_list"`
+	SurroundDecoderTypeList []string    `json:"surround_decoder_type_list"`
+	ToneControlModeList     []string    `json:"tone_control_mode_list"`
+	EqualizerModeList       []string    `json:"equalizer_mode_list"`
+	LinkControlList         []string    `json:"link_control_list"`
+	LinkAudioDelayList      []string    `json:"link_audio_delay_list"`
+	RangeStep               []RangeStep `json:"range_step"`
+	CcsSupported            []string    `json:"ccs_supported"`
+}
+
+// Supports checks if func_list contains the given function
+func (z ZoneFeatures) Supports(function string) bool {
+	return contains(z.FuncList, function)
+}
+
+type ClockFeatures struct {
+	FuncList         []string    `json:"func_list"`
+	RangeStep        []RangeStep `json:"range_step"`
+	AlarmFadeTypeNum int         `json:"alarm_fade_type_num"`
+	AlarmModeList    []string    `json:"alarm_mode_list"`
+	AlarmInputList   []string    `json:"alarm_input_list"`
+	AlarmPresetList  []string    `json:"alarm_preset_list"`
+}
+
+// Supports checks if func_list contains the given function
+func (c ClockFeatures) Supports(function string) bool {
+	return contains(c.FuncList, function)
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func rangeById(ranges []RangeStep, id string) (RangeStep, bool) {
+	for _, r := range ranges {
+		if r.Id == id {
+			return r, true
+		}
+	}
+	return RangeStep{}, false
+}
+
 type GetFeaturesResponse struct {
 	ApiResponse
 	System struct {
@@ -144,17 +253,7 @@ type GetFeaturesResponse struct {
 			TxConnectivityTypeMax int  `json:"tx_connectivity_type_max"`
 		} `json:"bluetooth"`
 	} `json:"system"`
-	Zone []struct {
-		Id                 string      `json:"id"`
-		FuncList           []string    `json:"func_list"`
-		InputList          []string    `json:"input_list"`
-		SoundProgramList   []string    `json:"sound_program_list"`
-		EqualizerModeList  []string    `json:"equalizer_mode_list"`
-		LinkControlList    []string    `json:"link_control_list"`
-		LinkAudioDelayList []string    `json:"link_audio_delay_list"`
-		RangeStep          []RangeStep `json:"range_step"`
-		CcsSupported       []string    `json:"ccs_supported"`
-	} `json:"zone"`
+	Zone   []ZoneFeatures `json:"zone"`
 	Netusb struct {
 		FuncList []string `json:"func_list"`
 		Preset   struct {
@@ -198,31 +297,32 @@ type GetFeaturesResponse struct {
 			} `json:"slave_role"`
 		} `json:"mc_surround"`
 	} `json:"distribution"`
-	Clock struct {
-		FuncList         []string    `json:"func_list"`
-		RangeStep        []RangeStep `json:"range_step"`
-		AlarmFadeTypeNum int         `json:"alarm_fade_type_num"`
-		AlarmModeList    []string    `json:"alarm_mode_list"`
-		AlarmInputList   []string    `json:"alarm_input_list"`
-		AlarmPresetList  []string    `json:"alarm_preset_list"`
-	} `json:"clock"`
-	Ccs struct {
+	Clock ClockFeatures `json:"clock"`
+	Ccs   struct {
 		Supported bool `json:"supported"`
 	} `json:"ccs"`
+	Cd struct {
+		FuncList []string `json:"func_list"`
+	} `json:"cd"`
 }
 
 func (r GetFeaturesResponse) ErrorCode() int {
 	return r.ResponseCode
 }
 
-func GetFeatures(speaker *Speaker) (*GetFeaturesResponse, error) {
-	request, _ := http.NewRequest(http.MethodGet, speaker.BaseUrl+"YamahaExtendedControl/v1/system/getFeatures", nil)
-	resp, err := httpClient.Do(request)
-	if err != nil {
-		return nil, err
+// MainZone returns the features of the main zone or nil if the device did not report it
+func (r GetFeaturesResponse) MainZone() *ZoneFeatures {
+	for i := range r.Zone {
+		if r.Zone[i].Id == mainZone {
+			return &r.Zone[i]
+		}
 	}
+	return nil
+}
+
+func GetFeatures(speaker *Speaker) (*GetFeaturesResponse, error) {
 	target := GetFeaturesResponse{}
-	err = unmarshalApiResponse(resp, &target)
+	err := callApi(speaker, "system/getFeatures", &target)
 	if err != nil {
 		return nil, err
 	}
@@ -230,84 +330,84 @@ func GetFeatures(speaker *Speaker) (*GetFeaturesResponse, error) {
 }
 
 func SetPower(speaker *Speaker, power Power) error {
-	request, _ := http.NewRequest(http.MethodGet, speaker.BaseUrl+"YamahaExtendedControl/v1/main/setPower?power="+strings.ToLower(string(power)), nil)
-	resp, err := httpClient.Do(request)
-	if err != nil {
-		return err
-	}
-	target := ApiResponse{}
-	err = unmarshalApiResponse(resp, &target)
-	if err != nil {
-		return err
-	}
-	return nil
+	return callApi(speaker, "main/setPower?power="+strings.ToLower(string(power)), &ApiResponse{})
 }
 
 func SetVolume(speaker *Speaker, direction Volume, step int) error {
-	url := speaker.BaseUrl + "YamahaExtendedControl/v1/main/setVolume?volume=" + strings.ToLower(string(direction))
+	path := "main/setVolume?volume=" + strings.ToLower(string(direction))
 	if step > 1 {
-		url += "&step=" + strconv.Itoa(step)
+		path += "&step=" + strconv.Itoa(step)
 	}
-	request, _ := http.NewRequest(http.MethodGet, url, nil)
-	resp, err := httpClient.Do(request)
-	if err != nil {
-		return err
+	return callApi(speaker, path, &ApiResponse{})
+}
+
+// SetVolumeTo sets the absolute volume, the range is 0 to the speaker's MaxVolume
+func SetVolumeTo(speaker *Speaker, volume int) error {
+	if volume < 0 {
+		volume = 0
 	}
-	target := ApiResponse{}
-	err = unmarshalApiResponse(resp, &target)
-	if err != nil {
-		return err
+	if speaker.MaxVolume > 0 && volume > int(speaker.MaxVolume) {
+		volume = int(speaker.MaxVolume)
 	}
-	return nil
+	return callApi(speaker, mainZone+"/setVolume?volume="+strconv.Itoa(volume), &ApiResponse{})
 }
 
 func SetMute(speaker *Speaker, mute bool) error {
-	request, _ := http.NewRequest(http.MethodGet, speaker.BaseUrl+"YamahaExtendedControl/v1/main/setMute?enable="+strconv.FormatBool(mute), nil)
-	resp, err := httpClient.Do(request)
-	if err != nil {
+	return callApi(speaker, "main/setMute?enable="+strconv.FormatBool(mute), &ApiResponse{})
+}
+
+// ValidateInput checks that the input is in the main zone's input_list if the features are known
+func ValidateInput(speaker *Speaker, input string) error {
+	if input == "" {
+		return errors.New("input must not be empty")
+	}
+	if speaker.Features != nil && speaker.Features.MainZone() != nil && !contains(speaker.Features.MainZone().InputList, input) {
+		return fmt.Errorf("input %q not in %v", input, speaker.Features.MainZone().InputList)
+	}
+	return nil
+}
+
+// SetInput switches the main zone to the input, see ValidateInput
+func SetInput(speaker *Speaker, input string) error {
+	if err := ValidateInput(speaker, input); err != nil {
 		return err
 	}
-	target := ApiResponse{}
-	err = unmarshalApiResponse(resp, &target)
+	return callApi(speaker, mainZone+"/setInput?input="+url.QueryEscape(input), &ApiResponse{})
+}
+
+// callApi issues a GET for the YXC path (relative to /YamahaExtendedControl/v1/) and decodes the response into target
+func callApi(speaker *Speaker, path string, target ErrorCode) error {
+	request, _ := http.NewRequest(http.MethodGet, speaker.BaseUrl+"YamahaExtendedControl/v1/"+path, nil)
+	return doApi(speaker, request, target)
+}
+
+// postApi sends body as JSON to the YXC path and decodes the response into target
+func postApi(speaker *Speaker, path string, body any, target ErrorCode) error {
+	payload, err := json.Marshal(body)
 	if err != nil {
 		return err
 	}
-	return nil
+	request, _ := http.NewRequest(http.MethodPost, speaker.BaseUrl+"YamahaExtendedControl/v1/"+path, bytes.NewReader(payload))
+	request.Header.Set("Content-Type", "application/json")
+	return doApi(speaker, request, target)
 }
 
-type GetPlayInfoResponse struct {
-	ApiResponse
-	Input         string `json:"input"`
-	Playback      string `json:"playback"`
-	Repeat        string `json:"repeat"`
-	Shuffle       string `json:"shuffle"`
-	PlayTime      int    `json:"play_time"`
-	TotalTime     int    `json:"total_time"`
-	Artist        string `json:"artist"`
-	Album         string `json:"album"`
-	Track         string `json:"track"`
-	AlbumartUrl   string `json:"albumart_url"`
-	AlbumartId    int    `json:" albumart_id"`
-	UsbDevicetype string `json:"usb_devicetype"`
-	Attribute     int    `json:"attribute"`
-}
-
-func (o GetPlayInfoResponse) ErrorCode() int {
-	return o.ResponseCode
-}
-
-func GetPlayInfo(speaker *Speaker) (*GetPlayInfoResponse, error) {
-	request, _ := http.NewRequest(http.MethodGet, speaker.BaseUrl+"YamahaExtendedControl/v1/netusb/getPlayInfo", nil)
+// doApi sends the request and watches the speaker if the response says its firmware is updating
+func doApi(speaker *Speaker, request *http.Request, target ErrorCode) error {
+	start := time.Now()
 	resp, err := httpClient.Do(request)
 	if err != nil {
-		return nil, err
+		observeCall(speaker.ID, request, start, err)
+		return err
 	}
-	target := GetPlayInfoResponse{}
-	err = unmarshalApiResponse(resp, &target)
-	if err != nil {
-		return nil, err
+	defer resp.Body.Close()
+	err = unmarshalApiResponse(resp, target)
+	observeCall(speaker.ID, request, start, err)
+	// speakers in discovery aren't known yet, the discovery watches them itself
+	if _, known := lookup(speaker.ID); IsUpdating(err) && known {
+		watchFirmwareUpdate(speaker, eventListenerPort)
 	}
-	return &target, nil
+	return err
 }
 
 func subscribeEvents(appPort int, request *http.Request) {
@@ -330,7 +430,7 @@ func unmarshalApiResponse(resp *http.Response, target ErrorCode) error {
 		return err
 	}
 	if target.ErrorCode() != 0 {
-		return fmt.Errorf("API response returned %d", target.ErrorCode())
+		return &ApiError{target.ErrorCode()}
 	}
 	return nil
 }
@@ -0,0 +1,146 @@
+package musiccast
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// netusb is the play_info_type of network and USB inputs like net_radio, spotify or server
+const netusbPlayInfoType = "netusb"
+
+// PlayInfo is what a netusb input is playing
+type PlayInfo struct {
+	Input    string   `json:"input"`
+	Playback Playback `json:"playback"`
+	Repeat   Repeat   `json:"repeat"`
+	Shuffle  Shuffle  `json:"shuffle"`
+	PlayTime int      `json:"play_time"`
+	// -60000 if unknown, e.g. for radio streams
+	TotalTime     int    `json:"total_time"`
+	Artist        string `json:"artist"`
+	Album         string `json:"album"`
+	Track         string `json:"track"`
+	AlbumartUrl   string `json:"albumart_url"`
+	AlbumartId    int    `json:"albumart_id"`
+	UsbDevicetype string `json:"usb_devicetype"`
+	Attribute     int    `json:"attribute"`
+}
+
+func (o PlayInfo) String() string {
+	return jsonStringer(o)
+}
+
+type GetPlayInfoResponse struct {
+	ApiResponse
+	PlayInfo
+}
+
+func (o GetPlayInfoResponse) ErrorCode() int {
+	return o.ResponseCode
+}
+
+// IsNetusbInput checks the input's play_info_type; false if the features are unknown
+func (o Speaker) IsNetusbInput(input string) bool {
+	if o.Features == nil {
+		return false
+	}
+	for _, i := range o.Features.System.InputList {
+		if i.Id == input {
+			return i.PlayInfoType == netusbPlayInfoType
+		}
+	}
+	return false
+}
+
+func GetPlayInfo(speaker *Speaker) (*GetPlayInfoResponse, error) {
+	target := GetPlayInfoResponse{}
+	err := callApi(speaker, "netusb/getPlayInfo", &target)
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// fetch the play info if the speaker is on a netusb input
+func updatePlayInfo(speaker *Speaker) error {
+	if !speaker.IsNetusbInput(speaker.Input) {
+		return nil
+	}
+	info, err := GetPlayInfo(speaker)
+	if err != nil {
+		return err
+	}
+	speaker.PlayInfo = &info.PlayInfo
+	return nil
+}
+
+func SetNetusbPlayback(speaker *Speaker, playback Playback) error {
+	return callApi(speaker, "netusb/setPlayback?playback="+string(playback), &ApiResponse{})
+}
+
+// SetPlayback controls the CD or netusb playback, depending on the current input
+func SetPlayback(speaker *Speaker, playback Playback) error {
+	switch {
+	case speaker.Input == CdInput:
+		return SetCdPlayback(speaker, playback)
+	case speaker.IsNetusbInput(speaker.Input):
+		return SetNetusbPlayback(speaker, playback)
+	}
+	return fmt.Errorf("playback on input %s: %w", speaker.Input, ErrNotSupported)
+}
+
+// Preset is a stored station or playlist, presets are numbered from 1 in list order
+type Preset struct {
+	Input string `json:"input"`
+	Text  string `json:"text"`
+}
+
+type GetPresetInfoResponse struct {
+	ApiResponse
+	PresetInfo []Preset `json:"preset_info"`
+}
+
+func (o GetPresetInfoResponse) ErrorCode() int {
+	return o.ResponseCode
+}
+
+func GetPresetInfo(speaker *Speaker) (*GetPresetInfoResponse, error) {
+	target := GetPresetInfoResponse{}
+	err := callApi(speaker, "netusb/getPresetInfo", &target)
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// RecallPreset switches to the preset's input and plays it
+func RecallPreset(speaker *Speaker, num int) error {
+	if num < 1 {
+		return fmt.Errorf("preset %d: presets start at 1", num)
+	}
+	return callApi(speaker, fmt.Sprintf("netusb/recallPreset?zone=%s&num=%d", mainZone, num), &ApiResponse{})
+}
+
+// CurrentPreset guesses which preset the speaker plays by comparing the presets with the play info,
+// the API doesn't tell. Returns 0 if none matches.
+func CurrentPreset(speaker *Speaker, presets []Preset) int {
+	if speaker.PlayInfo == nil || speaker.PlayInfo.Input != speaker.Input {
+		return 0
+	}
+	info := speaker.PlayInfo
+	for i, preset := range presets {
+		if preset.Input != speaker.Input || preset.Text == "" {
+			continue
+		}
+		// radio stations show up as artist or album, depending on the service
+		if preset.Text == info.Artist || preset.Text == info.Album || preset.Text == info.Track {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// SetPlayPosition seeks to the position in seconds, only tracks with a known total time can seek
+func SetPlayPosition(speaker *Speaker, position int) error {
+	return callApi(speaker, "netusb/setPlayPosition?position="+strconv.Itoa(position), &ApiResponse{})
+}
@@ -0,0 +1,162 @@
+package musiccast
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// SoundFunction is a zone func_list entry for sound and DSP settings
+type SoundFunction string
+
+const (
+	SoundProgram        SoundFunction = "sound_program"
+	SurroundDecoderType SoundFunction = "surround_decoder_type"
+	Surround3d          SoundFunction = "3d_surround"
+	Direct              SoundFunction = "direct"
+	PureDirect          SoundFunction = "pure_direct"
+	Enhancer            SoundFunction = "enhancer"
+	ClearVoice          SoundFunction = "clear_voice"
+	BassExtension       SoundFunction = "bass_extension"
+	ExtraBass           SoundFunction = "extra_bass"
+	AdaptiveDrc         SoundFunction = "adaptive_drc"
+)
+
+// SoundToggles lists the on/off sound functions in display order
+var SoundToggles = []SoundFunction{Surround3d, Direct, PureDirect, Enhancer, ClearVoice, BassExtension, ExtraBass, AdaptiveDrc}
+
+var soundFunctionLabels = map[SoundFunction]string{
+	SoundProgram:        "Sound program",
+	SurroundDecoderType: "Surround decoder",
+	Surround3d:          "3D surround",
+	Direct:              "Direct",
+	PureDirect:          "Pure direct",
+	Enhancer:            "Enhancer",
+	ClearVoice:          "Clear voice",
+	BassExtension:       "Bass extension",
+	ExtraBass:           "Extra bass",
+	AdaptiveDrc:         "Adaptive DRC",
+}
+
+func (f SoundFunction) Label() string {
+	if label, ok := soundFunctionLabels[f]; ok {
+		return label
+	}
+	return string(f)
+}
+
+// SoundSettings is the sound part of the zone status
+type SoundSettings struct {
+	SoundProgram        string `json:"sound_program"`
+	SurroundDecoderType string `json:"surround_decoder_type"`
+	Surround3d          bool   `json:"3d_surround"`
+	Direct              bool   `json:"direct"`
+	PureDirect          bool   `json:"pure_direct"`
+	Enhancer            bool   `json:"enhancer"`
+	ClearVoice          bool   `json:"clear_voice"`
+	BassExtension       bool   `json:"bass_extension"`
+	ExtraBass           bool   `json:"extra_bass"`
+	AdaptiveDrc         bool   `json:"adaptive_drc"`
+}
+
+func (o SoundSettings) String() string {
+	return jsonStringer(o)
+}
+
+// Enabled returns the state of an on/off sound function
+func (o SoundSettings) Enabled(function SoundFunction) bool {
+	switch function {
+	case Surround3d:
+		return o.Surround3d
+	case Direct:
+		return o.Direct
+	case PureDirect:
+		return o.PureDirect
+	case Enhancer:
+		return o.Enhancer
+	case ClearVoice:
+		return o.ClearVoice
+	case BassExtension:
+		return o.BassExtension
+	case ExtraBass:
+		return o.ExtraBass
+	case AdaptiveDrc:
+		return o.AdaptiveDrc
+	}
+	return false
+}
+
+func SetSoundProgram(speaker *Speaker, program string) error {
+	if err := requireZoneFunc(speaker, string(SoundProgram)); err != nil {
+		return err
+	}
+	return callApi(speaker, mainZone+"/setSoundProgram?program="+url.QueryEscape(program), &ApiResponse{})
+}
+
+func SetSurroundDecoderType(speaker *Speaker, decoderType string) error {
+	if err := requireZoneFunc(speaker, string(SurroundDecoderType)); err != nil {
+		return err
+	}
+	return callApi(speaker, mainZone+"/setSurroundDecoderType?type="+url.QueryEscape(decoderType), &ApiResponse{})
+}
+
+func Set3dSurround(speaker *Speaker, enable bool) error {
+	return setSoundToggle(speaker, Surround3d, "set3dSurround", enable)
+}
+
+func SetDirect(speaker *Speaker, enable bool) error {
+	return setSoundToggle(speaker, Direct, "setDirect", enable)
+}
+
+func SetPureDirect(speaker *Speaker, enable bool) error {
+	return setSoundToggle(speaker, PureDirect, "setPureDirect", enable)
+}
+
+func SetEnhancer(speaker *Speaker, enable bool) error {
+	return setSoundToggle(speaker, Enhancer, "setEnhancer", enable)
+}
+
+func SetClearVoice(speaker *Speaker, enable bool) error {
+	return setSoundToggle(speaker, ClearVoice, "setClearVoice", enable)
+}
+
+func SetBassExtension(speaker *Speaker, enable bool) error {
+	return setSoundToggle(speaker, BassExtension, "setBassExtension", enable)
+}
+
+func SetExtraBass(speaker *Speaker, enable bool) error {
+	return setSoundToggle(speaker, ExtraBass, "setExtraBass", enable)
+}
+
+func SetAdaptiveDrc(speaker *Speaker, enable bool) error {
+	return setSoundToggle(speaker, AdaptiveDrc, "setAdaptiveDrc", enable)
+}
+
+// SetSoundToggle switches one of the SoundToggles on or off
+func SetSoundToggle(speaker *Speaker, function SoundFunction, enable bool) error {
+	switch function {
+	case Surround3d:
+		return Set3dSurround(speaker, enable)
+	case Direct:
+		return SetDirect(speaker, enable)
+	case PureDirect:
+		return SetPureDirect(speaker, enable)
+	case Enhancer:
+		return SetEnhancer(speaker, enable)
+	case ClearVoice:
+		return SetClearVoice(speaker, enable)
+	case BassExtension:
+		return SetBassExtension(speaker, enable)
+	case ExtraBass:
+		return SetExtraBass(speaker, enable)
+	case AdaptiveDrc:
+		return SetAdaptiveDrc(speaker, enable)
+	}
+	return ErrNotSupported
+}
+
+func setSoundToggle(speaker *Speaker, function SoundFunction, endpoint string, enable bool) error {
+	if err := requireZoneFunc(speaker, string(function)); err != nil {
+		return err
+	}
+	return callApi(speaker, mainZone+"/"+endpoint+"?enable="+strconv.FormatBool(enable), &ApiResponse{})
+}
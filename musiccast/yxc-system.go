@@ -0,0 +1,449 @@
+package musiccast
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SystemFunction is a system func_list entry for device settings
+type SystemFunction string
+
+const (
+	AutoPowerStandby SystemFunction = "auto_power_standby"
+	IrSensor         SystemFunction = "ir_sensor"
+	SpeakerA         SystemFunction = "speaker_a"
+	SpeakerB         SystemFunction = "speaker_b"
+	PartyMode        SystemFunction = "party_mode"
+	HdmiOut1         SystemFunction = "hdmi_out_1"
+	HdmiOut2         SystemFunction = "hdmi_out_2"
+	WirelessDirect   SystemFunction = "wireless_direct"
+	Dimmer           SystemFunction = "dimmer"
+	SpeakerPattern   SystemFunction = "speaker_pattern"
+)
+
+// SystemToggles lists the on/off device settings in display order
+var SystemToggles = []SystemFunction{AutoPowerStandby, PartyMode, SpeakerA, SpeakerB, HdmiOut1, HdmiOut2, IrSensor, WirelessDirect}
+
+// SystemLevels lists the numeric device settings in display order
+var SystemLevels = []SystemFunction{Dimmer, SpeakerPattern}
+
+var systemFunctionLabels = map[SystemFunction]string{
+	AutoPowerStandby: "Auto power standby",
+	IrSensor:         "IR sensor",
+	SpeakerA:         "Speaker A",
+	SpeakerB:         "Speaker B",
+	PartyMode:        "Party mode",
+	HdmiOut1:         "HDMI out 1",
+	HdmiOut2:         "HDMI out 2",
+	WirelessDirect:   "Wireless direct",
+	Dimmer:           "Dimmer",
+	SpeakerPattern:   "Speaker pattern",
+}
+
+func (f SystemFunction) Label() string {
+	if label, ok := systemFunctionLabels[f]; ok {
+		return label
+	}
+	return string(f)
+}
+
+// FuncStatus is the state of the device settings
+type FuncStatus struct {
+	AutoPowerStandby bool `json:"auto_power_standby"`
+	IrSensor         bool `json:"ir_sensor"`
+	SpeakerA         bool `json:"speaker_a"`
+	SpeakerB         bool `json:"speaker_b"`
+	Headphone        bool `json:"headphone"`
+	PartyMode        bool `json:"party_mode"`
+	HdmiOut1         bool `json:"hdmi_out_1"`
+	HdmiOut2         bool `json:"hdmi_out_2"`
+	WirelessDirect   bool `json:"wireless_direct"`
+	Dimmer           int  `json:"dimmer"`
+	SpeakerPattern   int  `json:"speaker_pattern"`
+}
+
+func (o FuncStatus) String() string {
+	return jsonStringer(o)
+}
+
+// Enabled returns the state of an on/off setting
+func (o FuncStatus) Enabled(function SystemFunction) bool {
+	switch function {
+	case AutoPowerStandby:
+		return o.AutoPowerStandby
+	case IrSensor:
+		return o.IrSensor
+	case SpeakerA:
+		return o.SpeakerA
+	case SpeakerB:
+		return o.SpeakerB
+	case PartyMode:
+		return o.PartyMode
+	case HdmiOut1:
+		return o.HdmiOut1
+	case HdmiOut2:
+		return o.HdmiOut2
+	case WirelessDirect:
+		return o.WirelessDirect
+	}
+	return false
+}
+
+// Value returns the state of a numeric setting
+func (o FuncStatus) Value(function SystemFunction) int {
+	switch function {
+	case Dimmer:
+		return o.Dimmer
+	case SpeakerPattern:
+		return o.SpeakerPattern
+	}
+	return 0
+}
+
+type GetFuncStatusResponse struct {
+	ApiResponse
+	FuncStatus
+}
+
+func (r GetFuncStatusResponse) ErrorCode() int {
+	return r.ResponseCode
+}
+
+// SupportsSystemFunc checks if the system func_list contains the function; false if the features are unknown
+func (o Speaker) SupportsSystemFunc(function SystemFunction) bool {
+	return o.Features != nil && contains(o.Features.System.FuncList, string(function))
+}
+
+// SystemRange returns the range of a numeric setting if the speaker's features list it
+func (o Speaker) SystemRange(function SystemFunction) (RangeStep, bool) {
+	if o.Features == nil {
+		return RangeStep{}, false
+	}
+	return rangeById(o.Features.System.RangeStep, string(function))
+}
+
+func requireSystemFunc(speaker *Speaker, function SystemFunction) error {
+	if speaker.Features != nil && !speaker.SupportsSystemFunc(function) {
+		return fmt.Errorf("%s: %w", function, ErrNotSupported)
+	}
+	return nil
+}
+
+func GetFuncStatus(speaker *Speaker) (*GetFuncStatusResponse, error) {
+	target := GetFuncStatusResponse{}
+	err := callApi(speaker, "system/getFuncStatus", &target)
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+func updateFuncStatus(speaker *Speaker) error {
+	status, err := GetFuncStatus(speaker)
+	if err != nil {
+		return err
+	}
+	speaker.FuncStatus = &status.FuncStatus
+	return nil
+}
+
+func SetAutoPowerStandby(speaker *Speaker, enable bool) error {
+	return setSystemToggle(speaker, AutoPowerStandby, "setAutoPowerStandby", enable)
+}
+
+func SetIrSensor(speaker *Speaker, enable bool) error {
+	return setSystemToggle(speaker, IrSensor, "setIrSensor", enable)
+}
+
+func SetSpeakerA(speaker *Speaker, enable bool) error {
+	return setSystemToggle(speaker, SpeakerA, "setSpeakerA", enable)
+}
+
+func SetSpeakerB(speaker *Speaker, enable bool) error {
+	return setSystemToggle(speaker, SpeakerB, "setSpeakerB", enable)
+}
+
+func SetPartyMode(speaker *Speaker, enable bool) error {
+	return setSystemToggle(speaker, PartyMode, "setPartyMode", enable)
+}
+
+func SetHdmiOut1(speaker *Speaker, enable bool) error {
+	return setSystemToggle(speaker, HdmiOut1, "setHdmiOut1", enable)
+}
+
+func SetHdmiOut2(speaker *Speaker, enable bool) error {
+	return setSystemToggle(speaker, HdmiOut2, "setHdmiOut2", enable)
+}
+
+func SetWirelessDirect(speaker *Speaker, enable bool) error {
+	return setSystemToggle(speaker, WirelessDirect, "setWirelessDirect", enable)
+}
+
+func SetDimmer(speaker *Speaker, value int) error {
+	return setSystemLevel(speaker, Dimmer, "setDimmer?value=", value)
+}
+
+func SetSpeakerPattern(speaker *Speaker, num int) error {
+	return setSystemLevel(speaker, SpeakerPattern, "setSpeakerPattern?num=", num)
+}
+
+// SetSystemToggle switches one of the SystemToggles on or off
+func SetSystemToggle(speaker *Speaker, function SystemFunction, enable bool) error {
+	switch function {
+	case AutoPowerStandby:
+		return SetAutoPowerStandby(speaker, enable)
+	case IrSensor:
+		return SetIrSensor(speaker, enable)
+	case SpeakerA:
+		return SetSpeakerA(speaker, enable)
+	case SpeakerB:
+		return SetSpeakerB(speaker, enable)
+	case PartyMode:
+		return SetPartyMode(speaker, enable)
+	case HdmiOut1:
+		return SetHdmiOut1(speaker, enable)
+	case HdmiOut2:
+		return SetHdmiOut2(speaker, enable)
+	case WirelessDirect:
+		return SetWirelessDirect(speaker, enable)
+	}
+	return ErrNotSupported
+}
+
+// SetSystemLevel sets one of the SystemLevels
+func SetSystemLevel(speaker *Speaker, function SystemFunction, value int) error {
+	switch function {
+	case Dimmer:
+		return SetDimmer(speaker, value)
+	case SpeakerPattern:
+		return SetSpeakerPattern(speaker, value)
+	}
+	return ErrNotSupported
+}
+
+func setSystemToggle(speaker *Speaker, function SystemFunction, endpoint string, enable bool) error {
+	if err := requireSystemFunc(speaker, function); err != nil {
+		return err
+	}
+	return callApi(speaker, "system/"+endpoint+"?enable="+strconv.FormatBool(enable), &ApiResponse{})
+}
+
+func setSystemLevel(speaker *Speaker, function SystemFunction, endpoint string, value int) error {
+	if err := requireSystemFunc(speaker, function); err != nil {
+		return err
+	}
+	if r, ok := speaker.SystemRange(function); ok {
+		value = r.Clamp(value)
+	}
+	return callApi(speaker, "system/"+endpoint+strconv.Itoa(value), &ApiResponse{})
+}
+
+type NameText struct {
+	Id   string `json:"id"`
+	Text string `json:"text"`
+}
+
+type GetNameTextResponse struct {
+	ApiResponse
+	ZoneList         []NameText `json:"zone_list"`
+	InputList        []NameText `json:"input_list"`
+	SoundProgramList []NameText `json:"sound_program_list"`
+}
+
+func (r GetNameTextResponse) ErrorCode() int {
+	return r.ResponseCode
+}
+
+// Name returns the text for the zone or input id
+func (r GetNameTextResponse) Name(id string) (string, bool) {
+	for _, names := range [][]NameText{r.ZoneList, r.InputList} {
+		for _, name := range names {
+			if name.Id == id {
+				return name.Text, true
+			}
+		}
+	}
+	return "", false
+}
+
+// CanRenameInput checks the input's rename_enable; false if the features are unknown
+func (o Speaker) CanRenameInput(input string) bool {
+	if o.Features == nil {
+		return false
+	}
+	for _, i := range o.Features.System.InputList {
+		if i.Id == input {
+			return i.RenameEnable
+		}
+	}
+	return false
+}
+
+func GetNameText(speaker *Speaker) (*GetNameTextResponse, error) {
+	target := GetNameTextResponse{}
+	err := callApi(speaker, "system/getNameText", &target)
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// fetch the zone and input names and apply them as friendly name and input text
+func updateNameText(speaker *Speaker) error {
+	names, err := GetNameText(speaker)
+	if err != nil {
+		return err
+	}
+	if name, ok := names.Name(mainZone); ok && name != "" {
+		speaker.FriendlyName = name
+	}
+	if name, ok := names.Name(speaker.Input); ok && name != "" {
+		speaker.InputText = name
+	}
+	return nil
+}
+
+// SetNameText renames the zone (use RenameSpeaker for the main zone) or the input with the given id
+func SetNameText(speaker *Speaker, id string, text string) error {
+	if text == "" {
+		return errors.New("name must not be empty")
+	}
+	if id != mainZone && speaker.Features != nil && !speaker.CanRenameInput(id) {
+		return fmt.Errorf("renaming %s: %w", id, ErrNotSupported)
+	}
+	return postApi(speaker, "system/setNameText", NameText{id, text}, &ApiResponse{})
+}
+
+func RenameSpeaker(speaker *Speaker, name string) error {
+	return SetNameText(speaker, mainZone, name)
+}
+
+const (
+	ConnectionWired          = "wired"
+	ConnectionWirelessLan    = "wireless_lan"
+	ConnectionWirelessDirect = "wireless_direct"
+)
+
+type NetworkStatus struct {
+	NetworkName string `json:"network_name"`
+	// wired, wireless_lan, wireless_direct or extend_*
+	Connection     string `json:"connection"`
+	Dhcp           bool   `json:"dhcp"`
+	IpAddress      string `json:"ip_address"`
+	SubnetMask     string `json:"subnet_mask"`
+	DefaultGateway string `json:"default_gateway"`
+	DnsServer1     string `json:"dns_server_1"`
+	DnsServer2     string `json:"dns_server_2"`
+	WirelessLan    struct {
+		Ssid string `json:"ssid"`
+		Type string `json:"type"`
+		Ch   int    `json:"ch"`
+		// signal quality 0-100
+		Strength int `json:"strength"`
+	} `json:"wireless_lan"`
+	WirelessDirect struct {
+		Ssid string `json:"ssid"`
+		Type string `json:"type"`
+	} `json:"wireless_direct"`
+	MusicCastNetwork struct {
+		Ready bool `json:"ready"`
+		// root, node or standard
+		DeviceType         string `json:"device_type"`
+		ChildNum           int    `json:"child_num"`
+		Ch                 int    `json:"ch"`
+		InitialJoinRunning bool   `json:"initial_join_running"`
+	} `json:"musiccast_network"`
+	MacAddress struct {
+		Wired          string `json:"wired"`
+		WirelessLan    string `json:"wireless_lan"`
+		WirelessDirect string `json:"wireless_direct"`
+	} `json:"mac_address"`
+	// only reported by some devices
+	Vlan *struct {
+		Enable bool `json:"enable"`
+		Id     int  `json:"id"`
+	} `json:"vlan"`
+}
+
+func (o NetworkStatus) String() string {
+	return jsonStringer(o)
+}
+
+// IsWireless checks if the speaker uses Wi-Fi and reports a signal strength
+func (o NetworkStatus) IsWireless() bool {
+	return o.Connection == ConnectionWirelessLan
+}
+
+// MacAddressInUse returns the MAC address of the active connection
+func (o NetworkStatus) MacAddressInUse() string {
+	switch o.Connection {
+	case ConnectionWired:
+		return o.MacAddress.Wired
+	case ConnectionWirelessDirect:
+		return o.MacAddress.WirelessDirect
+	}
+	return o.MacAddress.WirelessLan
+}
+
+type GetNetworkStatusResponse struct {
+	ApiResponse
+	NetworkStatus
+}
+
+func (r GetNetworkStatusResponse) ErrorCode() int {
+	return r.ResponseCode
+}
+
+func GetNetworkStatus(speaker *Speaker) (*GetNetworkStatusResponse, error) {
+	target := GetNetworkStatusResponse{}
+	err := callApi(speaker, "system/getNetworkStatus", &target)
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+func updateNetworkStatus(speaker *Speaker) error {
+	status, err := GetNetworkStatus(speaker)
+	if err != nil {
+		return err
+	}
+	speaker.Network = &status.NetworkStatus
+	return nil
+}
+
+type GetLocationInfoResponse struct {
+	ApiResponse
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	// zone id -> zone is part of this location
+	ZoneList map[string]bool `json:"zone_list"`
+}
+
+func (r GetLocationInfoResponse) ErrorCode() int {
+	return r.ResponseCode
+}
+
+func GetLocationInfo(speaker *Speaker) (*GetLocationInfoResponse, error) {
+	target := GetLocationInfoResponse{}
+	err := callApi(speaker, "system/getLocationInfo", &target)
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// SignalBars renders the Wi-Fi strength as up to four bars, empty for other connections
+func (o NetworkStatus) SignalBars() string {
+	if !o.IsWireless() {
+		return ""
+	}
+	bars := []rune("▂▄▆█")
+	count := 1 + o.WirelessLan.Strength/25
+	if count > len(bars) {
+		count = len(bars)
+	}
+	return string(bars[:count]) + strings.Repeat("_", len(bars)-count)
+}
@@ -0,0 +1,212 @@
+package musiccast
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// ToneLevel is a single adjustable level of the zone's tone settings
+type ToneLevel string
+
+const (
+	Bass            ToneLevel = "bass"
+	Treble          ToneLevel = "treble"
+	EqualizerLow    ToneLevel = "equalizer_low"
+	EqualizerMid    ToneLevel = "equalizer_mid"
+	EqualizerHigh   ToneLevel = "equalizer_high"
+	Balance         ToneLevel = "balance"
+	SubwooferVolume ToneLevel = "subwoofer_volume"
+	DialogueLevel   ToneLevel = "dialogue_level"
+)
+
+// ToneLevels lists all levels in display order
+var ToneLevels = []ToneLevel{Bass, Treble, EqualizerLow, EqualizerMid, EqualizerHigh, Balance, SubwooferVolume, DialogueLevel}
+
+var toneLevelLabels = map[ToneLevel]string{
+	Bass:            "Bass",
+	Treble:          "Treble",
+	EqualizerLow:    "EQ low",
+	EqualizerMid:    "EQ mid",
+	EqualizerHigh:   "EQ high",
+	Balance:         "Balance",
+	SubwooferVolume: "Subwoofer",
+	DialogueLevel:   "Dialogue level",
+}
+
+func (l ToneLevel) Label() string {
+	if label, ok := toneLevelLabels[l]; ok {
+		return label
+	}
+	return string(l)
+}
+
+// Function is the func_list entry and range_step id which covers this level
+func (l ToneLevel) Function() string {
+	switch l {
+	case Bass, Treble:
+		return "tone_control"
+	case EqualizerLow, EqualizerMid, EqualizerHigh:
+		return "equalizer"
+	}
+	return string(l)
+}
+
+type ToneControl struct {
+	Mode   string `json:"mode"`
+	Bass   int    `json:"bass"`
+	Treble int    `json:"treble"`
+}
+
+type Equalizer struct {
+	Mode string `json:"mode"`
+	Low  int    `json:"low"`
+	Mid  int    `json:"mid"`
+	High int    `json:"high"`
+}
+
+// ToneSettings is the tone part of the zone status
+type ToneSettings struct {
+	ToneControl     ToneControl `json:"tone_control"`
+	Equalizer       Equalizer   `json:"equalizer"`
+	Balance         int         `json:"balance"`
+	SubwooferVolume int         `json:"subwoofer_volume"`
+	DialogueLevel   int         `json:"dialogue_level"`
+}
+
+func (o ToneSettings) String() string {
+	return jsonStringer(o)
+}
+
+func (o ToneSettings) Value(level ToneLevel) int {
+	switch level {
+	case Bass:
+		return o.ToneControl.Bass
+	case Treble:
+		return o.ToneControl.Treble
+	case EqualizerLow:
+		return o.Equalizer.Low
+	case EqualizerMid:
+		return o.Equalizer.Mid
+	case EqualizerHigh:
+		return o.Equalizer.High
+	case Balance:
+		return o.Balance
+	case SubwooferVolume:
+		return o.SubwooferVolume
+	case DialogueLevel:
+		return o.DialogueLevel
+	}
+	return 0
+}
+
+// Clamp limits the value to min/max and snaps it to the step
+func (r RangeStep) Clamp(value int) int {
+	if value < r.Min {
+		return r.Min
+	}
+	if value > r.Max {
+		return r.Max
+	}
+	if r.Step > 1 {
+		value = r.Min + (value-r.Min)/r.Step*r.Step
+	}
+	return value
+}
+
+// Range returns the range_step with the given id
+func (z ZoneFeatures) Range(id string) (RangeStep, bool) {
+	return rangeById(z.RangeStep, id)
+}
+
+// ToneRange returns the range of the level, if the speaker's features are known and list it
+func (o Speaker) ToneRange(level ToneLevel) (RangeStep, bool) {
+	if o.Features == nil || o.Features.MainZone() == nil {
+		return RangeStep{}, false
+	}
+	return o.Features.MainZone().Range(level.Function())
+}
+
+func clampTone(speaker *Speaker, level ToneLevel, value int) int {
+	if r, ok := speaker.ToneRange(level); ok {
+		return r.Clamp(value)
+	}
+	return value
+}
+
+func SetToneControl(speaker *Speaker, bass int, treble int) error {
+	if err := requireZoneFunc(speaker, Bass.Function()); err != nil {
+		return err
+	}
+	bass = clampTone(speaker, Bass, bass)
+	treble = clampTone(speaker, Treble, treble)
+	return callApi(speaker, fmt.Sprintf("%s/setToneControl?bass=%d&treble=%d", mainZone, bass, treble), &ApiResponse{})
+}
+
+// SetEqualizer sets mode and levels, the mode is left untouched if empty
+func SetEqualizer(speaker *Speaker, equalizer Equalizer) error {
+	if err := requireZoneFunc(speaker, EqualizerLow.Function()); err != nil {
+		return err
+	}
+	path := fmt.Sprintf("%s/setEqualizer?low=%d&mid=%d&high=%d", mainZone,
+		clampTone(speaker, EqualizerLow, equalizer.Low),
+		clampTone(speaker, EqualizerMid, equalizer.Mid),
+		clampTone(speaker, EqualizerHigh, equalizer.High))
+	if equalizer.Mode != "" {
+		path += "&mode=" + url.QueryEscape(equalizer.Mode)
+	}
+	return callApi(speaker, path, &ApiResponse{})
+}
+
+func SetEqualizerMode(speaker *Speaker, mode string) error {
+	if err := requireZoneFunc(speaker, EqualizerLow.Function()); err != nil {
+		return err
+	}
+	return callApi(speaker, mainZone+"/setEqualizer?mode="+url.QueryEscape(mode), &ApiResponse{})
+}
+
+func SetBalance(speaker *Speaker, value int) error {
+	return setToneValue(speaker, Balance, "setBalance?value=", value)
+}
+
+func SetSubwooferVolume(speaker *Speaker, volume int) error {
+	return setToneValue(speaker, SubwooferVolume, "setSubwooferVolume?volume=", volume)
+}
+
+func SetDialogueLevel(speaker *Speaker, value int) error {
+	return setToneValue(speaker, DialogueLevel, "setDialogueLevel?value=", value)
+}
+
+// SetToneLevel changes a single level and keeps the other levels of the same function as they are
+func SetToneLevel(speaker *Speaker, level ToneLevel, value int) error {
+	current := ToneSettings{}
+	if speaker.Tone != nil {
+		current = *speaker.Tone
+	}
+	switch level {
+	case Bass:
+		return SetToneControl(speaker, value, current.ToneControl.Treble)
+	case Treble:
+		return SetToneControl(speaker, current.ToneControl.Bass, value)
+	case EqualizerLow:
+		return SetEqualizer(speaker, Equalizer{Low: value, Mid: current.Equalizer.Mid, High: current.Equalizer.High})
+	case EqualizerMid:
+		return SetEqualizer(speaker, Equalizer{Low: current.Equalizer.Low, Mid: value, High: current.Equalizer.High})
+	case EqualizerHigh:
+		return SetEqualizer(speaker, Equalizer{Low: current.Equalizer.Low, Mid: current.Equalizer.Mid, High: value})
+	case Balance:
+		return SetBalance(speaker, value)
+	case SubwooferVolume:
+		return SetSubwooferVolume(speaker, value)
+	case DialogueLevel:
+		return SetDialogueLevel(speaker, value)
+	}
+	return ErrNotSupported
+}
+
+func setToneValue(speaker *Speaker, level ToneLevel, endpoint string, value int) error {
+	if err := requireZoneFunc(speaker, level.Function()); err != nil {
+		return err
+	}
+	return callApi(speaker, mainZone+"/"+endpoint+strconv.Itoa(clampTone(speaker, level, value)), &ApiResponse{})
+}